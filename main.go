@@ -1,24 +1,62 @@
 package main
 
 import (
+	"context"
+	"os"
+	"radius-server/src/cache"
 	"radius-server/src/common/logger"
 	"radius-server/src/config"
 	"radius-server/src/database"
 	"radius-server/src/radius"
+	"radius-server/src/radius/dictionary"
+	"radius-server/src/radius/revocation"
 	"radius-server/src/routes"
+	numberUtil "radius-server/src/utils/number"
 )
 
+const migrateUsage = "Usage: radius-server migrate up | down N | version | force VERSION"
+
 func init() {
 	logger.InitializeLogger()
 }
 
 func main() {
 	config.LoadConfig()
+	if config.AppConfig.IsDebug {
+		logger.SetDebugLevel()
+	}
 
 	if err := database.Connect(); err != nil {
 		logger.Logger.Fatal().Msgf("Connection to database error. %s", err.Error())
 	}
 
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" {
+			logger.Logger.Fatal().Msgf("Unknown command %s. %s", os.Args[1], migrateUsage)
+		}
+		runMigrateCommand(os.Args[2:])
+		return
+	}
+
+	if config.AppConfig.Database.AutoRunMigration {
+		if err := database.MigrateUp(); err != nil {
+			logger.Logger.Fatal().Msgf("Run migrations error. %s", err.Error())
+		}
+	}
+
+	if path := config.AppConfig.RadiusServer.DictionaryPath; path != "" {
+		if err := dictionary.LoadFile(path); err != nil {
+			logger.Logger.Fatal().Msgf("Load dictionary error. %s", err.Error())
+		}
+	}
+
+	if err := cache.StartNasCache(context.Background()); err != nil {
+		logger.Logger.Fatal().Msgf("Load NAS cache error. %s", err.Error())
+	}
+	if err := revocation.Start(context.Background()); err != nil {
+		logger.Logger.Fatal().Msgf("Load CRL error. %s", err.Error())
+	}
+
 	go func() {
 		app, listenAddress := routes.New()
 		if err := app.Listen(listenAddress); err != nil {
@@ -29,3 +67,51 @@ func main() {
 		logger.Logger.Fatal().Msgf("Startup radius server error. %s", err.Error())
 	}
 }
+
+func runMigrateCommand(args []string) {
+	if len(args) == 0 {
+		logger.Logger.Fatal().Msg(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		if err := database.MigrateUp(); err != nil {
+			logger.Logger.Fatal().Msgf("Migrate up error. %s", err.Error())
+		}
+		logger.Logger.Info().Msg("Migrations applied")
+	case "down":
+		steps := migrateCommandNumber(args)
+		if steps < 1 {
+			logger.Logger.Fatal().Msg("Number of migrations to roll back must be at least 1")
+		}
+		if err := database.MigrateDown(steps); err != nil {
+			logger.Logger.Fatal().Msgf("Migrate down error. %s", err.Error())
+		}
+		logger.Logger.Info().Msgf("Rolled back %d migration(s)", steps)
+	case "version":
+		version, dirty, err := database.MigrationVersion()
+		if err != nil {
+			logger.Logger.Fatal().Msgf("Get migration version error. %s", err.Error())
+		}
+		logger.Logger.Info().Uint("version", version).Bool("dirty", dirty).Msg("Migration version")
+	case "force":
+		version := migrateCommandNumber(args)
+		if err := database.ForceMigrationVersion(version); err != nil {
+			logger.Logger.Fatal().Msgf("Force migration version error. %s", err.Error())
+		}
+		logger.Logger.Info().Msgf("Migration version forced to %d", version)
+	default:
+		logger.Logger.Fatal().Msg(migrateUsage)
+	}
+}
+
+func migrateCommandNumber(args []string) int {
+	if len(args) < 2 {
+		logger.Logger.Fatal().Msg(migrateUsage)
+	}
+	number, err := numberUtil.StringToInt(args[1])
+	if err != nil {
+		logger.Logger.Fatal().Msgf("%s is not a number. %s", args[1], migrateUsage)
+	}
+	return number
+}
@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/config"
+	"radius-server/src/database"
+	"radius-server/src/database/entities"
+	arrayUtil "radius-server/src/utils/array"
+	networkUtil "radius-server/src/utils/network"
+	timeUtil "radius-server/src/utils/time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// NAS cache used by the RADIUS listeners to resolve shared secrets without a
+// database round trip per packet. It is warmed at startup, refreshed
+// periodically and on radius_nas_changed notifications, and keeps serving
+// the last known rows while the database is unavailable.
+
+const (
+	NasChangedChannel = "radius_nas_changed"
+
+	nasMissTtl              = 30 * time.Second
+	nasListenerRetryBackoff = 5 * time.Second
+)
+
+type nasPrefixEntry struct {
+	prefix netip.Prefix
+	nas    entities.RadiusNas
+}
+
+type nasCache struct {
+	mu sync.RWMutex
+	// byIp holds single address entries, prefixes holds subnet entries
+	// ordered from the longest prefix to the shortest
+	byIp          map[netip.Addr]entities.RadiusNas
+	prefixes      []nasPrefixEntry
+	misses        map[netip.Addr]time.Time
+	byTlsIdentity map[string]entities.RadiusNas
+}
+
+var nasStore = &nasCache{
+	byIp:          map[netip.Addr]entities.RadiusNas{},
+	misses:        map[netip.Addr]time.Time{},
+	byTlsIdentity: map[string]entities.RadiusNas{},
+}
+
+// StartNasCache loads every NAS and starts the refresh and notification
+// listeners, which stop when ctx is cancelled.
+func StartNasCache(ctx context.Context) error {
+	if err := ReloadNas(); err != nil {
+		return err
+	}
+	go refreshNasPeriodically(ctx)
+	go listenNasChanges(ctx)
+	return nil
+}
+
+// GetNasByIp returns the cached NAS whose address or prefix contains ip,
+// preferring the longest prefix. Unknown addresses are looked up in the
+// database once and remembered as missing for a short time, so a flood from
+// an unregistered source does not reach Postgres on every packet.
+func GetNasByIp(ip string) (*entities.RadiusNas, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+	addr = addr.Unmap()
+
+	nasStore.mu.RLock()
+	nas, ok := nasStore.lookupLocked(addr)
+	missUntil, missed := nasStore.misses[addr]
+	nasStore.mu.RUnlock()
+	if ok {
+		return &nas, nil
+	}
+	if missed && time.Now().Before(missUntil) {
+		return nil, nil
+	}
+
+	found, err := database.GetNasByIp(addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	nasStore.mu.Lock()
+	defer nasStore.mu.Unlock()
+	if found == nil {
+		nasStore.misses[addr] = time.Now().Add(nasMissTtl)
+		return nil, nil
+	}
+	delete(nasStore.misses, addr)
+	nasStore.addLocked(*found)
+	return found, nil
+}
+
+// GetNasByTlsIdentity returns the NAS registered for one of the identities of
+// a RadSec client certificate, trying them in order. Unknown identities are
+// looked up in the database, the TLS handshake already rate limits them.
+func GetNasByTlsIdentity(identities ...string) (*entities.RadiusNas, error) {
+	if len(identities) == 0 {
+		return nil, nil
+	}
+
+	nasStore.mu.RLock()
+	for _, identity := range identities {
+		if nas, ok := nasStore.byTlsIdentity[identity]; ok {
+			nasStore.mu.RUnlock()
+			return &nas, nil
+		}
+	}
+	nasStore.mu.RUnlock()
+
+	found, err := database.GetNasByTlsIdentities(identities)
+	if err != nil || found == nil {
+		return nil, err
+	}
+
+	nasStore.mu.Lock()
+	defer nasStore.mu.Unlock()
+	nasStore.addLocked(*found)
+	return found, nil
+}
+
+func (c *nasCache) lookupLocked(addr netip.Addr) (entities.RadiusNas, bool) {
+	if nas, ok := c.byIp[addr]; ok {
+		return nas, true
+	}
+	for _, entry := range c.prefixes {
+		if entry.prefix.Contains(addr) {
+			return entry.nas, true
+		}
+	}
+	return entities.RadiusNas{}, false
+}
+
+func (c *nasCache) addLocked(nas entities.RadiusNas) {
+	if nas.TlsIdentity != nil {
+		c.byTlsIdentity[*nas.TlsIdentity] = nas
+	}
+	prefix, err := networkUtil.ParsePrefix(nas.IpAddress)
+	if err != nil {
+		logger.Logger.Warn().Int64("nas_id", nas.Id).Msgf("Skip NAS with invalid address %s", nas.IpAddress)
+		return
+	}
+	if prefix.IsSingleIP() {
+		c.byIp[prefix.Addr()] = nas
+		return
+	}
+	for i, entry := range c.prefixes {
+		if entry.prefix == prefix {
+			c.prefixes[i].nas = nas
+			return
+		}
+	}
+	c.prefixes = append(c.prefixes, nasPrefixEntry{prefix: prefix, nas: nas})
+	sort.SliceStable(c.prefixes, func(i, j int) bool {
+		return c.prefixes[i].prefix.Bits() > c.prefixes[j].prefix.Bits()
+	})
+}
+
+func (c *nasCache) removeLocked(address string) {
+	prefix, err := networkUtil.ParsePrefix(address)
+	if err != nil {
+		return
+	}
+	for identity, nas := range c.byTlsIdentity {
+		if nasPrefix, err := networkUtil.ParsePrefix(nas.IpAddress); err == nil && nasPrefix == prefix {
+			delete(c.byTlsIdentity, identity)
+		}
+	}
+	if prefix.IsSingleIP() {
+		delete(c.byIp, prefix.Addr())
+		delete(c.misses, prefix.Addr())
+		return
+	}
+	c.prefixes = arrayUtil.Filter(c.prefixes, func(entry nasPrefixEntry) bool {
+		return entry.prefix != prefix
+	})
+	for addr := range c.misses {
+		if prefix.Contains(addr) {
+			delete(c.misses, addr)
+		}
+	}
+}
+
+// ReloadNas replaces the cache content with the current radius_nas rows. On
+// error the previous content is kept.
+func ReloadNas() error {
+	nasList, err := database.GetAllNas()
+	if err != nil {
+		return err
+	}
+
+	reloaded := &nasCache{
+		byIp:          make(map[netip.Addr]entities.RadiusNas, len(nasList)),
+		misses:        map[netip.Addr]time.Time{},
+		byTlsIdentity: map[string]entities.RadiusNas{},
+	}
+	for _, nas := range nasList {
+		reloaded.addLocked(nas)
+	}
+
+	nasStore.mu.Lock()
+	nasStore.byIp = reloaded.byIp
+	nasStore.prefixes = reloaded.prefixes
+	nasStore.misses = reloaded.misses
+	nasStore.byTlsIdentity = reloaded.byTlsIdentity
+	nasStore.mu.Unlock()
+	return nil
+}
+
+// InvalidateNas drops the given addresses or prefixes immediately and reloads
+// the cache. Dropped entries are resolved from the database on the next
+// packet if the reload fails.
+func InvalidateNas(addresses ...string) {
+	nasStore.mu.Lock()
+	for _, address := range addresses {
+		nasStore.removeLocked(address)
+	}
+	nasStore.mu.Unlock()
+
+	if err := ReloadNas(); err != nil {
+		logger.Logger.Error().Msgf("Reload NAS cache error. %s", err.Error())
+	}
+}
+
+func refreshNasPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(timeUtil.DurationSeconds(config.AppConfig.RadiusServer.NasCacheRefreshIntervalSec))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ReloadNas(); err != nil {
+				logger.Logger.Warn().Msgf("Refresh NAS cache error, serving last known NAS list. %s", err.Error())
+			}
+		}
+	}
+}
+
+// listenNasChanges reloads the cache on every radius_nas_changed notification,
+// emitted by a trigger on radius_nas for writes from any instance.
+func listenNasChanges(ctx context.Context) {
+	for {
+		if err := waitNasNotifications(ctx); err != nil && ctx.Err() == nil {
+			logger.Logger.Warn().Msgf("NAS change listener error, retrying. %s", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(nasListenerRetryBackoff):
+		}
+	}
+}
+
+func waitNasNotifications(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, config.AppConfig.Database.Dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+NasChangedChannel); err != nil {
+		return err
+	}
+	// Notifications may have been missed while disconnected
+	if err := ReloadNas(); err != nil {
+		logger.Logger.Warn().Msgf("Reload NAS cache error. %s", err.Error())
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		InvalidateNas(notification.Payload)
+	}
+}
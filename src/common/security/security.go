@@ -0,0 +1,23 @@
+package security
+
+import (
+	"crypto/subtle"
+
+	"radius-server/src/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const ApiKeyHeader = "X-Api-Key"
+
+// ApiKeyMiddleware rejects requests whose X-Api-Key header does not match
+// SECURITY_X_API_KEY.
+func ApiKeyMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		apiKey := c.Get(ApiKeyHeader)
+		if apiKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(config.AppConfig.Security.XApiKey)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(map[string]string{"message": "Invalid API key"})
+		}
+		return c.Next()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"radius-server/src/common/logger"
 	"strconv"
+	"strings"
 
 	typeUtil "radius-server/src/utils/type"
 
@@ -37,12 +38,62 @@ type SecurityConfig struct {
 }
 
 type RadiusServerConfig struct {
-	AccessHandlerServerPort     int
-	AccountingHandlerServerPort int
-	CoaHandlerServerPort        int
-	AccessHandlerServerHost     string
-	AccountingHandlerServerHost string
-	CoaHandlerServerHost        string
+	AccessHandlerServerPort      int
+	AccountingHandlerServerPort  int
+	CoaHandlerServerPort         int
+	AccessHandlerServerHosts     []string
+	AccountingHandlerServerHosts []string
+	CoaHandlerServerHosts        []string
+	NasCacheRefreshIntervalSec   int
+	DuplicateCacheTtlSec         int
+	DuplicateCacheMaxSize        int
+	StatusServerStatistics       bool
+	DictionaryPath               string
+	TcpEnabled                   bool
+	TcpIdleTimeoutSec            int
+	RadSec                       RadSecConfig
+	Eap                          EapConfig
+	Revocation                   RevocationConfig
+}
+
+type RadSecConfig struct {
+	Enabled         bool
+	ServerPort      int
+	ServerHosts     []string
+	DtlsEnabled     bool
+	DtlsServerPort  int
+	DtlsServerHosts []string
+	// DtlsSessionTtlSec is how long DTLS sessions can be resumed, 0 disables
+	// resumption
+	DtlsSessionTtlSec int
+	CertFile          string
+	KeyFile           string
+	ClientCaFile      string
+	IdleTimeoutSec    int
+}
+
+type EapConfig struct {
+	Methods              []string
+	SessionTtlSec        int
+	MaxSessions          int
+	TlsCertFile          string
+	TlsKeyFile           string
+	TlsCaFile            string
+	TlsFragmentSize      int
+	TlsMinVersion        string
+	TlsMaxVersion        string
+	TlsCheckIdentity     bool
+	TtlsResumptionTtlSec int
+}
+
+type RevocationConfig struct {
+	CrlSources            []string
+	CrlRefreshIntervalSec int
+	OcspEnabled           bool
+	OcspResponderUrl      string
+	OcspTimeoutSec        int
+	OcspCacheTtlSec       int
+	FailPolicy            string
 }
 
 type RedisConnectionConfig struct {
@@ -115,9 +166,69 @@ func LoadConfig() {
 	radiusAccountingHanlderServerPort := getEnvAsInt("ACCOUNTING_HANDLER_SERVER_PORT", typeUtil.Int(1813), typeUtil.Int(0), typeUtil.Int(6666665))
 	radiusCoaHandlerServerPort := getEnvAsInt("COA_HANDLER_SERVER_PORT", typeUtil.Int(3799), typeUtil.Int(0), typeUtil.Int(6666665))
 
-	radiusAccessHanlderServerHost := getEnvAsString("ACCESS_HANDLER_SERVER_HOST", typeUtil.String("localhost"))
-	radiusAccountingHanlderServerHost := getEnvAsString("ACCOUNTING_HANDLER_SERVER_HOST", typeUtil.String("localhost"))
-	radiusCoaHandlerServerHost := getEnvAsString("COA_HANDLER_SERVER_HOST", typeUtil.String("localhost"))
+	// Comma separated bind addresses, e.g. "0.0.0.0,::". An empty value binds
+	// every address of both IP families.
+	radiusAccessHanlderServerHosts := getEnvAsStringList("ACCESS_HANDLER_SERVER_HOST", typeUtil.String(""))
+	radiusAccountingHanlderServerHosts := getEnvAsStringList("ACCOUNTING_HANDLER_SERVER_HOST", typeUtil.String(""))
+	radiusCoaHandlerServerHosts := getEnvAsStringList("COA_HANDLER_SERVER_HOST", typeUtil.String(""))
+
+	radiusNasCacheRefreshIntervalSec := getEnvAsInt("NAS_CACHE_REFRESH_INTERVAL_SEC", typeUtil.Int(60), typeUtil.Int(1), nil)
+	radiusDuplicateCacheTtlSec := getEnvAsInt("DUPLICATE_CACHE_TTL_SEC", typeUtil.Int(10), typeUtil.Int(1), nil)
+	radiusDuplicateCacheMaxSize := getEnvAsInt("DUPLICATE_CACHE_MAX_SIZE", typeUtil.Int(100000), typeUtil.Int(1), nil)
+	radiusStatusServerStatistics := getEnvAsBool("STATUS_SERVER_STATISTICS", typeUtil.Bool(false))
+	// FreeRADIUS format dictionary loaded on top of the embedded ones
+	radiusDictionaryPath := getEnvAsString("DICTIONARY_PATH", typeUtil.String(""))
+
+	radiusTcpEnabled := getEnvAsBool("TCP_ENABLED", typeUtil.Bool(false))
+	radiusTcpIdleTimeoutSec := getEnvAsInt("TCP_IDLE_TIMEOUT_SEC", typeUtil.Int(600), typeUtil.Int(1), nil)
+
+	radSecEnabled := getEnvAsBool("RADSEC_ENABLED", typeUtil.Bool(false))
+	radSecServerPort := getEnvAsInt("RADSEC_SERVER_PORT", typeUtil.Int(2083), typeUtil.Int(0), typeUtil.Int(6666665))
+	radSecServerHosts := getEnvAsStringList("RADSEC_SERVER_HOST", typeUtil.String(""))
+	radSecDtlsEnabled := getEnvAsBool("RADSEC_DTLS_ENABLED", typeUtil.Bool(false))
+	radSecDtlsServerPort := getEnvAsInt("RADSEC_DTLS_SERVER_PORT", typeUtil.Int(2083), typeUtil.Int(0), typeUtil.Int(6666665))
+	radSecDtlsServerHosts := getEnvAsStringList("RADSEC_DTLS_SERVER_HOST", typeUtil.String(""))
+	radSecDtlsSessionTtlSec := getEnvAsInt("RADSEC_DTLS_SESSION_TTL_SEC", typeUtil.Int(3600), typeUtil.Int(0), nil)
+	radSecCertFile := getEnvAsString("RADSEC_CERT_FILE", typeUtil.String(""))
+	radSecKeyFile := getEnvAsString("RADSEC_KEY_FILE", typeUtil.String(""))
+	radSecClientCaFile := getEnvAsString("RADSEC_CLIENT_CA_FILE", typeUtil.String(""))
+	radSecIdleTimeoutSec := getEnvAsInt("RADSEC_IDLE_TIMEOUT_SEC", typeUtil.Int(600), typeUtil.Int(1), nil)
+	if (radSecEnabled || radSecDtlsEnabled) && (radSecCertFile == "" || radSecKeyFile == "" || radSecClientCaFile == "") {
+		logger.Logger.Fatal().Msg("RADSEC_CERT_FILE, RADSEC_KEY_FILE and RADSEC_CLIENT_CA_FILE are required when RADSEC_ENABLED or RADSEC_DTLS_ENABLED is set.")
+	}
+
+	// Enabled EAP methods by order of preference, the first one available to
+	// the user is proposed
+	eapMethods := getEnvAsStringList("EAP_METHODS", typeUtil.String("md5"))
+	eapSessionTtlSec := getEnvAsInt("EAP_SESSION_TTL_SEC", typeUtil.Int(30), typeUtil.Int(1), nil)
+	eapMaxSessions := getEnvAsInt("EAP_MAX_SESSIONS", typeUtil.Int(10000), typeUtil.Int(1), nil)
+	eapTlsCertFile := getEnvAsString("EAP_TLS_CERT_FILE", typeUtil.String(""))
+	eapTlsKeyFile := getEnvAsString("EAP_TLS_KEY_FILE", typeUtil.String(""))
+	eapTlsCaFile := getEnvAsString("EAP_TLS_CA_FILE", typeUtil.String(""))
+	// TLS data per request, the whole packet must stay within 4096 bytes
+	eapTlsFragmentSize := getEnvAsInt("EAP_TLS_FRAGMENT_SIZE", typeUtil.Int(1024), typeUtil.Int(64), typeUtil.Int(3000))
+	eapTlsMinVersion := getEnvAsString("EAP_TLS_MIN_VERSION", typeUtil.String("1.2"))
+	eapTlsMaxVersion := getEnvAsString("EAP_TLS_MAX_VERSION", typeUtil.String("1.3"))
+	eapTlsCheckIdentity := getEnvAsBool("EAP_TLS_CHECK_IDENTITY", typeUtil.Bool(true))
+	// EAP-TTLS sessions resumed within it skip the inner authentication, 0
+	// disables session tickets
+	eapTtlsResumptionTtlSec := getEnvAsInt("EAP_TTLS_RESUMPTION_TTL_SEC", typeUtil.Int(3600), typeUtil.Int(0), nil)
+
+	// Revocation checking of the client certificates of EAP-TLS and RadSec.
+	// CRL sources are files or HTTP URLs, the OCSP responder URL overrides
+	// the one of the certificates
+	crlSources := getEnvAsStringList("CRL_SOURCES", typeUtil.String(""))
+	crlRefreshIntervalSec := getEnvAsInt("CRL_REFRESH_INTERVAL_SEC", typeUtil.Int(3600), typeUtil.Int(10), nil)
+	ocspEnabled := getEnvAsBool("OCSP_ENABLED", typeUtil.Bool(false))
+	ocspResponderUrl := getEnvAsString("OCSP_RESPONDER_URL", typeUtil.String(""))
+	ocspTimeoutSec := getEnvAsInt("OCSP_TIMEOUT_SEC", typeUtil.Int(5), typeUtil.Int(1), typeUtil.Int(60))
+	ocspCacheTtlSec := getEnvAsInt("OCSP_CACHE_TTL_SEC", typeUtil.Int(300), typeUtil.Int(0), nil)
+	// soft accepts certificates whose status no source knows, hard rejects
+	// them
+	revocationFailPolicy := strings.ToLower(getEnvAsString("REVOCATION_FAIL_POLICY", typeUtil.String("soft")))
+	if revocationFailPolicy != "soft" && revocationFailPolicy != "hard" {
+		logger.Logger.Fatal().Msgf("REVOCATION_FAIL_POLICY must be soft or hard, got %s", revocationFailPolicy)
+	}
 
 	AppConfig = &Config{
 		AppName:    appName,
@@ -156,16 +267,58 @@ func LoadConfig() {
 		Cors: CorsConfig{
 			Origins:     "*",
 			Methods:     "GET,POST,PUT,DELETE,OPTIONS",
-			Headers:     "Origin, Content-Type, Accept, Authorization",
+			Headers:     "Origin, Content-Type, Accept, Authorization, X-Api-Key",
 			Credentials: false,
 		},
 		RadiusServer: RadiusServerConfig{
-			AccessHandlerServerPort:     radiusAccessHanlderServerPort,
-			AccountingHandlerServerPort: radiusAccountingHanlderServerPort,
-			CoaHandlerServerPort:        radiusCoaHandlerServerPort,
-			AccessHandlerServerHost:     radiusAccessHanlderServerHost,
-			AccountingHandlerServerHost: radiusAccountingHanlderServerHost,
-			CoaHandlerServerHost:        radiusCoaHandlerServerHost,
+			AccessHandlerServerPort:      radiusAccessHanlderServerPort,
+			AccountingHandlerServerPort:  radiusAccountingHanlderServerPort,
+			CoaHandlerServerPort:         radiusCoaHandlerServerPort,
+			AccessHandlerServerHosts:     radiusAccessHanlderServerHosts,
+			AccountingHandlerServerHosts: radiusAccountingHanlderServerHosts,
+			CoaHandlerServerHosts:        radiusCoaHandlerServerHosts,
+			NasCacheRefreshIntervalSec:   radiusNasCacheRefreshIntervalSec,
+			DuplicateCacheTtlSec:         radiusDuplicateCacheTtlSec,
+			DuplicateCacheMaxSize:        radiusDuplicateCacheMaxSize,
+			StatusServerStatistics:       radiusStatusServerStatistics,
+			DictionaryPath:               radiusDictionaryPath,
+			TcpEnabled:                   radiusTcpEnabled,
+			TcpIdleTimeoutSec:            radiusTcpIdleTimeoutSec,
+			RadSec: RadSecConfig{
+				Enabled:           radSecEnabled,
+				ServerPort:        radSecServerPort,
+				ServerHosts:       radSecServerHosts,
+				DtlsEnabled:       radSecDtlsEnabled,
+				DtlsServerPort:    radSecDtlsServerPort,
+				DtlsServerHosts:   radSecDtlsServerHosts,
+				DtlsSessionTtlSec: radSecDtlsSessionTtlSec,
+				CertFile:          radSecCertFile,
+				KeyFile:           radSecKeyFile,
+				ClientCaFile:      radSecClientCaFile,
+				IdleTimeoutSec:    radSecIdleTimeoutSec,
+			},
+			Eap: EapConfig{
+				Methods:              eapMethods,
+				SessionTtlSec:        eapSessionTtlSec,
+				MaxSessions:          eapMaxSessions,
+				TlsCertFile:          eapTlsCertFile,
+				TlsKeyFile:           eapTlsKeyFile,
+				TlsCaFile:            eapTlsCaFile,
+				TlsFragmentSize:      eapTlsFragmentSize,
+				TlsMinVersion:        eapTlsMinVersion,
+				TlsMaxVersion:        eapTlsMaxVersion,
+				TlsCheckIdentity:     eapTlsCheckIdentity,
+				TtlsResumptionTtlSec: eapTtlsResumptionTtlSec,
+			},
+			Revocation: RevocationConfig{
+				CrlSources:            crlSources,
+				CrlRefreshIntervalSec: crlRefreshIntervalSec,
+				OcspEnabled:           ocspEnabled,
+				OcspResponderUrl:      ocspResponderUrl,
+				OcspTimeoutSec:        ocspTimeoutSec,
+				OcspCacheTtlSec:       ocspCacheTtlSec,
+				FailPolicy:            revocationFailPolicy,
+			},
 		},
 	}
 
@@ -183,6 +336,15 @@ func getEnvAsString(key string, defaultValue *string) string {
 	return value
 }
 
+func getEnvAsStringList(key string, defaultValue *string) []string {
+	value := getEnvAsString(key, defaultValue)
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		items = append(items, strings.TrimSpace(item))
+	}
+	return items
+}
+
 func getEnvAsInt(key string, defaultValue *int, minValue *int, maxValue *int) int {
 	value, exists := os.LookupEnv(key)
 	if !exists {
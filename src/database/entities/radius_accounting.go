@@ -0,0 +1,29 @@
+package entities
+
+const RadiusAccountingTable = "radius_accounting"
+
+type RadiusAccounting struct {
+	Id                 int64   `json:"id" gorm:"primaryKey;autoIncrement"`
+	AcctSessionId      string  `json:"acct_session_id" gorm:"type:varchar(128);not null;index:idx_radius_accounting_acct_session_id"`
+	AcctStatusType     string  `json:"acct_status_type" gorm:"type:varchar(32);not null"`
+	Username           *string `json:"username" gorm:"type:varchar(253);index:idx_radius_accounting_username"`
+	NasIpAddress       string  `json:"nas_ip_address" gorm:"type:inet;not null"`
+	NasIdentifier      *string `json:"nas_identifier" gorm:"type:varchar(253)"`
+	NasPortId          *string `json:"nas_port_id" gorm:"type:varchar(253)"`
+	FramedIpAddress    *string `json:"framed_ip_address" gorm:"type:inet"`
+	CallingStationId   *string `json:"calling_station_id" gorm:"type:varchar(253)"`
+	CalledStationId    *string `json:"called_station_id" gorm:"type:varchar(253)"`
+	AcctSessionTime    int64   `json:"acct_session_time" gorm:"not null;default:0"`
+	AcctInputOctets    int64   `json:"acct_input_octets" gorm:"not null;default:0"`
+	AcctOutputOctets   int64   `json:"acct_output_octets" gorm:"not null;default:0"`
+	AcctInputPackets   int64   `json:"acct_input_packets" gorm:"not null;default:0"`
+	AcctOutputPackets  int64   `json:"acct_output_packets" gorm:"not null;default:0"`
+	AcctTerminateCause *string `json:"acct_terminate_cause" gorm:"type:varchar(64)"`
+	AcctDelayTime      int64   `json:"acct_delay_time" gorm:"not null;default:0"`
+	EventTimestamp     int64   `json:"event_timestamp" gorm:"not null"`
+	CreatedAt          int64   `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (RadiusAccounting) TableName() string {
+	return RadiusAccountingTable
+}
@@ -0,0 +1,20 @@
+package entities
+
+const RadiusCheckTable = "radius_check"
+
+// RadiusCheck is a check item of a user, like FreeRADIUS radcheck. Items with
+// a comparison operator are matched against the request, the others (e.g.
+// Auth-Type := Reject, Cleartext-Password := ...) configure the request.
+type RadiusCheck struct {
+	Id        int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Username  string `json:"username" gorm:"type:varchar(253);not null;index:idx_radius_check_username"`
+	Attribute string `json:"attribute" gorm:"type:varchar(64);not null"`
+	Op        string `json:"op" gorm:"type:varchar(2);not null;default:'=='"`
+	Value     string `json:"value" gorm:"type:varchar(253);not null"`
+	CreatedAt int64  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt int64  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (RadiusCheck) TableName() string {
+	return RadiusCheckTable
+}
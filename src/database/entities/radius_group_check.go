@@ -0,0 +1,18 @@
+package entities
+
+const RadiusGroupCheckTable = "radius_group_check"
+
+// RadiusGroupCheck is a check item of a group, like FreeRADIUS radgroupcheck.
+type RadiusGroupCheck struct {
+	Id        int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	GroupName string `json:"groupname" gorm:"column:groupname;type:varchar(64);not null;index:idx_radius_group_check_groupname"`
+	Attribute string `json:"attribute" gorm:"type:varchar(64);not null"`
+	Op        string `json:"op" gorm:"type:varchar(2);not null;default:'=='"`
+	Value     string `json:"value" gorm:"type:varchar(253);not null"`
+	CreatedAt int64  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt int64  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (RadiusGroupCheck) TableName() string {
+	return RadiusGroupCheckTable
+}
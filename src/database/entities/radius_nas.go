@@ -2,15 +2,23 @@ package entities
 
 const RadiusNasTable = "radius_nas"
 
+type MessageAuthenticatorPolicy string
+
+const (
+	MessageAuthenticatorRequire          MessageAuthenticatorPolicy = "require"
+	MessageAuthenticatorRequireIfPresent MessageAuthenticatorPolicy = "require-if-present"
+	MessageAuthenticatorOff              MessageAuthenticatorPolicy = "off"
+)
+
 type RadiusNas struct {
-	Id           int64   `json:"id" gorm:"primaryKey;autoIncrement"`
-	NasName      *string `json:"nas_name" gorm:"type:varchar(128)"`
-	IpAddress    string  `json:"ip_address" gorm:"type:inet;unique;not null;index:idx_radius_nas_ip_address"`
-	Secret       string  `json:"secret" gorm:"type:varchar(64);not null"`
-	SubscriberId *string `json:"subscriber_id" gorm:"type:varchar(64)"`
-	SessionId    *string `json:"session_id" gorm:"type:varchar(128)"`
-	CreatedAt    int64   `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt    int64   `json:"updated_at" gorm:"autoUpdateTime"`
+	Id                         int64                      `json:"id" gorm:"primaryKey;autoIncrement"`
+	NasName                    *string                    `json:"nas_name" gorm:"type:varchar(128)"`
+	IpAddress                  string                     `json:"ip_address" gorm:"type:inet;unique;not null;index:idx_radius_nas_ip_address"`
+	Secret                     string                     `json:"-" gorm:"type:varchar(64);not null"`
+	MessageAuthenticatorPolicy MessageAuthenticatorPolicy `json:"message_authenticator_policy" gorm:"type:varchar(32);not null;default:'require'"`
+	TlsIdentity                *string                    `json:"tls_identity" gorm:"type:varchar(255);uniqueIndex:idx_radius_nas_tls_identity"`
+	CreatedAt                  int64                      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt                  int64                      `json:"updated_at" gorm:"autoUpdateTime"`
 }
 
 func (RadiusNas) TableName() string {
@@ -0,0 +1,18 @@
+package entities
+
+const RadiusReplyTable = "radius_reply"
+
+// RadiusReply is a reply item of a user, like FreeRADIUS radreply.
+type RadiusReply struct {
+	Id        int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Username  string `json:"username" gorm:"type:varchar(253);not null;index:idx_radius_reply_username"`
+	Attribute string `json:"attribute" gorm:"type:varchar(64);not null"`
+	Op        string `json:"op" gorm:"type:varchar(2);not null;default:'='"`
+	Value     string `json:"value" gorm:"type:varchar(253);not null"`
+	CreatedAt int64  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt int64  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (RadiusReply) TableName() string {
+	return RadiusReplyTable
+}
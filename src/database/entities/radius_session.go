@@ -0,0 +1,31 @@
+package entities
+
+const RadiusSessionTable = "radius_sessions"
+
+type RadiusSession struct {
+	Id               int64   `json:"id" gorm:"primaryKey;autoIncrement"`
+	AcctSessionId    string  `json:"acct_session_id" gorm:"type:varchar(128);not null;uniqueIndex:idx_radius_sessions_session_nas"`
+	NasIpAddress     string  `json:"nas_ip_address" gorm:"type:inet;not null;uniqueIndex:idx_radius_sessions_session_nas"`
+	Username         *string `json:"username" gorm:"type:varchar(253);index:idx_radius_sessions_username"`
+	SubscriberId     *string `json:"subscriber_id" gorm:"type:varchar(64)"`
+	NasPortId        *string `json:"nas_port_id" gorm:"type:varchar(253)"`
+	FramedIpAddress  *string `json:"framed_ip_address" gorm:"type:inet"`
+	CallingStationId *string `json:"calling_station_id" gorm:"type:varchar(253)"`
+	CalledStationId  *string `json:"called_station_id" gorm:"type:varchar(253)"`
+	SessionTime      int64   `json:"session_time" gorm:"not null;default:0"`
+	InputOctets      int64   `json:"input_octets" gorm:"not null;default:0"`
+	OutputOctets     int64   `json:"output_octets" gorm:"not null;default:0"`
+	InputPackets     int64   `json:"input_packets" gorm:"not null;default:0"`
+	OutputPackets    int64   `json:"output_packets" gorm:"not null;default:0"`
+	TerminateCause   *string `json:"terminate_cause" gorm:"type:varchar(64)"`
+	IsOnline         bool    `json:"is_online" gorm:"not null;index:idx_radius_sessions_is_online"`
+	StartedAt        int64   `json:"started_at" gorm:"not null"`
+	LastUpdatedAt    int64   `json:"last_updated_at" gorm:"not null"`
+	StoppedAt        *int64  `json:"stopped_at"`
+	CreatedAt        int64   `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        int64   `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (RadiusSession) TableName() string {
+	return RadiusSessionTable
+}
@@ -0,0 +1,18 @@
+package entities
+
+const RadiusUserTable = "radius_users"
+
+type RadiusUser struct {
+	Id                int64   `json:"id" gorm:"primaryKey;autoIncrement"`
+	Username          string  `json:"username" gorm:"type:varchar(253);unique;not null;index:idx_radius_users_username"`
+	Password          string  `json:"-" gorm:"type:varchar(255);not null"`
+	CleartextPassword *string `json:"-" gorm:"type:varchar(253)"`
+	NtPasswordHash    *string `json:"-" gorm:"type:char(32)"`
+	IsActive          bool    `json:"is_active" gorm:"not null;default:true"`
+	CreatedAt         int64   `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt         int64   `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (RadiusUser) TableName() string {
+	return RadiusUserTable
+}
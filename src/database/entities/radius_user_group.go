@@ -0,0 +1,18 @@
+package entities
+
+const RadiusUserGroupTable = "radius_user_groups"
+
+// RadiusUserGroup assigns a user to a group, like FreeRADIUS radusergroup.
+// Groups are evaluated by ascending priority.
+type RadiusUserGroup struct {
+	Id        int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Username  string `json:"username" gorm:"type:varchar(253);not null;uniqueIndex:idx_radius_user_groups_username_groupname"`
+	GroupName string `json:"groupname" gorm:"column:groupname;type:varchar(64);not null;uniqueIndex:idx_radius_user_groups_username_groupname"`
+	Priority  int    `json:"priority" gorm:"not null;default:1"`
+	CreatedAt int64  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt int64  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (RadiusUserGroup) TableName() string {
+	return RadiusUserGroupTable
+}
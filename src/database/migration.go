@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"radius-server/src/database/migrations"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// newMigrate builds a migrator on a dedicated connection of DbConn, so
+// closing it does not close the shared pool.
+func newMigrate() (*migrate.Migrate, *sql.Conn, error) {
+	sqlDB, err := DbConn.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	driver, err := postgres.WithConnection(context.Background(), conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	source, err := iofs.New(migrations.Files, ".")
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return m, conn, nil
+}
+
+func withMigrate(fn func(m *migrate.Migrate) error) error {
+	m, conn, err := newMigrate()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return fn(m)
+}
+
+// MigrateUp applies every pending migration.
+func MigrateUp() error {
+	return withMigrate(func(m *migrate.Migrate) error {
+		if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+		return nil
+	})
+}
+
+// MigrateDown rolls back the given number of migrations.
+func MigrateDown(steps int) error {
+	return withMigrate(func(m *migrate.Migrate) error {
+		if err := m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+		return nil
+	})
+}
+
+// MigrationVersion returns the current schema version and whether the last
+// migration failed half way.
+func MigrationVersion() (uint, bool, error) {
+	var (
+		version uint
+		dirty   bool
+	)
+	err := withMigrate(func(m *migrate.Migrate) error {
+		var err error
+		version, dirty, err = m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			return nil
+		}
+		return err
+	})
+	return version, dirty, err
+}
+
+// ForceMigrationVersion sets the schema version without running migrations,
+// used to recover from a dirty state.
+func ForceMigrationVersion(version int) error {
+	return withMigrate(func(m *migrate.Migrate) error {
+		return m.Force(version)
+	})
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS radius_nas (
+    id         BIGSERIAL PRIMARY KEY,
+    nas_name   VARCHAR(128),
+    ip_address INET        NOT NULL UNIQUE,
+    secret     VARCHAR(64) NOT NULL,
+    created_at BIGINT      NOT NULL DEFAULT 0,
+    updated_at BIGINT      NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_radius_nas_ip_address ON radius_nas (ip_address);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS radius_users (
+    id                 BIGSERIAL PRIMARY KEY,
+    username           VARCHAR(253) NOT NULL UNIQUE,
+    password           VARCHAR(255) NOT NULL,
+    cleartext_password VARCHAR(253),
+    nt_password_hash   CHAR(32),
+    is_active          BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at         BIGINT       NOT NULL DEFAULT 0,
+    updated_at         BIGINT       NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_radius_users_username ON radius_users (username);
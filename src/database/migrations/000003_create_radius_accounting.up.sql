@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS radius_accounting (
+    id                   BIGSERIAL PRIMARY KEY,
+    acct_session_id      VARCHAR(128) NOT NULL,
+    acct_status_type     VARCHAR(32)  NOT NULL,
+    username             VARCHAR(253),
+    nas_ip_address       INET         NOT NULL,
+    nas_identifier       VARCHAR(253),
+    nas_port_id          VARCHAR(253),
+    framed_ip_address    INET,
+    calling_station_id   VARCHAR(253),
+    called_station_id    VARCHAR(253),
+    acct_session_time    BIGINT       NOT NULL DEFAULT 0,
+    acct_input_octets    BIGINT       NOT NULL DEFAULT 0,
+    acct_output_octets   BIGINT       NOT NULL DEFAULT 0,
+    acct_input_packets   BIGINT       NOT NULL DEFAULT 0,
+    acct_output_packets  BIGINT       NOT NULL DEFAULT 0,
+    acct_terminate_cause VARCHAR(64),
+    acct_delay_time      BIGINT       NOT NULL DEFAULT 0,
+    event_timestamp      BIGINT       NOT NULL,
+    created_at           BIGINT       NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_radius_accounting_acct_session_id ON radius_accounting (acct_session_id);
+CREATE INDEX IF NOT EXISTS idx_radius_accounting_username ON radius_accounting (username);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS radius_sessions (
+    id                 BIGSERIAL PRIMARY KEY,
+    acct_session_id    VARCHAR(128) NOT NULL,
+    nas_ip_address     INET         NOT NULL,
+    username           VARCHAR(253),
+    subscriber_id      VARCHAR(64),
+    nas_port_id        VARCHAR(253),
+    framed_ip_address  INET,
+    calling_station_id VARCHAR(253),
+    called_station_id  VARCHAR(253),
+    session_time       BIGINT       NOT NULL DEFAULT 0,
+    input_octets       BIGINT       NOT NULL DEFAULT 0,
+    output_octets      BIGINT       NOT NULL DEFAULT 0,
+    input_packets      BIGINT       NOT NULL DEFAULT 0,
+    output_packets     BIGINT       NOT NULL DEFAULT 0,
+    terminate_cause    VARCHAR(64),
+    is_online          BOOLEAN      NOT NULL,
+    started_at         BIGINT       NOT NULL,
+    last_updated_at    BIGINT       NOT NULL,
+    stopped_at         BIGINT,
+    created_at         BIGINT       NOT NULL DEFAULT 0,
+    updated_at         BIGINT       NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_radius_sessions_session_nas ON radius_sessions (acct_session_id, nas_ip_address);
+CREATE INDEX IF NOT EXISTS idx_radius_sessions_username ON radius_sessions (username);
+CREATE INDEX IF NOT EXISTS idx_radius_sessions_is_online ON radius_sessions (is_online);
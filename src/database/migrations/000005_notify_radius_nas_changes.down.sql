@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS radius_nas_notify_change ON radius_nas;
+DROP FUNCTION IF EXISTS radius_nas_notify_change();
@@ -0,0 +1,15 @@
+CREATE OR REPLACE FUNCTION radius_nas_notify_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('radius_nas_changed', host(OLD.ip_address));
+        RETURN OLD;
+    END IF;
+    PERFORM pg_notify('radius_nas_changed', host(NEW.ip_address));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS radius_nas_notify_change ON radius_nas;
+CREATE TRIGGER radius_nas_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON radius_nas
+    FOR EACH ROW EXECUTE FUNCTION radius_nas_notify_change();
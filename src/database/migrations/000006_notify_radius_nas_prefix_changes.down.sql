@@ -0,0 +1,10 @@
+CREATE OR REPLACE FUNCTION radius_nas_notify_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('radius_nas_changed', host(OLD.ip_address));
+        RETURN OLD;
+    END IF;
+    PERFORM pg_notify('radius_nas_changed', host(NEW.ip_address));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,15 @@
+-- Send the prefix (abbrev keeps the mask for subnets) so listeners can drop
+-- subnet entries, not only single addresses
+CREATE OR REPLACE FUNCTION radius_nas_notify_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('radius_nas_changed', abbrev(OLD.ip_address));
+        RETURN OLD;
+    END IF;
+    IF TG_OP = 'UPDATE' AND OLD.ip_address IS DISTINCT FROM NEW.ip_address THEN
+        PERFORM pg_notify('radius_nas_changed', abbrev(OLD.ip_address));
+    END IF;
+    PERFORM pg_notify('radius_nas_changed', abbrev(NEW.ip_address));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,2 @@
+ALTER TABLE radius_nas DROP CONSTRAINT IF EXISTS chk_radius_nas_message_authenticator_policy;
+ALTER TABLE radius_nas DROP COLUMN IF EXISTS message_authenticator_policy;
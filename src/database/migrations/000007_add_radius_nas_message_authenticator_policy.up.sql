@@ -0,0 +1,6 @@
+ALTER TABLE radius_nas
+    ADD COLUMN IF NOT EXISTS message_authenticator_policy VARCHAR(32) NOT NULL DEFAULT 'require-if-present';
+
+ALTER TABLE radius_nas
+    ADD CONSTRAINT chk_radius_nas_message_authenticator_policy
+        CHECK (message_authenticator_policy IN ('require', 'require-if-present', 'off'));
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_radius_nas_tls_identity;
+
+ALTER TABLE radius_nas
+    DROP COLUMN IF EXISTS tls_identity;
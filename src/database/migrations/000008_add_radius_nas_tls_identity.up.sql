@@ -0,0 +1,5 @@
+-- Identity (certificate SAN or subject CN) of NAS connecting over RadSec
+ALTER TABLE radius_nas
+    ADD COLUMN IF NOT EXISTS tls_identity VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_radius_nas_tls_identity ON radius_nas (tls_identity);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS radius_user_groups;
+DROP TABLE IF EXISTS radius_group_reply;
+DROP TABLE IF EXISTS radius_group_check;
+DROP TABLE IF EXISTS radius_reply;
+DROP TABLE IF EXISTS radius_check;
@@ -0,0 +1,68 @@
+-- Check and reply items in the layout of the FreeRADIUS SQL schema (radcheck,
+-- radreply, radgroupcheck, radgroupreply, radusergroup)
+CREATE TABLE IF NOT EXISTS radius_check (
+    id         BIGSERIAL PRIMARY KEY,
+    username   VARCHAR(253) NOT NULL,
+    attribute  VARCHAR(64)  NOT NULL,
+    op         VARCHAR(2)   NOT NULL DEFAULT '==',
+    value      VARCHAR(253) NOT NULL,
+    created_at BIGINT       NOT NULL DEFAULT 0,
+    updated_at BIGINT       NOT NULL DEFAULT 0,
+    CONSTRAINT chk_radius_check_op
+        CHECK (op IN ('=', ':=', '+=', '==', '!=', '>', '>=', '<', '<=', '=~', '!~', '=*', '!*'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_radius_check_username ON radius_check (username);
+
+CREATE TABLE IF NOT EXISTS radius_reply (
+    id         BIGSERIAL PRIMARY KEY,
+    username   VARCHAR(253) NOT NULL,
+    attribute  VARCHAR(64)  NOT NULL,
+    op         VARCHAR(2)   NOT NULL DEFAULT '=',
+    value      VARCHAR(253) NOT NULL,
+    created_at BIGINT       NOT NULL DEFAULT 0,
+    updated_at BIGINT       NOT NULL DEFAULT 0,
+    CONSTRAINT chk_radius_reply_op
+        CHECK (op IN ('=', ':=', '+='))
+);
+
+CREATE INDEX IF NOT EXISTS idx_radius_reply_username ON radius_reply (username);
+
+CREATE TABLE IF NOT EXISTS radius_group_check (
+    id         BIGSERIAL PRIMARY KEY,
+    groupname  VARCHAR(64)  NOT NULL,
+    attribute  VARCHAR(64)  NOT NULL,
+    op         VARCHAR(2)   NOT NULL DEFAULT '==',
+    value      VARCHAR(253) NOT NULL,
+    created_at BIGINT       NOT NULL DEFAULT 0,
+    updated_at BIGINT       NOT NULL DEFAULT 0,
+    CONSTRAINT chk_radius_group_check_op
+        CHECK (op IN ('=', ':=', '+=', '==', '!=', '>', '>=', '<', '<=', '=~', '!~', '=*', '!*'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_radius_group_check_groupname ON radius_group_check (groupname);
+
+CREATE TABLE IF NOT EXISTS radius_group_reply (
+    id         BIGSERIAL PRIMARY KEY,
+    groupname  VARCHAR(64)  NOT NULL,
+    attribute  VARCHAR(64)  NOT NULL,
+    op         VARCHAR(2)   NOT NULL DEFAULT '=',
+    value      VARCHAR(253) NOT NULL,
+    created_at BIGINT       NOT NULL DEFAULT 0,
+    updated_at BIGINT       NOT NULL DEFAULT 0,
+    CONSTRAINT chk_radius_group_reply_op
+        CHECK (op IN ('=', ':=', '+='))
+);
+
+CREATE INDEX IF NOT EXISTS idx_radius_group_reply_groupname ON radius_group_reply (groupname);
+
+CREATE TABLE IF NOT EXISTS radius_user_groups (
+    id         BIGSERIAL PRIMARY KEY,
+    username   VARCHAR(253) NOT NULL,
+    groupname  VARCHAR(64)  NOT NULL,
+    priority   INTEGER      NOT NULL DEFAULT 1,
+    created_at BIGINT       NOT NULL DEFAULT 0,
+    updated_at BIGINT       NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_radius_user_groups_username_groupname ON radius_user_groups (username, groupname);
@@ -0,0 +1,2 @@
+ALTER TABLE radius_nas
+    ALTER COLUMN message_authenticator_policy SET DEFAULT 'require-if-present';
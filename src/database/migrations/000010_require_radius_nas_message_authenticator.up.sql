@@ -0,0 +1,3 @@
+-- New NAS require Message-Authenticator, existing ones keep their policy
+ALTER TABLE radius_nas
+    ALTER COLUMN message_authenticator_policy SET DEFAULT 'require';
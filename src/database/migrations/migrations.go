@@ -0,0 +1,9 @@
+package migrations
+
+import "embed"
+
+// Files holds the SQL migrations in golang-migrate format
+// (<version>_<name>.up.sql / <version>_<name>.down.sql).
+//
+//go:embed *.sql
+var Files embed.FS
@@ -5,6 +5,7 @@ import (
 	"radius-server/src/database/entities"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PreloadOption struct {
@@ -16,6 +17,38 @@ func radiusNasTableName() string {
 	return entities.RadiusNas{}.TableName()
 }
 
+func radiusUserTableName() string {
+	return entities.RadiusUser{}.TableName()
+}
+
+func radiusAccountingTableName() string {
+	return entities.RadiusAccounting{}.TableName()
+}
+
+func radiusSessionTableName() string {
+	return entities.RadiusSession{}.TableName()
+}
+
+func radiusCheckTableName() string {
+	return entities.RadiusCheck{}.TableName()
+}
+
+func radiusReplyTableName() string {
+	return entities.RadiusReply{}.TableName()
+}
+
+func radiusGroupCheckTableName() string {
+	return entities.RadiusGroupCheck{}.TableName()
+}
+
+func radiusGroupReplyTableName() string {
+	return entities.RadiusGroupReply{}.TableName()
+}
+
+func radiusUserGroupTableName() string {
+	return entities.RadiusUserGroup{}.TableName()
+}
+
 func getDb(tx *gorm.DB) *gorm.DB {
 	var db *gorm.DB
 	if tx != nil {
@@ -36,9 +69,14 @@ func HealthCheck() bool {
 	return err == nil
 }
 
+// GetNasByIp returns the NAS whose address or prefix contains ip, preferring
+// the most specific (longest) prefix.
 func GetNasByIp(ip string) (*entities.RadiusNas, error) {
 	nas := &entities.RadiusNas{}
-	result := DbConn.Table(radiusNasTableName()).Where("ip_address=?", ip).First(&nas)
+	result := DbConn.Table(radiusNasTableName()).
+		Where("ip_address >>= ?::inet", ip).
+		Order("masklen(ip_address) DESC").
+		First(&nas)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -48,3 +86,259 @@ func GetNasByIp(ip string) (*entities.RadiusNas, error) {
 
 	return nas, nil
 }
+
+// GetNasByAddress returns the NAS registered with exactly the given address
+// or prefix.
+func GetNasByAddress(address string) (*entities.RadiusNas, error) {
+	nas := &entities.RadiusNas{}
+	result := DbConn.Table(radiusNasTableName()).Where("ip_address=?::inet", address).First(&nas)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+
+	return nas, nil
+}
+
+// GetNasByTlsIdentities returns the NAS whose tls_identity matches one of the
+// given certificate identities, trying them in order.
+func GetNasByTlsIdentities(identities []string) (*entities.RadiusNas, error) {
+	nasList := []entities.RadiusNas{}
+	result := DbConn.Table(radiusNasTableName()).Where("tls_identity IN ?", identities).Find(&nasList)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for _, identity := range identities {
+		for _, nas := range nasList {
+			if *nas.TlsIdentity == identity {
+				return &nas, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func GetUserByUsername(username string) (*entities.RadiusUser, error) {
+	user := &entities.RadiusUser{}
+	result := DbConn.Table(radiusUserTableName()).Where("username=?", username).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+
+	return user, nil
+}
+
+// GetUserCheckItems returns the check items of a user in insertion order.
+func GetUserCheckItems(username string) ([]entities.RadiusCheck, error) {
+	items := []entities.RadiusCheck{}
+	result := DbConn.Table(radiusCheckTableName()).Where("username=?", username).Order("id").Find(&items)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return items, nil
+}
+
+// GetUserReplyItems returns the reply items of a user in insertion order.
+func GetUserReplyItems(username string) ([]entities.RadiusReply, error) {
+	items := []entities.RadiusReply{}
+	result := DbConn.Table(radiusReplyTableName()).Where("username=?", username).Order("id").Find(&items)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return items, nil
+}
+
+// GetUserGroups returns the groups of a user by ascending priority.
+func GetUserGroups(username string) ([]entities.RadiusUserGroup, error) {
+	groups := []entities.RadiusUserGroup{}
+	result := DbConn.Table(radiusUserGroupTableName()).Where("username=?", username).Order("priority, id").Find(&groups)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return groups, nil
+}
+
+// GetGroupCheckItems returns the check items of a group in insertion order.
+func GetGroupCheckItems(groupName string) ([]entities.RadiusGroupCheck, error) {
+	items := []entities.RadiusGroupCheck{}
+	result := DbConn.Table(radiusGroupCheckTableName()).Where("groupname=?", groupName).Order("id").Find(&items)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return items, nil
+}
+
+// GetGroupReplyItems returns the reply items of a group in insertion order.
+func GetGroupReplyItems(groupName string) ([]entities.RadiusGroupReply, error) {
+	items := []entities.RadiusGroupReply{}
+	result := DbConn.Table(radiusGroupReplyTableName()).Where("groupname=?", groupName).Order("id").Find(&items)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return items, nil
+}
+
+func CreateAccounting(tx *gorm.DB, record *entities.RadiusAccounting) error {
+	return getDb(tx).Table(radiusAccountingTableName()).Create(record).Error
+}
+
+var radiusSessionConflictColumns = []clause.Column{{Name: "acct_session_id"}, {Name: "nas_ip_address"}}
+
+func coalesceExcluded(column string) clause.Expr {
+	return gorm.Expr("COALESCE(EXCLUDED." + column + ", " + radiusSessionTableName() + "." + column + ")")
+}
+
+// OpenSession creates the session on Accounting-Start. A retransmitted Start
+// for a known session only refreshes its addressing data.
+func OpenSession(tx *gorm.DB, session *entities.RadiusSession) error {
+	return getDb(tx).Table(radiusSessionTableName()).Clauses(clause.OnConflict{
+		Columns: radiusSessionConflictColumns,
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"framed_ip_address": coalesceExcluded("framed_ip_address"),
+			"last_updated_at":   gorm.Expr("EXCLUDED.last_updated_at"),
+			"updated_at":        gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).Create(session).Error
+}
+
+// UpdateSession applies Interim-Update counters, creating the session when the
+// Start record was lost.
+func UpdateSession(tx *gorm.DB, session *entities.RadiusSession) error {
+	return getDb(tx).Table(radiusSessionTableName()).Clauses(clause.OnConflict{
+		Columns: radiusSessionConflictColumns,
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"framed_ip_address": coalesceExcluded("framed_ip_address"),
+			"session_time":      gorm.Expr("EXCLUDED.session_time"),
+			"input_octets":      gorm.Expr("EXCLUDED.input_octets"),
+			"output_octets":     gorm.Expr("EXCLUDED.output_octets"),
+			"input_packets":     gorm.Expr("EXCLUDED.input_packets"),
+			"output_packets":    gorm.Expr("EXCLUDED.output_packets"),
+			"last_updated_at":   gorm.Expr("EXCLUDED.last_updated_at"),
+			"updated_at":        gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).Create(session).Error
+}
+
+// CloseSession marks the session offline on Accounting-Stop, creating it when
+// neither Start nor Interim-Update were received.
+func CloseSession(tx *gorm.DB, session *entities.RadiusSession) error {
+	return getDb(tx).Table(radiusSessionTableName()).Clauses(clause.OnConflict{
+		Columns: radiusSessionConflictColumns,
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"framed_ip_address": coalesceExcluded("framed_ip_address"),
+			"session_time":      gorm.Expr("EXCLUDED.session_time"),
+			"input_octets":      gorm.Expr("EXCLUDED.input_octets"),
+			"output_octets":     gorm.Expr("EXCLUDED.output_octets"),
+			"input_packets":     gorm.Expr("EXCLUDED.input_packets"),
+			"output_packets":    gorm.Expr("EXCLUDED.output_packets"),
+			"terminate_cause":   gorm.Expr("EXCLUDED.terminate_cause"),
+			"is_online":         false,
+			"stopped_at":        gorm.Expr("EXCLUDED.stopped_at"),
+			"last_updated_at":   gorm.Expr("EXCLUDED.last_updated_at"),
+			"updated_at":        gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).Create(session).Error
+}
+
+// CloseNasSessions marks every online session of a NAS offline, used when the
+// NAS reports Accounting-On/Off after a reboot.
+func CloseNasSessions(tx *gorm.DB, nasIpAddress string, terminateCause string, stoppedAt int64) error {
+	return getDb(tx).Table(radiusSessionTableName()).
+		Where("nas_ip_address=? AND is_online=?", nasIpAddress, true).
+		Updates(map[string]interface{}{
+			"is_online":       false,
+			"terminate_cause": terminateCause,
+			"stopped_at":      stoppedAt,
+			"last_updated_at": stoppedAt,
+		}).Error
+}
+
+func GetOnlineSessions(offset int, limit int) ([]entities.RadiusSession, error) {
+	sessions := []entities.RadiusSession{}
+	result := DbConn.Table(radiusSessionTableName()).
+		Where("is_online=?", true).
+		Order("id").
+		Offset(offset).
+		Limit(limit).
+		Find(&sessions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return sessions, nil
+}
+
+func GetSessionById(id int64) (*entities.RadiusSession, error) {
+	session := &entities.RadiusSession{}
+	result := DbConn.Table(radiusSessionTableName()).Where("id=?", id).First(&session)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+
+	return session, nil
+}
+
+func GetNasList(offset int, limit int) ([]entities.RadiusNas, int64, error) {
+	nasList := []entities.RadiusNas{}
+	var total int64
+	if err := DbConn.Table(radiusNasTableName()).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	result := DbConn.Table(radiusNasTableName()).Order("id").Offset(offset).Limit(limit).Find(&nasList)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return nasList, total, nil
+}
+
+func GetNasById(id int64) (*entities.RadiusNas, error) {
+	nas := &entities.RadiusNas{}
+	result := DbConn.Table(radiusNasTableName()).Where("id=?", id).First(&nas)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+
+	return nas, nil
+}
+
+func CreateNas(tx *gorm.DB, nas *entities.RadiusNas) error {
+	return getDb(tx).Table(radiusNasTableName()).Create(nas).Error
+}
+
+func UpdateNas(tx *gorm.DB, nas *entities.RadiusNas) error {
+	return getDb(tx).Table(radiusNasTableName()).Where("id=?", nas.Id).
+		Select("nas_name", "ip_address", "secret", "message_authenticator_policy", "tls_identity", "updated_at").
+		Updates(nas).Error
+}
+
+func DeleteNas(tx *gorm.DB, id int64) error {
+	return getDb(tx).Table(radiusNasTableName()).Where("id=?", id).Delete(&entities.RadiusNas{}).Error
+}
+
+func GetAllNas() ([]entities.RadiusNas, error) {
+	nasList := []entities.RadiusNas{}
+	result := DbConn.Table(radiusNasTableName()).Find(&nasList)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return nasList, nil
+}
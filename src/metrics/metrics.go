@@ -4,6 +4,7 @@ import (
 	"fmt"
 	cryptoUtil "radius-server/src/utils/crypto"
 	"sync"
+	"time"
 )
 
 type RadiusRequestTypes string
@@ -22,6 +23,22 @@ type RadiusResponseStatus string
 var (
 	Success RadiusResponseStatus = "Success"
 	Failure RadiusResponseStatus = "Failure"
+	// Challenge is an Access-Challenge of an EAP conversation
+	Challenge RadiusResponseStatus = "Challenge"
+)
+
+type DropReason string
+
+var (
+	MessageAuthenticatorMissing DropReason = "Message-Authenticator-Missing"
+	MessageAuthenticatorInvalid DropReason = "Message-Authenticator-Invalid"
+)
+
+type DuplicateAction string
+
+var (
+	DuplicateReplayed  DuplicateAction = "Replayed"
+	DuplicateDiscarded DuplicateAction = "Discarded"
 )
 
 type Metric struct {
@@ -50,8 +67,30 @@ var (
 	MinResponseTime      map[string]Metric = map[string]Metric{}
 	TotalCountOfRequests map[string]Metric = map[string]Metric{}
 )
+var (
+	DroppedPackets    map[DropReason]int64      = map[DropReason]int64{}
+	DuplicateRequests map[DuplicateAction]int64 = map[DuplicateAction]int64{}
+)
+
+var StartTime = time.Now()
+
 var mu sync.RWMutex
 
+// CreateDroppedPacketMetric counts a request discarded before it reached a handler.
+func CreateDroppedPacketMetric(reason DropReason) {
+	mu.Lock()
+	defer mu.Unlock()
+	DroppedPackets[reason]++
+}
+
+// CreateDuplicateRequestMetric counts a retransmitted request answered from
+// the response cache or discarded while the original was still in progress.
+func CreateDuplicateRequestMetric(action DuplicateAction) {
+	mu.Lock()
+	defer mu.Unlock()
+	DuplicateRequests[action]++
+}
+
 func CreateRequestMetric(requestType RadiusRequestTypes, status RadiusResponseStatus, responseTime float64) error {
 	key := cryptoUtil.HashString(string(requestType), string(status))
 
@@ -124,6 +163,15 @@ func CreateRequestMetric(requestType RadiusRequestTypes, status RadiusResponseSt
 	return nil
 }
 
+// GetRequestCount returns how many requests of the type finished with status.
+func GetRequestCount(requestType RadiusRequestTypes, status RadiusResponseStatus) int64 {
+	key := cryptoUtil.HashString(string(requestType), string(status))
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return AvgResponseTimes[key].TotalCount
+}
+
 func GetMetricsPromtheusFormatted() []string {
 	response := []string{}
 	mu.RLock()
@@ -160,5 +208,21 @@ func GetMetricsPromtheusFormatted() []string {
 		response = append(response, txt)
 	}
 
+	// dropped packets
+	response = append(response, "# HELP radius_dropped_packets_total is total number of discarded requests by reason\n")
+	response = append(response, "# TYPE radius_dropped_packets_total counter\n")
+	for reason, count := range DroppedPackets {
+		txt := fmt.Sprintf("radius_dropped_packets_total{reason=\"%s\"} %d\n", reason, count)
+		response = append(response, txt)
+	}
+
+	// duplicate requests
+	response = append(response, "# HELP radius_duplicate_requests_total is total number of retransmitted requests detected by the response cache\n")
+	response = append(response, "# TYPE radius_duplicate_requests_total counter\n")
+	for action, count := range DuplicateRequests {
+		txt := fmt.Sprintf("radius_duplicate_requests_total{action=\"%s\"} %d\n", action, count)
+		response = append(response, txt)
+	}
+
 	return response
 }
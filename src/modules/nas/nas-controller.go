@@ -0,0 +1,234 @@
+package nasModule
+
+import (
+	"radius-server/src/cache"
+	"radius-server/src/common/logger"
+	"radius-server/src/database"
+	"radius-server/src/database/entities"
+	arrayUtil "radius-server/src/utils/array"
+	networkUtil "radius-server/src/utils/network"
+	numberUtil "radius-server/src/utils/number"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageLimit     = 20
+	maxPageLimit         = 100
+	minSecretLength      = 8
+	maxSecretLength      = 64
+	maxNasNameLength     = 128
+	maxTlsIdentityLength = 255
+)
+
+type NasRequest struct {
+	NasName                    *string                             `json:"nas_name"`
+	IpAddress                  string                              `json:"ip_address"`
+	Secret                     string                              `json:"secret"`
+	MessageAuthenticatorPolicy entities.MessageAuthenticatorPolicy `json:"message_authenticator_policy"`
+	TlsIdentity                *string                             `json:"tls_identity"`
+}
+
+var messageAuthenticatorPolicies = []entities.MessageAuthenticatorPolicy{
+	entities.MessageAuthenticatorRequire,
+	entities.MessageAuthenticatorRequireIfPresent,
+	entities.MessageAuthenticatorOff,
+}
+
+type NasListResponse struct {
+	Items []entities.RadiusNas `json:"items"`
+	Total int64                `json:"total"`
+	Page  int                  `json:"page"`
+	Limit int                  `json:"limit"`
+}
+
+func GetNasList(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", defaultPageLimit)
+	if page < 1 || limit < 1 || limit > maxPageLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "Invalid paging parameters"})
+	}
+
+	nasList, total, err := database.GetNasList((page-1)*limit, limit)
+	if err != nil {
+		logger.Logger.Error().Msgf("Get NAS list error. %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]string{"message": "Get NAS list error"})
+	}
+	return c.Status(fiber.StatusOK).JSON(NasListResponse{
+		Items: nasList,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+	})
+}
+
+func GetNas(c *fiber.Ctx) error {
+	nas, err := getNas(c)
+	if err != nil || nas == nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(nas)
+}
+
+func CreateNas(c *fiber.Ctx) error {
+	request, err := parseRequest(c, true)
+	if err != nil || request == nil {
+		return err
+	}
+
+	if exists, err := nasIpExists(request.IpAddress, 0); err != nil {
+		logger.Logger.Error().Msgf("Get NAS error. %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]string{"message": "Create NAS error"})
+	} else if exists {
+		return c.Status(fiber.StatusConflict).JSON(map[string]string{"message": "NAS with this ip address or prefix already exists"})
+	}
+	if exists, err := nasTlsIdentityExists(request.TlsIdentity, 0); err != nil {
+		logger.Logger.Error().Msgf("Get NAS error. %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]string{"message": "Create NAS error"})
+	} else if exists {
+		return c.Status(fiber.StatusConflict).JSON(map[string]string{"message": "NAS with this tls identity already exists"})
+	}
+
+	nas := &entities.RadiusNas{
+		NasName:                    request.NasName,
+		IpAddress:                  request.IpAddress,
+		Secret:                     request.Secret,
+		MessageAuthenticatorPolicy: request.MessageAuthenticatorPolicy,
+		TlsIdentity:                request.TlsIdentity,
+	}
+	if nas.MessageAuthenticatorPolicy == "" {
+		nas.MessageAuthenticatorPolicy = entities.MessageAuthenticatorRequire
+	}
+	if err := database.CreateNas(nil, nas); err != nil {
+		logger.Logger.Error().Msgf("Create NAS error. %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]string{"message": "Create NAS error"})
+	}
+	cache.InvalidateNas(nas.IpAddress)
+	return c.Status(fiber.StatusCreated).JSON(nas)
+}
+
+func UpdateNas(c *fiber.Ctx) error {
+	nas, err := getNas(c)
+	if err != nil || nas == nil {
+		return err
+	}
+	request, err := parseRequest(c, false)
+	if err != nil || request == nil {
+		return err
+	}
+
+	if exists, err := nasIpExists(request.IpAddress, nas.Id); err != nil {
+		logger.Logger.Error().Msgf("Get NAS error. %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]string{"message": "Update NAS error"})
+	} else if exists {
+		return c.Status(fiber.StatusConflict).JSON(map[string]string{"message": "NAS with this ip address or prefix already exists"})
+	}
+	if exists, err := nasTlsIdentityExists(request.TlsIdentity, nas.Id); err != nil {
+		logger.Logger.Error().Msgf("Get NAS error. %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]string{"message": "Update NAS error"})
+	} else if exists {
+		return c.Status(fiber.StatusConflict).JSON(map[string]string{"message": "NAS with this tls identity already exists"})
+	}
+
+	previousIpAddress := nas.IpAddress
+	nas.NasName = request.NasName
+	nas.IpAddress = request.IpAddress
+	nas.TlsIdentity = request.TlsIdentity
+	if request.Secret != "" {
+		nas.Secret = request.Secret
+	}
+	if request.MessageAuthenticatorPolicy != "" {
+		nas.MessageAuthenticatorPolicy = request.MessageAuthenticatorPolicy
+	}
+	if err := database.UpdateNas(nil, nas); err != nil {
+		logger.Logger.Error().Int64("nas_id", nas.Id).Msgf("Update NAS error. %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]string{"message": "Update NAS error"})
+	}
+	cache.InvalidateNas(previousIpAddress, nas.IpAddress)
+	return c.Status(fiber.StatusOK).JSON(nas)
+}
+
+func DeleteNas(c *fiber.Ctx) error {
+	nas, err := getNas(c)
+	if err != nil || nas == nil {
+		return err
+	}
+	if err := database.DeleteNas(nil, nas.Id); err != nil {
+		logger.Logger.Error().Int64("nas_id", nas.Id).Msgf("Delete NAS error. %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]string{"message": "Delete NAS error"})
+	}
+	cache.InvalidateNas(nas.IpAddress)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// getNas resolves the :id route param. A nil NAS with a nil error means the
+// response has already been written.
+func getNas(c *fiber.Ctx) (*entities.RadiusNas, error) {
+	id, err := numberUtil.StringToInt64(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "Invalid NAS id"})
+	}
+
+	nas, err := database.GetNasById(id)
+	if err != nil {
+		logger.Logger.Error().Int64("nas_id", id).Msgf("Get NAS error. %s", err.Error())
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(map[string]string{"message": "Get NAS error"})
+	}
+	if nas == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(map[string]string{"message": "NAS not found"})
+	}
+	return nas, nil
+}
+
+// parseRequest parses and validates the request body. The secret is optional
+// on update, where an empty secret keeps the stored one.
+func parseRequest(c *fiber.Ctx, secretRequired bool) (*NasRequest, error) {
+	request := &NasRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "Invalid request body"})
+	}
+
+	prefix, err := networkUtil.ParsePrefix(request.IpAddress)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "ip_address must be a valid IPv4 or IPv6 address or CIDR prefix"})
+	}
+	request.IpAddress = networkUtil.FormatPrefix(prefix)
+
+	if request.Secret != "" || secretRequired {
+		if len(request.Secret) < minSecretLength || len(request.Secret) > maxSecretLength {
+			return nil, c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "secret must be between 8 and 64 characters"})
+		}
+	}
+	if request.MessageAuthenticatorPolicy != "" && !arrayUtil.ItemExists(messageAuthenticatorPolicies, request.MessageAuthenticatorPolicy) {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "message_authenticator_policy must be one of require, require-if-present, off"})
+	}
+	if request.NasName != nil && len(*request.NasName) > maxNasNameLength {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "nas_name must be at most 128 characters"})
+	}
+	if request.TlsIdentity != nil && *request.TlsIdentity == "" {
+		request.TlsIdentity = nil
+	}
+	if request.TlsIdentity != nil && len(*request.TlsIdentity) > maxTlsIdentityLength {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "tls_identity must be at most 255 characters"})
+	}
+	return request, nil
+}
+
+func nasIpExists(ip string, excludeId int64) (bool, error) {
+	nas, err := database.GetNasByAddress(ip)
+	if err != nil {
+		return false, err
+	}
+	return nas != nil && nas.Id != excludeId, nil
+}
+
+func nasTlsIdentityExists(identity *string, excludeId int64) (bool, error) {
+	if identity == nil {
+		return false, nil
+	}
+	nas, err := database.GetNasByTlsIdentities([]string{*identity})
+	if err != nil {
+		return false, err
+	}
+	return nas != nil && nas.Id != excludeId, nil
+}
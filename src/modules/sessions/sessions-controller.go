@@ -0,0 +1,78 @@
+package sessionsModule
+
+import (
+	"errors"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/database"
+	"radius-server/src/database/entities"
+	"radius-server/src/radius/dynauth"
+	numberUtil "radius-server/src/utils/number"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func Disconnect(c *fiber.Ctx) error {
+	session, err := getSession(c)
+	if err != nil || session == nil {
+		return err
+	}
+
+	result, err := dynauth.Disconnect(c.Context(), session)
+	return sendResult(c, session, result, err)
+}
+
+func ChangeOfAuthorization(c *fiber.Ctx) error {
+	session, err := getSession(c)
+	if err != nil || session == nil {
+		return err
+	}
+
+	attributes := dynauth.CoaAttributes{}
+	if err := c.BodyParser(&attributes); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "Invalid request body"})
+	}
+	if attributes.IsEmpty() {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "At least one attribute is required"})
+	}
+
+	result, err := dynauth.ChangeOfAuthorization(c.Context(), session, attributes)
+	return sendResult(c, session, result, err)
+}
+
+// getSession resolves the :id route param. A nil session with a nil error
+// means the response has already been written.
+func getSession(c *fiber.Ctx) (*entities.RadiusSession, error) {
+	id, err := numberUtil.StringToInt64(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(map[string]string{"message": "Invalid session id"})
+	}
+
+	session, err := database.GetSessionById(id)
+	if err != nil {
+		logger.Logger.Error().Int64("session_id", id).Msgf("Get session error. %s", err.Error())
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(map[string]string{"message": "Get session error"})
+	}
+	if session == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(map[string]string{"message": "Session not found"})
+	}
+	return session, nil
+}
+
+func sendResult(c *fiber.Ctx, session *entities.RadiusSession, result *dynauth.Result, err error) error {
+	if err != nil {
+		logger.Logger.Error().Int64("session_id", session.Id).Msgf("Dynamic authorization request error. %s", err.Error())
+		switch {
+		case errors.Is(err, dynauth.ErrNasNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(map[string]string{"message": err.Error()})
+		case errors.Is(err, dynauth.ErrNoResponse):
+			return c.Status(fiber.StatusGatewayTimeout).JSON(map[string]string{"message": err.Error()})
+		default:
+			return c.Status(fiber.StatusBadGateway).JSON(map[string]string{"message": err.Error()})
+		}
+	}
+	if !result.Acknowledged {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(result)
+	}
+	return c.Status(fiber.StatusOK).JSON(result)
+}
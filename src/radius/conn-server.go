@@ -0,0 +1,197 @@
+package radius
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/database/entities"
+	"radius-server/src/radius/handlers"
+
+	"layeh.com/radius"
+)
+
+// RADIUS over connection oriented transports: TLS streams (RFC 6613, RFC
+// 6614), where packets are framed by their own Length field, and DTLS
+// associations (RFC 7360), where every record carries one packet. Requests of
+// one connection are handled concurrently and their responses may be written
+// in any order.
+
+const (
+	connAcceptRetryDelay = 50 * time.Millisecond
+	connWriteTimeout     = 10 * time.Second
+)
+
+var errMalformedPacket = errors.New("malformed packet")
+
+// connAuthenticator identifies the NAS of a new connection and returns the
+// secret its packets are protected with.
+type connAuthenticator func(conn net.Conn) (*entities.RadiusNas, []byte, error)
+
+type connServer struct {
+	name         string
+	handler      radius.Handler
+	authenticate connAuthenticator
+	idleTimeout  time.Duration
+	// datagram reads one packet per Read instead of framing a byte stream
+	datagram bool
+}
+
+func (s *connServer) Serve(l net.Listener) error {
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(connAcceptRetryDelay)
+				continue
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *connServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	remote := conn.RemoteAddr().String()
+
+	nas, secret, err := s.authenticate(conn)
+	if err != nil {
+		logger.Logger.Warn().Str("remote", remote).Msgf("%s connection rejected. %s", s.name, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithCancel(handlers.ContextWithNas(context.Background(), nas))
+	defer cancel()
+
+	var inFlight sync.WaitGroup
+	defer inFlight.Wait()
+
+	writer := &connResponseWriter{conn: conn}
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(s.idleTimeout)); err != nil {
+			return
+		}
+		raw, err := s.readPacket(conn)
+		if err != nil {
+			if errors.Is(err, errMalformedPacket) && s.datagram {
+				logger.Logger.Warn().Str("remote", remote).Msgf("%s packet dropped. %s", s.name, err.Error())
+				continue
+			}
+			// A malformed packet leaves a stream out of sync, so the
+			// connection is closed (RFC 6613 section 2.6.1)
+			if errors.Is(err, errMalformedPacket) {
+				logger.Logger.Warn().Str("remote", remote).Msgf("%s connection closed. %s", s.name, err.Error())
+			} else if !errors.Is(err, io.EOF) {
+				logger.Logger.Debug().Str("remote", remote).Msgf("%s connection closed. %s", s.name, err.Error())
+			}
+			return
+		}
+
+		if !radius.IsAuthenticRequest(raw, secret) {
+			logger.Logger.Warn().Str("remote", remote).Msgf("%s packet dropped. Invalid request authenticator", s.name)
+			continue
+		}
+		packet, err := radius.Parse(raw, secret)
+		if err != nil {
+			if s.datagram {
+				logger.Logger.Warn().Str("remote", remote).Msgf("%s packet dropped. Invalid packet. %s", s.name, err.Error())
+				continue
+			}
+			logger.Logger.Warn().Str("remote", remote).Msgf("%s connection closed. Invalid packet. %s", s.name, err.Error())
+			return
+		}
+
+		request := (&radius.Request{
+			LocalAddr:  conn.LocalAddr(),
+			RemoteAddr: conn.RemoteAddr(),
+			Packet:     packet,
+		}).WithContext(ctx)
+
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			s.handler.ServeRADIUS(writer, request)
+		}()
+	}
+}
+
+// readPacket returns the next packet of conn. Errors wrapping
+// errMalformedPacket are returned for packets with an invalid length.
+func (s *connServer) readPacket(conn net.Conn) ([]byte, error) {
+	if s.datagram {
+		buffer := make([]byte, radius.MaxPacketLength)
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+		if n < 20 {
+			return nil, fmt.Errorf("%w: length %d", errMalformedPacket, n)
+		}
+		// Bytes beyond the Length field are padding (RFC 2865 section 3)
+		length := int(binary.BigEndian.Uint16(buffer[2:4]))
+		if length < 20 || length > n {
+			return nil, fmt.Errorf("%w: length %d", errMalformedPacket, length)
+		}
+		return buffer[:length], nil
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if length < 20 || length > radius.MaxPacketLength {
+		return nil, fmt.Errorf("%w: length %d", errMalformedPacket, length)
+	}
+	raw := make([]byte, length)
+	copy(raw, header)
+	if _, err := io.ReadFull(conn, raw[len(header):]); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+type connResponseWriter struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (w *connResponseWriter) Write(p *radius.Packet) error {
+	encoded, err := p.Encode()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.conn.SetWriteDeadline(time.Now().Add(connWriteTimeout)); err != nil {
+		return err
+	}
+	_, err = w.conn.Write(encoded)
+	return err
+}
+
+// connHandler serves access and accounting requests on one port, as RadSec
+// transports do not split them by port. Status-Server is answered by the
+// access chain.
+func connHandler(accessHandler radius.Handler, accountingHandler radius.Handler) radius.Handler {
+	return radius.HandlerFunc(func(w radius.ResponseWriter, r *radius.Request) {
+		switch r.Code {
+		case radius.CodeAccessRequest, radius.CodeStatusServer:
+			accessHandler.ServeRADIUS(w, r)
+		case radius.CodeAccountingRequest:
+			accountingHandler.ServeRADIUS(w, r)
+		default:
+			logger.Logger.Warn().Str("remote", r.RemoteAddr.String()).Msgf("Packet dropped. Unsupported code %s", r.Code.String())
+		}
+	})
+}
@@ -0,0 +1,240 @@
+package dictionary
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Attribute registry built from FreeRADIUS format dictionaries. Attributes and
+// vendors are looked up case-insensitively by name, as FreeRADIUS does.
+
+type DataType string
+
+const (
+	TypeString     DataType = "string"
+	TypeOctets     DataType = "octets"
+	TypeIpAddr     DataType = "ipaddr"
+	TypeIpv4Prefix DataType = "ipv4prefix"
+	TypeIpv6Addr   DataType = "ipv6addr"
+	TypeIpv6Prefix DataType = "ipv6prefix"
+	TypeComboIp    DataType = "combo-ip"
+	TypeInteger    DataType = "integer"
+	TypeInteger64  DataType = "integer64"
+	TypeDate       DataType = "date"
+	TypeByte       DataType = "byte"
+	TypeShort      DataType = "short"
+	TypeSigned     DataType = "signed"
+	TypeEther      DataType = "ether"
+	TypeIfid       DataType = "ifid"
+	TypeABinary    DataType = "abinary"
+	TypeVsa        DataType = "vsa"
+	TypeTlv        DataType = "tlv"
+	// Containers of the RFC 6929 extended attribute space
+	TypeExtended     DataType = "extended"
+	TypeLongExtended DataType = "long-extended"
+	TypeEvs          DataType = "evs"
+)
+
+var dataTypes = func() map[string]DataType {
+	types := map[string]DataType{}
+	for _, dataType := range []DataType{
+		TypeString, TypeOctets, TypeIpAddr, TypeIpv4Prefix, TypeIpv6Addr, TypeIpv6Prefix, TypeComboIp,
+		TypeInteger, TypeInteger64, TypeDate, TypeByte, TypeShort, TypeSigned, TypeEther, TypeIfid,
+		TypeABinary, TypeVsa, TypeTlv, TypeExtended, TypeLongExtended, TypeEvs,
+	} {
+		types[string(dataType)] = dataType
+	}
+	// RFC 8044 names of the same data types
+	types["text"] = TypeString
+	types["enum"] = TypeInteger
+	types["time"] = TypeDate
+	types["ipv4addr"] = TypeIpAddr
+	return types
+}()
+
+// Encrypt is the value of the encrypt= attribute flag.
+type Encrypt int
+
+const (
+	EncryptNone Encrypt = iota
+	// EncryptUserPassword hides the value like User-Password (RFC 2865
+	// section 5.2)
+	EncryptUserPassword
+	// EncryptTunnelPassword hides the value with a salt like Tunnel-Password
+	// (RFC 2868 section 3.5) and MS-MPPE-Send-Key (RFC 2548 section 2.4.2)
+	EncryptTunnelPassword
+	// EncryptAscendSecret is parsed for compatibility but not supported
+	EncryptAscendSecret
+)
+
+type Vendor struct {
+	Name string
+	Id   uint32
+	// TypeOctets and LengthOctets describe the header of the attributes
+	// inside the Vendor-Specific attribute, format=1,1 by default
+	TypeOctets   int
+	LengthOctets int
+}
+
+type Attribute struct {
+	Name string
+	// Vendor is nil for standard attributes
+	Vendor *Vendor
+	Code   []int
+	Type   DataType
+	// Length is the fixed length of an octets[N] attribute, 0 when the
+	// length is variable
+	Length  int
+	Encrypt Encrypt
+	HasTag  bool
+	Concat  bool
+}
+
+// Oid returns the attribute number, with its parents for nested attributes
+// (e.g. "26" or "241.1"). Attributes of a vendor are numbered inside the
+// Vendor-Specific or Extended-Vendor-Specific attribute.
+func (a *Attribute) Oid() string {
+	return oid(a.Code)
+}
+
+func oid(code []int) string {
+	parts := make([]string, len(code))
+	for i, number := range code {
+		parts[i] = strconv.Itoa(number)
+	}
+	return strings.Join(parts, ".")
+}
+
+func (a *Attribute) vendorId() uint32 {
+	if a.Vendor == nil {
+		return 0
+	}
+	return a.Vendor.Id
+}
+
+func (a *Attribute) String() string {
+	if a.Vendor == nil {
+		return fmt.Sprintf("%s (%s)", a.Name, a.Oid())
+	}
+	return fmt.Sprintf("%s (%s %s)", a.Name, a.Vendor.Name, a.Oid())
+}
+
+type attributeKey struct {
+	vendorId uint32
+	oid      string
+}
+
+type Dictionary struct {
+	mu              sync.RWMutex
+	vendorsByName   map[string]*Vendor
+	vendorsById     map[uint32]*Vendor
+	attributesByKey map[attributeKey]*Attribute
+	attributes      map[string]*Attribute
+	// values maps an attribute to its named values, in both directions
+	values     map[*Attribute]map[string]uint64
+	valueNames map[*Attribute]map[uint64]string
+}
+
+func New() *Dictionary {
+	return &Dictionary{
+		vendorsByName:   map[string]*Vendor{},
+		vendorsById:     map[uint32]*Vendor{},
+		attributesByKey: map[attributeKey]*Attribute{},
+		attributes:      map[string]*Attribute{},
+		values:          map[*Attribute]map[string]uint64{},
+		valueNames:      map[*Attribute]map[uint64]string{},
+	}
+}
+
+// Attribute returns the attribute registered with name, or nil.
+func (d *Dictionary) Attribute(name string) *Attribute {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.attributes[strings.ToLower(name)]
+}
+
+// AttributeByCode returns the attribute with the given code of a vendor
+// (0 for standard attributes), or nil.
+func (d *Dictionary) AttributeByCode(vendorId uint32, code ...int) *Attribute {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.attributesByKey[attributeKey{vendorId: vendorId, oid: oid(code)}]
+}
+
+// Vendor returns the vendor registered with name, or nil.
+func (d *Dictionary) Vendor(name string) *Vendor {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.vendorsByName[strings.ToLower(name)]
+}
+
+// VendorById returns the vendor registered with the given number, or nil.
+func (d *Dictionary) VendorById(id uint32) *Vendor {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.vendorsById[id]
+}
+
+// Value returns the number of a named value of an attribute.
+func (d *Dictionary) Value(attribute *Attribute, name string) (uint64, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	value, ok := d.values[attribute][strings.ToLower(name)]
+	return value, ok
+}
+
+// ValueName returns the name of a value of an attribute.
+func (d *Dictionary) ValueName(attribute *Attribute, value uint64) (string, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	name, ok := d.valueNames[attribute][value]
+	return name, ok
+}
+
+func (d *Dictionary) addVendorLocked(vendor *Vendor) error {
+	byName := d.vendorsByName[strings.ToLower(vendor.Name)]
+	byId := d.vendorsById[vendor.Id]
+	if byName != nil || byId != nil {
+		if byName == byId && *byName == *vendor {
+			return nil
+		}
+		return fmt.Errorf("conflicting vendor %s (%d)", vendor.Name, vendor.Id)
+	}
+	d.vendorsByName[strings.ToLower(vendor.Name)] = vendor
+	d.vendorsById[vendor.Id] = vendor
+	return nil
+}
+
+// addAttributeLocked registers an attribute. Identical redefinitions are
+// ignored, a second name for an existing code is registered as an alias.
+func (d *Dictionary) addAttributeLocked(attribute *Attribute) error {
+	name := strings.ToLower(attribute.Name)
+	if existing := d.attributes[name]; existing != nil {
+		if existing.vendorId() == attribute.vendorId() && existing.Oid() == attribute.Oid() && existing.Type == attribute.Type {
+			return nil
+		}
+		return fmt.Errorf("duplicate attribute %s", attribute.Name)
+	}
+
+	key := attributeKey{vendorId: attribute.vendorId(), oid: attribute.Oid()}
+	if existing := d.attributesByKey[key]; existing != nil {
+		d.attributes[name] = existing
+		return nil
+	}
+	d.attributes[name] = attribute
+	d.attributesByKey[key] = attribute
+	return nil
+}
+
+// addValueLocked registers a named value. Later definitions replace earlier
+// ones, as in FreeRADIUS.
+func (d *Dictionary) addValueLocked(attribute *Attribute, name string, value uint64) {
+	if d.values[attribute] == nil {
+		d.values[attribute] = map[string]uint64{}
+		d.valueNames[attribute] = map[uint64]string{}
+	}
+	d.values[attribute][strings.ToLower(name)] = value
+	d.valueNames[attribute][value] = name
+}
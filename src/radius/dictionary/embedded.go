@@ -0,0 +1,87 @@
+package dictionary
+
+import (
+	"embed"
+	"os"
+	"path/filepath"
+
+	"layeh.com/radius"
+)
+
+// files holds the standard RFC dictionaries and the vendor dictionaries
+// shipped with the server (Microsoft, WISPr, Mikrotik, Cisco, Juniper,
+// Huawei).
+//
+//go:embed files
+var files embed.FS
+
+// Default is the dictionary used by the RADIUS handlers. It starts with the
+// embedded dictionaries, LoadFile adds site specific ones.
+var Default = newDefault()
+
+func newDefault() *Dictionary {
+	d := New()
+	if err := d.Load(files, "files/dictionary"); err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// LoadFile parses the dictionary file at path, and the files it includes,
+// into Default.
+func LoadFile(path string) error {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return Default.Load(os.DirFS("/"), filepath.ToSlash(absolute)[1:])
+}
+
+// Lookup returns the first value of attribute name in p, using Default.
+func Lookup(p *radius.Packet, name string) (any, error) {
+	return Default.Lookup(p, name)
+}
+
+// LookupString returns the first value of attribute name in p in text form,
+// using Default.
+func LookupString(p *radius.Packet, name string) (string, error) {
+	return Default.LookupString(p, name)
+}
+
+// LookupAll returns every value of attribute name in p, using Default.
+func LookupAll(p *radius.Packet, name string) ([]any, error) {
+	return Default.LookupAll(p, name)
+}
+
+// Add appends attribute name with value to p, using Default.
+func Add(p *radius.Packet, name string, value any) error {
+	return Default.Add(p, name, value)
+}
+
+// Set replaces every instance of attribute name in p with value, using
+// Default.
+func Set(p *radius.Packet, name string, value any) error {
+	return Default.Set(p, name, value)
+}
+
+// Del removes every instance of attribute name from p, using Default.
+func Del(p *radius.Packet, name string) error {
+	return Default.Del(p, name)
+}
+
+// ParseValue converts the text form of a value of attribute name to its Go
+// type, using Default.
+func ParseValue(name string, text string) (any, error) {
+	return Default.ParseValue(name, text)
+}
+
+// FormatValue returns the text form of a value of attribute name, using
+// Default.
+func FormatValue(name string, value any) (string, error) {
+	return Default.FormatValue(name, value)
+}
+
+// Format returns the attributes of p as "Name = value" lines, using Default.
+func Format(p *radius.Packet) []string {
+	return Default.Format(p)
+}
@@ -0,0 +1,281 @@
+package dictionary
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"layeh.com/radius"
+)
+
+// Packet access by attribute name. Encrypted attributes are hidden with the
+// packet secret and authenticator, so on a response they must be set before
+// the packet is encoded. Tagged attributes are written with tag 0 and read
+// without their tag. radius.ErrNoAttribute is returned for absent attributes.
+
+// Lookup returns the first value of attribute name in p.
+func (d *Dictionary) Lookup(p *radius.Packet, name string) (any, error) {
+	values, err := d.LookupAll(p, name)
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// LookupString returns the first value of attribute name in p in text form.
+func (d *Dictionary) LookupString(p *radius.Packet, name string) (string, error) {
+	attribute, err := d.lookupAttribute(name)
+	if err != nil {
+		return "", err
+	}
+	value, err := d.Lookup(p, name)
+	if err != nil {
+		return "", err
+	}
+	return d.formatValue(attribute, value), nil
+}
+
+// LookupAll returns every value of attribute name in p. Instances of concat
+// attributes are joined into a single value.
+func (d *Dictionary) LookupAll(p *radius.Packet, name string) ([]any, error) {
+	attribute, err := d.lookupAttribute(name)
+	if err != nil {
+		return nil, err
+	}
+
+	raws := []radius.Attribute{}
+	d.mu.RLock()
+	d.walkLocked(p, func(found wireAttribute) {
+		if found.attribute == attribute {
+			raws = append(raws, found.data)
+		}
+	})
+	d.mu.RUnlock()
+	if len(raws) == 0 {
+		return nil, radius.ErrNoAttribute
+	}
+	if attribute.Concat {
+		joined := radius.Attribute{}
+		for _, raw := range raws {
+			joined = append(joined, raw...)
+		}
+		raws = []radius.Attribute{joined}
+	}
+
+	values := make([]any, 0, len(raws))
+	for _, raw := range raws {
+		data, err := revealValue(p, attribute, raw)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", attribute.Name, err)
+		}
+		value, err := d.decodeValue(attribute, data)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", attribute.Name, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Add appends attribute name with value to p.
+func (d *Dictionary) Add(p *radius.Packet, name string, value any) error {
+	attribute, err := d.lookupAttribute(name)
+	if err != nil {
+		return err
+	}
+	data, err := d.encodeValue(attribute, value)
+	if err != nil {
+		return err
+	}
+	data, err = hideValue(p, attribute, data)
+	if err != nil {
+		return fmt.Errorf("attribute %s: %w", attribute.Name, err)
+	}
+
+	d.mu.RLock()
+	pl, err := d.placementLocked(attribute)
+	d.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	chunks := []radius.Attribute{data}
+	if attribute.Concat && pl.kind != TypeLongExtended {
+		// the value is split over attributes of the longest value that fits,
+		// after the header of an empty value
+		empty, err := pl.encode(nil)
+		if err != nil {
+			return fmt.Errorf("attribute %s: %w", attribute.Name, err)
+		}
+		chunks = splitValue(data, maxAttributeValueLength-len(empty[0].Attribute))
+	}
+	for _, chunk := range chunks {
+		attributes, err := pl.encode(chunk)
+		if err != nil {
+			return fmt.Errorf("attribute %s: %w", attribute.Name, err)
+		}
+		p.Attributes = append(p.Attributes, attributes...)
+	}
+	return nil
+}
+
+// Set replaces every instance of attribute name in p with value.
+func (d *Dictionary) Set(p *radius.Packet, name string, value any) error {
+	if err := d.Del(p, name); err != nil {
+		return err
+	}
+	return d.Add(p, name, value)
+}
+
+// Del removes every instance of attribute name from p. Containers left empty
+// are removed as well.
+func (d *Dictionary) Del(p *radius.Packet, name string) error {
+	attribute, err := d.lookupAttribute(name)
+	if err != nil {
+		return err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	pl, err := d.placementLocked(attribute)
+	if err != nil {
+		return err
+	}
+	kept := radius.Attributes{}
+	for _, avp := range d.logicalAttributesLocked(p.Attributes) {
+		avp, err := pl.remove(avp)
+		if err != nil {
+			return fmt.Errorf("attribute %s: %w", attribute.Name, err)
+		}
+		if avp != nil {
+			kept = append(kept, avp)
+		}
+	}
+	p.Attributes = d.wireAttributesLocked(kept)
+	return nil
+}
+
+// Format returns the attributes of p as "Name = value" lines, for logs.
+// Encrypted values are not revealed. Attributes missing from the dictionary
+// are named after their number as FreeRADIUS does, e.g. Attr-241.9 or
+// Attr-26.14988.99.
+func (d *Dictionary) Format(p *radius.Packet) []string {
+	found := []wireAttribute{}
+	d.mu.RLock()
+	d.walkLocked(p, func(attribute wireAttribute) {
+		if !attribute.container {
+			found = append(found, attribute)
+		}
+	})
+	d.mu.RUnlock()
+
+	lines := make([]string, 0, len(found))
+	for _, attribute := range found {
+		lines = append(lines, d.formatWireAttribute(p, attribute))
+	}
+	return lines
+}
+
+func (d *Dictionary) formatWireAttribute(p *radius.Packet, found wireAttribute) string {
+	attribute := found.attribute
+	if attribute == nil {
+		return unknownAttributeName(found) + " = 0x" + hex.EncodeToString(found.data)
+	}
+	if attribute.Encrypt != EncryptNone {
+		return attribute.Name + " = <hidden>"
+	}
+	if data, err := revealValue(p, attribute, found.data); err == nil {
+		if value, err := d.decodeValue(attribute, data); err == nil {
+			return attribute.Name + " = " + d.formatValue(attribute, value)
+		}
+	}
+	return attribute.Name + " = 0x" + hex.EncodeToString(found.data)
+}
+
+func unknownAttributeName(found wireAttribute) string {
+	if found.vendor == nil {
+		return "Attr-" + oid(found.code)
+	}
+	vendorId := strconv.FormatUint(uint64(found.vendor.Id), 10)
+	if found.evs {
+		return "Attr-" + oid(found.code[:2]) + "." + vendorId + "." + oid(found.code[2:])
+	}
+	return "Attr-26." + vendorId + "." + oid(found.code)
+}
+
+func (d *Dictionary) lookupAttribute(name string) (*Attribute, error) {
+	attribute := d.Attribute(name)
+	if attribute == nil {
+		return nil, fmt.Errorf("unknown attribute %s", name)
+	}
+	return attribute, nil
+}
+
+func splitValue(data radius.Attribute, size int) []radius.Attribute {
+	chunks := []radius.Attribute{}
+	for len(data) > size {
+		chunks = append(chunks, data[:size])
+		data = data[size:]
+	}
+	return append(chunks, data)
+}
+
+// hideValue adds the tag and applies the encryption of the attribute flags.
+func hideValue(p *radius.Packet, attribute *Attribute, data radius.Attribute) (radius.Attribute, error) {
+	var err error
+	if attribute.HasTag && isIntegerType(attribute.Type) {
+		if data, err = withIntegerTag(data, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	switch attribute.Encrypt {
+	case EncryptUserPassword:
+		return radius.NewUserPassword(data, p.Secret, p.Authenticator[:])
+	case EncryptTunnelPassword:
+		salt := make([]byte, 2)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		salt[0] |= 0x80
+		hidden, err := radius.NewTunnelPassword(data, salt, p.Secret, p.Authenticator[:])
+		if err != nil {
+			return nil, err
+		}
+		if attribute.HasTag {
+			hidden = append(radius.Attribute{0}, hidden...)
+		}
+		return hidden, nil
+	case EncryptAscendSecret:
+		return nil, errors.New("encrypt=3 is not supported")
+	}
+	return data, nil
+}
+
+// revealValue removes the tag and the encryption of the attribute flags.
+func revealValue(p *radius.Packet, attribute *Attribute, data radius.Attribute) (radius.Attribute, error) {
+	if attribute.HasTag {
+		switch {
+		case isIntegerType(attribute.Type) && len(data) == 4:
+			data = append(radius.Attribute{0}, data[1:]...)
+		case attribute.Encrypt == EncryptTunnelPassword && len(data) > 0:
+			data = data[1:]
+		case len(data) > 0 && data[0] <= 0x1F:
+			// Tags of string values are optional (RFC 2868 section 3.1)
+			data = data[1:]
+		}
+	}
+
+	switch attribute.Encrypt {
+	case EncryptUserPassword:
+		return radius.UserPassword(data, p.Secret, p.Authenticator[:])
+	case EncryptTunnelPassword:
+		password, _, err := radius.TunnelPassword(data, p.Secret, p.Authenticator[:])
+		return password, err
+	case EncryptAscendSecret:
+		return nil, errors.New("encrypt=3 is not supported")
+	}
+	return data, nil
+}
@@ -0,0 +1,406 @@
+package dictionary
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"radius-server/src/common/logger"
+)
+
+// Parser for FreeRADIUS dictionary files. Supported keywords are VENDOR,
+// BEGIN-VENDOR, END-VENDOR, BEGIN-TLV, END-TLV, ATTRIBUTE, VALUE and
+// $INCLUDE ($INCLUDE- skips missing files), FLAGS lines are skipped with a
+// warning. ATTRIBUTE accepts the octets[N] fixed length type, the encrypt=,
+// has_tag and concat flags and the legacy trailing vendor name, other flags
+// are ignored. Nested attributes (TLVs and the RFC 6929 extended space) use
+// dotted numbers below their container, e.g. 241.1 or 241.5.1, or numbers
+// relative to the tlv attribute of the current BEGIN-TLV block, and
+// BEGIN-VENDOR format=Extended-Vendor-Specific-N numbers the vendor
+// attributes inside an evs attribute.
+
+const maxIncludeDepth = 16
+
+// ParseError locates a dictionary error.
+type ParseError struct {
+	File  string
+	Line  int
+	Cause error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("dictionary %s line %d: %s", e.File, e.Line, e.Cause.Error())
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Cause
+}
+
+// Load parses the dictionary file name of fsys and every file it includes
+// into d. Include paths are relative to the including file.
+func (d *Dictionary) Load(fsys fs.FS, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.parseFileLocked(fsys, path.Clean(name), nil)
+}
+
+func (d *Dictionary) parseFileLocked(fsys fs.FS, name string, includedFrom []string) error {
+	if len(includedFrom) >= maxIncludeDepth || slices.Contains(includedFrom, name) {
+		return fmt.Errorf("dictionary %s: recursive $INCLUDE", name)
+	}
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	state := &parserState{
+		dictionary:   d,
+		fsys:         fsys,
+		name:         name,
+		includedFrom: append(includedFrom, name),
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		state.line++
+		line := scanner.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := state.parseLine(fields); err != nil {
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				return err
+			}
+			return &ParseError{File: name, Line: state.line, Cause: err}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(state.tlvs) > 0 {
+		return &ParseError{File: name, Line: state.line, Cause: fmt.Errorf("missing END-TLV %s", state.tlv().Name)}
+	}
+	if state.vendor != nil {
+		return &ParseError{File: name, Line: state.line, Cause: fmt.Errorf("missing END-VENDOR %s", state.vendor.Name)}
+	}
+	return nil
+}
+
+type parserState struct {
+	dictionary   *Dictionary
+	fsys         fs.FS
+	name         string
+	includedFrom []string
+	line         int
+	// vendor is the vendor of the current BEGIN-VENDOR block
+	vendor *Vendor
+	// evs is the Extended-Vendor-Specific attribute holding the attributes
+	// of the current vendor block, nil for Vendor-Specific
+	evs *Attribute
+	// tlvs are the tlv attributes of the nested BEGIN-TLV blocks
+	tlvs []*Attribute
+}
+
+// tlv returns the tlv attribute of the innermost BEGIN-TLV block.
+func (s *parserState) tlv() *Attribute {
+	if len(s.tlvs) == 0 {
+		return nil
+	}
+	return s.tlvs[len(s.tlvs)-1]
+}
+
+func (s *parserState) parseLine(fields []string) error {
+	switch fields[0] {
+	case "$INCLUDE", "$INCLUDE-":
+		if len(fields) != 2 {
+			return errors.New("invalid $INCLUDE")
+		}
+		if s.vendor != nil || len(s.tlvs) > 0 {
+			return errors.New("$INCLUDE inside a vendor or tlv block")
+		}
+		name := fields[1]
+		if !path.IsAbs(name) {
+			name = path.Join(path.Dir(s.name), name)
+		}
+		err := s.dictionary.parseFileLocked(s.fsys, path.Clean(strings.TrimPrefix(name, "/")), s.includedFrom)
+		if err != nil && fields[0] == "$INCLUDE-" && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	case "VENDOR":
+		return s.parseVendor(fields)
+	case "BEGIN-VENDOR":
+		return s.parseBeginVendor(fields)
+	case "END-VENDOR":
+		if len(fields) != 2 || s.vendor == nil || !strings.EqualFold(fields[1], s.vendor.Name) || len(s.tlvs) > 0 {
+			return errors.New("unmatched END-VENDOR")
+		}
+		s.vendor = nil
+		s.evs = nil
+		return nil
+	case "BEGIN-TLV":
+		return s.parseBeginTlv(fields)
+	case "END-TLV":
+		if len(fields) != 2 || s.tlv() == nil || !strings.EqualFold(fields[1], s.tlv().Name) {
+			return errors.New("unmatched END-TLV")
+		}
+		s.tlvs = s.tlvs[:len(s.tlvs)-1]
+		return nil
+	case "ATTRIBUTE":
+		return s.parseAttribute(fields)
+	case "VALUE":
+		return s.parseValue(fields)
+	case "FLAGS":
+		// FreeRADIUS 4 flags of the following definitions, e.g. internal
+		logger.Logger.Warn().Msgf("Dictionary %s line %d: skip %s", s.name, s.line, strings.Join(fields, " "))
+		return nil
+	}
+	return fmt.Errorf("unsupported keyword %s", fields[0])
+}
+
+// parseVendor parses VENDOR <name> <number> [format=<type>,<length>].
+func (s *parserState) parseVendor(fields []string) error {
+	if len(fields) != 3 && len(fields) != 4 {
+		return errors.New("invalid VENDOR")
+	}
+	id, err := parseNumber(fields[2], 32)
+	if err != nil {
+		return fmt.Errorf("invalid vendor number %s", fields[2])
+	}
+	vendor := &Vendor{Name: fields[1], Id: uint32(id), TypeOctets: 1, LengthOctets: 1}
+	if len(fields) == 4 {
+		format, ok := strings.CutPrefix(fields[3], "format=")
+		if !ok {
+			return fmt.Errorf("invalid vendor flag %s", fields[3])
+		}
+		// A trailing ",c" (continuation byte, WiMAX) is not supported
+		parts := strings.Split(format, ",")
+		if len(parts) != 2 {
+			return fmt.Errorf("unsupported vendor format %s", format)
+		}
+		typeOctets, typeErr := strconv.Atoi(parts[0])
+		lengthOctets, lengthErr := strconv.Atoi(parts[1])
+		if typeErr != nil || lengthErr != nil ||
+			!slices.Contains([]int{1, 2, 4}, typeOctets) || !slices.Contains([]int{0, 1, 2}, lengthOctets) {
+			return fmt.Errorf("invalid vendor format %s", format)
+		}
+		vendor.TypeOctets = typeOctets
+		vendor.LengthOctets = lengthOctets
+	}
+	return s.dictionary.addVendorLocked(vendor)
+}
+
+// parseBeginVendor parses BEGIN-VENDOR <name> [format=<evs attribute>].
+func (s *parserState) parseBeginVendor(fields []string) error {
+	if len(fields) != 2 && len(fields) != 3 {
+		return errors.New("invalid BEGIN-VENDOR")
+	}
+	if s.vendor != nil {
+		return errors.New("nested BEGIN-VENDOR")
+	}
+	vendor := s.dictionary.vendorsByName[strings.ToLower(fields[1])]
+	if vendor == nil {
+		return fmt.Errorf("unknown vendor %s", fields[1])
+	}
+	if len(fields) == 3 {
+		name, ok := strings.CutPrefix(fields[2], "format=")
+		if !ok {
+			return fmt.Errorf("invalid BEGIN-VENDOR flag %s", fields[2])
+		}
+		evs := s.dictionary.attributes[strings.ToLower(name)]
+		if evs == nil || evs.Type != TypeEvs {
+			return fmt.Errorf("%s is not an evs attribute", name)
+		}
+		s.evs = evs
+	}
+	s.vendor = vendor
+	return nil
+}
+
+// parseBeginTlv parses BEGIN-TLV <tlv attribute>.
+func (s *parserState) parseBeginTlv(fields []string) error {
+	if len(fields) != 2 {
+		return errors.New("invalid BEGIN-TLV")
+	}
+	tlv := s.dictionary.attributes[strings.ToLower(fields[1])]
+	if tlv == nil || tlv.Type != TypeTlv {
+		return fmt.Errorf("%s is not a tlv attribute", fields[1])
+	}
+	if tlv.Vendor != s.vendor {
+		return fmt.Errorf("tlv attribute %s outside its vendor block", tlv.Name)
+	}
+	s.tlvs = append(s.tlvs, tlv)
+	return nil
+}
+
+// parseAttribute parses ATTRIBUTE <name> <oid> <type> [flags|vendor].
+func (s *parserState) parseAttribute(fields []string) error {
+	if len(fields) != 4 && len(fields) != 5 {
+		return errors.New("invalid ATTRIBUTE")
+	}
+	code, err := parseOid(fields[2])
+	if err != nil {
+		return err
+	}
+	if tlv := s.tlv(); tlv != nil {
+		code = append(slices.Clone(tlv.Code), code...)
+	} else if s.evs != nil {
+		code = append(slices.Clone(s.evs.Code), code...)
+	}
+	dataType, length, err := parseAttributeType(fields[3])
+	if err != nil {
+		return err
+	}
+
+	attribute := &Attribute{
+		Name:   fields[1],
+		Vendor: s.vendor,
+		Code:   code,
+		Type:   dataType,
+		Length: length,
+	}
+	if len(fields) == 5 {
+		if vendor := s.dictionary.vendorsByName[strings.ToLower(fields[4])]; vendor != nil && s.vendor == nil {
+			attribute.Vendor = vendor
+		} else if err := parseAttributeFlags(attribute, fields[4]); err != nil {
+			return err
+		}
+	}
+	if err := s.dictionary.validateAttributeLocked(attribute); err != nil {
+		return err
+	}
+	return s.dictionary.addAttributeLocked(attribute)
+}
+
+// parseAttributeType parses a data type, octets[N] for octets of fixed
+// length N.
+func parseAttributeType(value string) (DataType, int, error) {
+	name, length := strings.ToLower(value), 0
+	if prefix, size, ok := strings.Cut(name, "["); ok {
+		n, err := strconv.Atoi(strings.TrimSuffix(size, "]"))
+		if prefix != string(TypeOctets) || !strings.HasSuffix(size, "]") || err != nil || n < 1 || n > maxAttributeValueLength {
+			return "", 0, fmt.Errorf("unsupported attribute type %s", value)
+		}
+		name, length = prefix, n
+	}
+	dataType, ok := dataTypes[name]
+	if !ok {
+		return "", 0, fmt.Errorf("unsupported attribute type %s", value)
+	}
+	return dataType, length, nil
+}
+
+func parseAttributeFlags(attribute *Attribute, flags string) error {
+	for _, flag := range strings.Split(flags, ",") {
+		switch {
+		case flag == "has_tag":
+			attribute.HasTag = true
+		case flag == "concat":
+			attribute.Concat = true
+		case strings.HasPrefix(flag, "encrypt="):
+			encrypt, err := strconv.Atoi(strings.TrimPrefix(flag, "encrypt="))
+			if err != nil || encrypt < int(EncryptNone) || encrypt > int(EncryptAscendSecret) {
+				return fmt.Errorf("invalid flag %s", flag)
+			}
+			attribute.Encrypt = Encrypt(encrypt)
+		}
+	}
+	return nil
+}
+
+// validateAttributeLocked checks the attribute numbers and flags, and that
+// the parent of a nested attribute is a container.
+func (d *Dictionary) validateAttributeLocked(attribute *Attribute) error {
+	for i, code := range attribute.Code {
+		maxCode := 255
+		if i == 0 && attribute.Vendor != nil && attribute.Vendor.TypeOctets > 1 {
+			maxCode = 1<<(8*attribute.Vendor.TypeOctets) - 1
+		}
+		if code > maxCode {
+			return fmt.Errorf("attribute number %s out of range", attribute.Oid())
+		}
+	}
+	if attribute.Encrypt != EncryptNone && attribute.Type != TypeString && attribute.Type != TypeOctets {
+		return fmt.Errorf("attribute %s of type %s cannot be encrypted", attribute.Name, attribute.Type)
+	}
+	if len(attribute.Code) == 1 {
+		return nil
+	}
+
+	parentOid := oid(attribute.Code[:len(attribute.Code)-1])
+	parent := d.attributesByKey[attributeKey{vendorId: attribute.vendorId(), oid: parentOid}]
+	if parent == nil && attribute.Vendor != nil {
+		// vendor attributes of an Extended-Vendor-Specific attribute
+		parent = d.attributesByKey[attributeKey{oid: parentOid}]
+	}
+	if parent == nil {
+		return fmt.Errorf("unknown parent attribute %s of %s", parentOid, attribute.Name)
+	}
+	switch {
+	case parent.Type == TypeTlv:
+	case parent.Type == TypeEvs && attribute.Vendor != nil && parent.Vendor == nil:
+	case (parent.Type == TypeExtended || parent.Type == TypeLongExtended) && attribute.Vendor == nil:
+	default:
+		return fmt.Errorf("attribute %s of type %s cannot contain %s", parent.Name, parent.Type, attribute.Name)
+	}
+	return nil
+}
+
+// parseValue parses VALUE <attribute> <name> <number>.
+func (s *parserState) parseValue(fields []string) error {
+	if len(fields) != 4 {
+		return errors.New("invalid VALUE")
+	}
+	attribute := s.dictionary.attributes[strings.ToLower(fields[1])]
+	if attribute == nil {
+		return fmt.Errorf("VALUE for unknown attribute %s", fields[1])
+	}
+	if !isIntegerType(attribute.Type) {
+		return fmt.Errorf("VALUE for attribute %s of type %s", attribute.Name, attribute.Type)
+	}
+	value, err := parseNumber(fields[3], 64)
+	if err != nil {
+		return fmt.Errorf("invalid value %s", fields[3])
+	}
+	s.dictionary.addValueLocked(attribute, fields[2], value)
+	return nil
+}
+
+// parseOid parses an attribute number, dotted for nested attributes.
+func parseOid(value string) ([]int, error) {
+	code := []int{}
+	for _, part := range strings.Split(value, ".") {
+		number, err := parseNumber(part, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attribute number %s", value)
+		}
+		code = append(code, int(number))
+	}
+	return code, nil
+}
+
+// parseNumber parses a decimal or 0x prefixed hexadecimal number.
+func parseNumber(value string, bitSize int) (uint64, error) {
+	if hex, ok := strings.CutPrefix(strings.ToLower(value), "0x"); ok {
+		return strconv.ParseUint(hex, 16, bitSize)
+	}
+	return strconv.ParseUint(value, 10, bitSize)
+}
+
+func isIntegerType(dataType DataType) bool {
+	switch dataType {
+	case TypeInteger, TypeInteger64, TypeByte, TypeShort, TypeSigned:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+package dictionary
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"layeh.com/radius"
+)
+
+// Typed attribute values. Each data type maps to one Go type:
+//
+//	string                       string
+//	octets, ifid, abinary        []byte
+//	ipaddr, ipv6addr, combo-ip   net.IP
+//	ipv4prefix, ipv6prefix       *net.IPNet
+//	integer                      uint32
+//	integer64                    uint64
+//	byte                         uint8
+//	short                        uint16
+//	signed                       int32
+//	date                         time.Time
+//	ether                        net.HardwareAddr
+//
+// Values can also be given as text, the way they are written in FreeRADIUS
+// configuration: named VALUEs for integers, 0x prefixed hex for octets.
+
+// ParseValue converts the text form of a value of attribute name to its Go
+// type, e.g. "Framed-User" for Service-Type.
+func (d *Dictionary) ParseValue(name string, text string) (any, error) {
+	attribute, err := d.lookupAttribute(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.parseText(attribute, text)
+}
+
+// FormatValue returns the text form of a value of attribute name.
+func (d *Dictionary) FormatValue(name string, value any) (string, error) {
+	attribute, err := d.lookupAttribute(name)
+	if err != nil {
+		return "", err
+	}
+	return d.formatValue(attribute, value), nil
+}
+
+// encodeValue returns the wire form of value, without tag and encryption.
+func (d *Dictionary) encodeValue(attribute *Attribute, value any) (radius.Attribute, error) {
+	if text, ok := value.(string); ok && attribute.Type != TypeString {
+		parsed, err := d.parseText(attribute, text)
+		if err != nil {
+			return nil, err
+		}
+		value = parsed
+	}
+
+	switch attribute.Type {
+	case TypeString:
+		// Lengths are checked when the value is added, concat values span
+		// several attributes
+		if v, ok := value.(string); ok {
+			return radius.Attribute(v), nil
+		}
+		if v, ok := value.([]byte); ok {
+			return append(radius.Attribute(nil), v...), nil
+		}
+	case TypeOctets, TypeIfid, TypeABinary:
+		if v, ok := value.([]byte); ok {
+			if attribute.Type == TypeIfid && len(v) != 8 {
+				return nil, errors.New("ifid must be 8 bytes")
+			}
+			if attribute.Length > 0 && len(v) != attribute.Length {
+				return nil, fmt.Errorf("attribute %s must be %d bytes", attribute.Name, attribute.Length)
+			}
+			return append(radius.Attribute(nil), v...), nil
+		}
+	case TypeIpAddr:
+		if v, ok := value.(net.IP); ok {
+			return radius.NewIPAddr(v)
+		}
+	case TypeIpv6Addr:
+		if v, ok := value.(net.IP); ok {
+			return radius.NewIPv6Addr(v)
+		}
+	case TypeComboIp:
+		if v, ok := value.(net.IP); ok {
+			if v.To4() != nil {
+				return radius.NewIPAddr(v)
+			}
+			return radius.NewIPv6Addr(v)
+		}
+	case TypeIpv4Prefix:
+		if v, ok := value.(*net.IPNet); ok && v.IP.To4() != nil {
+			ones, bits := v.Mask.Size()
+			if bits != 32 {
+				return nil, errors.New("mask is not IPv4")
+			}
+			data := make(radius.Attribute, 6)
+			data[1] = byte(ones)
+			copy(data[2:], v.IP.To4().Mask(v.Mask))
+			return data, nil
+		}
+	case TypeIpv6Prefix:
+		if v, ok := value.(*net.IPNet); ok {
+			return radius.NewIPv6Prefix(v)
+		}
+	case TypeInteger:
+		if v, ok := toUint64(value); ok && v <= 0xFFFFFFFF {
+			return radius.NewInteger(uint32(v)), nil
+		}
+	case TypeInteger64:
+		if v, ok := toUint64(value); ok {
+			return radius.NewInteger64(v), nil
+		}
+	case TypeByte:
+		if v, ok := toUint64(value); ok && v <= 0xFF {
+			return radius.Attribute{byte(v)}, nil
+		}
+	case TypeShort:
+		if v, ok := toUint64(value); ok && v <= 0xFFFF {
+			return radius.NewShort(uint16(v)), nil
+		}
+	case TypeSigned:
+		if v, ok := value.(int32); ok {
+			return radius.NewInteger(uint32(v)), nil
+		}
+		if v, ok := value.(int); ok && v >= -1<<31 && v < 1<<31 {
+			return radius.NewInteger(uint32(int32(v))), nil
+		}
+	case TypeDate:
+		if v, ok := value.(time.Time); ok {
+			return radius.NewDate(v)
+		}
+	case TypeEther:
+		if v, ok := value.(net.HardwareAddr); ok && len(v) == 6 {
+			return radius.NewBytes(v)
+		}
+	default:
+		return nil, fmt.Errorf("attribute %s of type %s cannot be set directly", attribute.Name, attribute.Type)
+	}
+	return nil, fmt.Errorf("invalid value %v (%T) for attribute %s of type %s", value, value, attribute.Name, attribute.Type)
+}
+
+// decodeValue returns the typed value of the wire form data, without tag and
+// encryption.
+func (d *Dictionary) decodeValue(attribute *Attribute, data radius.Attribute) (any, error) {
+	switch attribute.Type {
+	case TypeString:
+		return radius.String(data), nil
+	case TypeOctets, TypeABinary:
+		return radius.Bytes(data), nil
+	case TypeIfid:
+		if len(data) != 8 {
+			return nil, errors.New("invalid length")
+		}
+		return radius.Bytes(data), nil
+	case TypeIpAddr:
+		return radius.IPAddr(data)
+	case TypeIpv6Addr:
+		return radius.IPv6Addr(data)
+	case TypeComboIp:
+		if len(data) == net.IPv4len {
+			return radius.IPAddr(data)
+		}
+		return radius.IPv6Addr(data)
+	case TypeIpv4Prefix:
+		if len(data) != 6 || data[1] > 32 {
+			return nil, errors.New("invalid ipv4prefix")
+		}
+		mask := net.CIDRMask(int(data[1]), 32)
+		return &net.IPNet{IP: net.IP(data[2:6]).Mask(mask), Mask: mask}, nil
+	case TypeIpv6Prefix:
+		return radius.IPv6Prefix(data)
+	case TypeInteger:
+		return radius.Integer(data)
+	case TypeInteger64:
+		return radius.Integer64(data)
+	case TypeByte:
+		if len(data) != 1 {
+			return nil, errors.New("invalid length")
+		}
+		return data[0], nil
+	case TypeShort:
+		return radius.Short(data)
+	case TypeSigned:
+		v, err := radius.Integer(data)
+		return int32(v), err
+	case TypeDate:
+		return radius.Date(data)
+	case TypeEther:
+		if len(data) != 6 {
+			return nil, errors.New("invalid length")
+		}
+		return net.HardwareAddr(radius.Bytes(data)), nil
+	}
+	return radius.Bytes(data), nil
+}
+
+// parseText converts the text form of a value to its Go type.
+func (d *Dictionary) parseText(attribute *Attribute, text string) (any, error) {
+	invalid := fmt.Errorf("invalid value %q for attribute %s of type %s", text, attribute.Name, attribute.Type)
+	switch attribute.Type {
+	case TypeOctets, TypeIfid, TypeABinary:
+		if hexText, ok := strings.CutPrefix(text, "0x"); ok {
+			data, err := hex.DecodeString(hexText)
+			if err != nil {
+				return nil, invalid
+			}
+			return data, nil
+		}
+		return []byte(text), nil
+	case TypeIpAddr, TypeIpv6Addr, TypeComboIp:
+		ip := net.ParseIP(text)
+		if ip == nil {
+			return nil, invalid
+		}
+		return ip, nil
+	case TypeIpv4Prefix, TypeIpv6Prefix:
+		_, prefix, err := net.ParseCIDR(text)
+		if err != nil {
+			return nil, invalid
+		}
+		return prefix, nil
+	case TypeInteger, TypeInteger64, TypeByte, TypeShort:
+		if value, ok := d.Value(attribute, text); ok {
+			return value, nil
+		}
+		value, err := parseNumber(text, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return value, nil
+	case TypeSigned:
+		value, err := strconv.ParseInt(text, 10, 32)
+		if err != nil {
+			return nil, invalid
+		}
+		return int32(value), nil
+	case TypeDate:
+		if seconds, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return time.Unix(seconds, 0), nil
+		}
+		value, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, invalid
+		}
+		return value, nil
+	case TypeEther:
+		value, err := net.ParseMAC(text)
+		if err != nil {
+			return nil, invalid
+		}
+		return value, nil
+	}
+	return text, nil
+}
+
+// formatValue returns the text form of a typed value.
+func (d *Dictionary) formatValue(attribute *Attribute, value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return "0x" + hex.EncodeToString(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case uint32, uint64, uint8, uint16:
+		number, _ := toUint64(v)
+		if name, ok := d.ValueName(attribute, number); ok {
+			return name
+		}
+		return strconv.FormatUint(number, 10)
+	}
+	return fmt.Sprint(value)
+}
+
+func toUint64(value any) (uint64, bool) {
+	switch v := value.(type) {
+	case uint64:
+		return v, true
+	case uint32:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint8:
+		return uint64(v), true
+	case uint:
+		return uint64(v), true
+	case int:
+		return uint64(v), v >= 0
+	case int64:
+		return uint64(v), v >= 0
+	case int32:
+		return uint64(v), v >= 0
+	}
+	return 0, false
+}
+
+// tagged integers keep the tag in the first of their four bytes (RFC 2868)
+func withIntegerTag(data radius.Attribute, tag byte) (radius.Attribute, error) {
+	if binary.BigEndian.Uint32(data) > 0xFFFFFF {
+		return nil, errors.New("tagged integer out of range")
+	}
+	tagged := append(radius.Attribute(nil), data...)
+	tagged[0] = tag
+	return tagged, nil
+}
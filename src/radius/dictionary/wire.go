@@ -0,0 +1,468 @@
+package dictionary
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+)
+
+// Wire layout of attributes. A registered attribute is placed either at the
+// top level, inside a Vendor-Specific attribute, inside an extended or long
+// extended attribute (RFC 6929 section 2), or inside an Extended-Vendor-
+// Specific attribute, and may be nested in TLVs below that. Long extended
+// attributes longer than one attribute are split into fragments chained with
+// the More flag, and reassembled before they are decoded.
+
+const (
+	maxAttributeValueLength = 253
+	longExtendedMoreFlag    = 0x80
+)
+
+var errMalformedTlv = errors.New("invalid TLV")
+
+// placement locates an attribute on the wire.
+type placement struct {
+	// typ is the top level attribute type
+	typ int
+	// kind is TypeVsa, TypeExtended or TypeLongExtended, empty for standard
+	// attributes
+	kind DataType
+	// extType is the Extended-Type of extended attributes
+	extType int
+	// vendor and vendorType are set for Vendor-Specific and
+	// Extended-Vendor-Specific attributes
+	vendor     *Vendor
+	vendorType int
+	// tlvs is the path of TLV types below the placed attribute
+	tlvs []int
+}
+
+func (d *Dictionary) placementLocked(attribute *Attribute) (placement, error) {
+	code := attribute.Code
+	if attribute.Vendor == nil {
+		kind := d.topLevelTypeLocked(code[0])
+		switch kind {
+		case TypeExtended, TypeLongExtended:
+			if len(code) < 2 {
+				return placement{}, fmt.Errorf("attribute %s is a container", attribute.Name)
+			}
+			if d.attributesByKey[attributeKey{oid: oid(code[:2])}].isEvs() {
+				return placement{}, fmt.Errorf("attribute %s is a container", attribute.Name)
+			}
+			return placement{typ: code[0], kind: kind, extType: code[1], tlvs: code[2:]}, nil
+		case TypeVsa, TypeEvs:
+			return placement{}, fmt.Errorf("attribute %s is a container", attribute.Name)
+		}
+		return placement{typ: code[0], tlvs: code[1:]}, nil
+	}
+
+	if len(code) >= 3 && d.attributesByKey[attributeKey{oid: oid(code[:2])}].isEvs() {
+		return placement{
+			typ:        code[0],
+			kind:       d.topLevelTypeLocked(code[0]),
+			extType:    code[1],
+			vendor:     attribute.Vendor,
+			vendorType: code[2],
+			tlvs:       code[3:],
+		}, nil
+	}
+	return placement{
+		typ:        int(rfc2865.VendorSpecific_Type),
+		kind:       TypeVsa,
+		vendor:     attribute.Vendor,
+		vendorType: code[0],
+		tlvs:       code[1:],
+	}, nil
+}
+
+func (a *Attribute) isEvs() bool {
+	return a != nil && a.Type == TypeEvs
+}
+
+// topLevelTypeLocked returns the data type of a top level attribute type.
+func (d *Dictionary) topLevelTypeLocked(typ int) DataType {
+	if attribute := d.attributesByKey[attributeKey{oid: strconv.Itoa(typ)}]; attribute != nil {
+		return attribute.Type
+	}
+	if typ == int(rfc2865.VendorSpecific_Type) {
+		return TypeVsa
+	}
+	return ""
+}
+
+// encode returns the top level attributes carrying data at the placement.
+func (pl placement) encode(data []byte) (radius.Attributes, error) {
+	value, err := wrapTlvs(pl.tlvs, data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch pl.kind {
+	case TypeVsa:
+		if value, err = radius.NewVendorSpecific(pl.vendor.Id, vendorAttribute(pl.vendor, pl.vendorType, value)); err != nil {
+			return nil, err
+		}
+	case TypeExtended, TypeLongExtended:
+		header := []byte{byte(pl.extType)}
+		if pl.kind == TypeLongExtended {
+			header = append(header, 0)
+		}
+		if pl.vendor != nil {
+			header = binary.BigEndian.AppendUint32(header, pl.vendor.Id)
+			header = append(header, byte(pl.vendorType))
+		}
+		value = append(header, value...)
+	}
+
+	avp := &radius.AVP{Type: radius.Type(pl.typ), Attribute: value}
+	if pl.kind == TypeLongExtended {
+		return fragmentLongExtended(avp), nil
+	}
+	if len(value) > maxAttributeValueLength {
+		return nil, errors.New("value too long")
+	}
+	return radius.Attributes{avp}, nil
+}
+
+// remove returns avp without the attributes at the placement, nil when
+// nothing remains.
+func (pl placement) remove(avp *radius.AVP) (*radius.AVP, error) {
+	if int(avp.Type) != pl.typ {
+		return avp, nil
+	}
+	data := avp.Attribute
+
+	switch pl.kind {
+	case TypeVsa:
+		vendorId, value, err := radius.VendorSpecific(data)
+		if err != nil || vendorId != pl.vendor.Id {
+			return avp, nil
+		}
+		kept := radius.Attribute{}
+		err = eachVendorAttribute(pl.vendor, value, func(typ int, data []byte) error {
+			if typ == pl.vendorType {
+				if len(pl.tlvs) == 0 {
+					return nil
+				}
+				var err error
+				if data, err = removeTlv(data, pl.tlvs); err != nil || len(data) == 0 {
+					return err
+				}
+			}
+			kept = append(kept, vendorAttribute(pl.vendor, typ, data)...)
+			return nil
+		})
+		if err != nil || len(kept) == 0 {
+			return nil, err
+		}
+		vsa, err := radius.NewVendorSpecific(vendorId, kept)
+		if err != nil {
+			return nil, err
+		}
+		return &radius.AVP{Type: avp.Type, Attribute: vsa}, nil
+	case TypeExtended, TypeLongExtended:
+		header := 1
+		if pl.kind == TypeLongExtended {
+			header = 2
+		}
+		if len(data) < header || int(data[0]) != pl.extType {
+			return avp, nil
+		}
+		if pl.vendor != nil {
+			if len(data) < header+5 || binary.BigEndian.Uint32(data[header:]) != pl.vendor.Id || int(data[header+4]) != pl.vendorType {
+				return avp, nil
+			}
+			header += 5
+		}
+		if len(pl.tlvs) == 0 {
+			return nil, nil
+		}
+		value, err := removeTlv(data[header:], pl.tlvs)
+		if err != nil || len(value) == 0 {
+			return nil, err
+		}
+		return &radius.AVP{Type: avp.Type, Attribute: append(slices.Clone(data[:header]), value...)}, nil
+	}
+
+	if len(pl.tlvs) == 0 {
+		return nil, nil
+	}
+	value, err := removeTlv(data, pl.tlvs)
+	if err != nil || len(value) == 0 {
+		return nil, err
+	}
+	return &radius.AVP{Type: avp.Type, Attribute: value}, nil
+}
+
+// wireAttribute is an attribute found in a packet. attribute is nil when
+// the dictionary does not know it.
+type wireAttribute struct {
+	attribute *Attribute
+	vendor    *Vendor
+	code      []int
+	data      radius.Attribute
+	// evs is set for vendor attributes of an Extended-Vendor-Specific
+	// attribute
+	evs bool
+	// container is set for TLVs whose members were decoded
+	container bool
+}
+
+// walkLocked calls fn for every attribute of p, containers before their
+// members.
+func (d *Dictionary) walkLocked(p *radius.Packet, fn func(wireAttribute)) {
+	for _, avp := range d.logicalAttributesLocked(p.Attributes) {
+		typ := int(avp.Type)
+		data := avp.Attribute
+
+		switch kind := d.topLevelTypeLocked(typ); kind {
+		case TypeVsa:
+			vendorId, value, err := radius.VendorSpecific(data)
+			vendor := d.vendorsById[vendorId]
+			if err != nil || vendor == nil {
+				fn(wireAttribute{attribute: d.attributesByKey[attributeKey{oid: strconv.Itoa(typ)}], code: []int{typ}, data: data})
+				continue
+			}
+			members := []wireAttribute{}
+			err = eachVendorAttribute(vendor, value, func(vendorType int, data []byte) error {
+				members = append(members, wireAttribute{vendor: vendor, code: []int{vendorType}, data: data})
+				return nil
+			})
+			if err != nil {
+				fn(wireAttribute{attribute: d.attributesByKey[attributeKey{oid: strconv.Itoa(typ)}], code: []int{typ}, data: data})
+				continue
+			}
+			for _, member := range members {
+				d.walkTlvLocked(member, fn)
+			}
+		case TypeExtended, TypeLongExtended:
+			header := 1
+			if kind == TypeLongExtended {
+				header = 2
+			}
+			if len(data) < header {
+				fn(wireAttribute{attribute: d.attributesByKey[attributeKey{oid: strconv.Itoa(typ)}], code: []int{typ}, data: data})
+				continue
+			}
+			code := []int{typ, int(data[0])}
+			value := data[header:]
+			if evs := d.attributesByKey[attributeKey{oid: oid(code)}]; evs.isEvs() && len(value) >= 5 {
+				if vendor := d.vendorsById[binary.BigEndian.Uint32(value)]; vendor != nil {
+					d.walkTlvLocked(wireAttribute{vendor: vendor, code: append(code, int(value[4])), data: value[5:], evs: true}, fn)
+					continue
+				}
+			}
+			d.walkTlvLocked(wireAttribute{code: code, data: value}, fn)
+		default:
+			d.walkTlvLocked(wireAttribute{code: []int{typ}, data: data}, fn)
+		}
+	}
+}
+
+// walkTlvLocked resolves found and walks its members when it is a TLV.
+func (d *Dictionary) walkTlvLocked(found wireAttribute, fn func(wireAttribute)) {
+	vendorId := uint32(0)
+	if found.vendor != nil {
+		vendorId = found.vendor.Id
+	}
+	found.attribute = d.attributesByKey[attributeKey{vendorId: vendorId, oid: oid(found.code)}]
+	if found.attribute == nil || found.attribute.Type != TypeTlv {
+		fn(found)
+		return
+	}
+	tlvs, err := parseTlvs(found.data)
+	found.container = err == nil
+	fn(found)
+	for _, tlv := range tlvs {
+		member := found
+		member.code = append(slices.Clone(found.code), tlv.typ)
+		member.data = tlv.value
+		member.container = false
+		d.walkTlvLocked(member, fn)
+	}
+}
+
+// logicalAttributesLocked returns attributes with the fragments of long
+// extended attributes joined. The More flag of joined attributes is cleared.
+func (d *Dictionary) logicalAttributesLocked(attributes radius.Attributes) radius.Attributes {
+	logical := radius.Attributes{}
+	var pending *radius.AVP
+	for _, avp := range attributes {
+		data := avp.Attribute
+		if d.topLevelTypeLocked(int(avp.Type)) != TypeLongExtended || len(data) < 2 {
+			pending = nil
+			logical = append(logical, avp)
+			continue
+		}
+		if pending != nil && pending.Type == avp.Type && pending.Attribute[0] == data[0] {
+			pending.Attribute = append(pending.Attribute, data[2:]...)
+		} else {
+			pending = &radius.AVP{Type: avp.Type, Attribute: slices.Clone(data)}
+			pending.Attribute[1] &^= longExtendedMoreFlag
+			logical = append(logical, pending)
+		}
+		if data[1]&longExtendedMoreFlag == 0 {
+			pending = nil
+		}
+	}
+	return logical
+}
+
+// wireAttributesLocked reverses logicalAttributesLocked.
+func (d *Dictionary) wireAttributesLocked(logical radius.Attributes) radius.Attributes {
+	attributes := radius.Attributes{}
+	for _, avp := range logical {
+		if d.topLevelTypeLocked(int(avp.Type)) == TypeLongExtended && len(avp.Attribute) >= 2 {
+			attributes = append(attributes, fragmentLongExtended(avp)...)
+			continue
+		}
+		attributes = append(attributes, avp)
+	}
+	return attributes
+}
+
+// fragmentLongExtended splits a long extended attribute, whose value starts
+// with the Extended-Type and flags, into attributes of at most 255 bytes.
+func fragmentLongExtended(avp *radius.AVP) radius.Attributes {
+	header := avp.Attribute[:2]
+	value := avp.Attribute[2:]
+	size := maxAttributeValueLength - len(header)
+
+	fragments := radius.Attributes{}
+	for {
+		chunk := value
+		more := len(value) > size
+		if more {
+			chunk = value[:size]
+		}
+		fragment := append(slices.Clone(header), chunk...)
+		if more {
+			fragment[1] |= longExtendedMoreFlag
+		}
+		fragments = append(fragments, &radius.AVP{Type: avp.Type, Attribute: fragment})
+		value = value[len(chunk):]
+		if !more {
+			return fragments
+		}
+	}
+}
+
+type tlv struct {
+	typ   int
+	value []byte
+}
+
+// parseTlvs splits the value of a tlv attribute into its members
+// (RFC 6929 section 2.3).
+func parseTlvs(data []byte) ([]tlv, error) {
+	tlvs := []tlv{}
+	for len(data) > 0 {
+		if len(data) < 2 || int(data[1]) < 2 || int(data[1]) > len(data) {
+			return nil, errMalformedTlv
+		}
+		tlvs = append(tlvs, tlv{typ: int(data[0]), value: data[2:data[1]]})
+		data = data[data[1]:]
+	}
+	return tlvs, nil
+}
+
+// wrapTlvs nests data in TLVs of the given types, outermost first.
+func wrapTlvs(path []int, data []byte) ([]byte, error) {
+	for i := len(path) - 1; i >= 0; i-- {
+		if len(data) > maxAttributeValueLength {
+			return nil, errors.New("value too long")
+		}
+		data = append([]byte{byte(path[i]), byte(len(data) + 2)}, data...)
+	}
+	return data, nil
+}
+
+// removeTlv returns the TLVs of data without the member at path.
+func removeTlv(data []byte, path []int) ([]byte, error) {
+	tlvs, err := parseTlvs(data)
+	if err != nil {
+		return nil, err
+	}
+	kept := []byte{}
+	for _, tlv := range tlvs {
+		value := tlv.value
+		if tlv.typ == path[0] {
+			if len(path) == 1 {
+				continue
+			}
+			if value, err = removeTlv(value, path[1:]); err != nil {
+				return nil, err
+			}
+			if len(value) == 0 {
+				continue
+			}
+		}
+		kept = append(kept, byte(tlv.typ), byte(len(value)+2))
+		kept = append(kept, value...)
+	}
+	return kept, nil
+}
+
+// vendorAttribute encodes one attribute inside a Vendor-Specific attribute,
+// with the type and length widths of the vendor format.
+func vendorAttribute(vendor *Vendor, typ int, data []byte) radius.Attribute {
+	header := vendor.TypeOctets + vendor.LengthOctets
+	encoded := make(radius.Attribute, header+len(data))
+	putUint(encoded[:vendor.TypeOctets], uint64(typ))
+	putUint(encoded[vendor.TypeOctets:header], uint64(header+len(data)))
+	copy(encoded[header:], data)
+	return encoded
+}
+
+// eachVendorAttribute calls fn for every attribute inside the value of a
+// Vendor-Specific attribute. Vendors without a length field carry a single
+// attribute.
+func eachVendorAttribute(vendor *Vendor, value []byte, fn func(typ int, data []byte) error) error {
+	header := vendor.TypeOctets + vendor.LengthOctets
+	for len(value) > 0 {
+		if len(value) < header {
+			return errors.New("invalid vendor attribute")
+		}
+		typ := int(readUint(value[:vendor.TypeOctets]))
+		length := len(value)
+		if vendor.LengthOctets > 0 {
+			length = int(readUint(value[vendor.TypeOctets:header]))
+		}
+		if length < header || length > len(value) {
+			return errors.New("invalid vendor attribute length")
+		}
+		if err := fn(typ, value[header:length]); err != nil {
+			return err
+		}
+		value = value[length:]
+	}
+	return nil
+}
+
+func putUint(b []byte, value uint64) {
+	switch len(b) {
+	case 1:
+		b[0] = byte(value)
+	case 2:
+		binary.BigEndian.PutUint16(b, uint16(value))
+	case 4:
+		binary.BigEndian.PutUint32(b, uint32(value))
+	}
+}
+
+func readUint(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
@@ -0,0 +1,157 @@
+package radius
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls/v3"
+	"github.com/pion/dtls/v3/pkg/protocol/handshake"
+)
+
+// Resumable RADIUS/DTLS sessions. The DTLS library never stores the sessions
+// of clients that presented a certificate, so the session id announced in
+// the ServerHello is recorded by serverHello and the session is stored by
+// save once its certificate was mapped to a NAS. The certificate chain is
+// kept with the session, so a resumed association is verified and mapped
+// again without a new full handshake.
+
+const maxDtlsSessions = 10000
+
+type dtlsSession struct {
+	secret           []byte
+	peerCertificates [][]byte
+	expiresAt        time.Time
+}
+
+type dtlsHello struct {
+	sessionId []byte
+	expiresAt time.Time
+}
+
+// dtlsSessionCache implements dtls.SessionStore for the server side.
+type dtlsSessionCache struct {
+	mu          sync.Mutex
+	sessions    map[string]dtlsSession
+	hellos      map[[handshake.RandomLength]byte]dtlsHello
+	ttl         time.Duration
+	lastCleanup time.Time
+}
+
+func newDtlsSessionCache(ttl time.Duration) *dtlsSessionCache {
+	return &dtlsSessionCache{
+		sessions:    map[string]dtlsSession{},
+		hellos:      map[[handshake.RandomLength]byte]dtlsHello{},
+		ttl:         ttl,
+		lastCleanup: time.Now(),
+	}
+}
+
+// Set is only called by the library for sessions without client
+// certificate, which the listeners refuse.
+func (c *dtlsSessionCache) Set(key []byte, session dtls.Session) error {
+	return nil
+}
+
+// Get returns the live session of a session id, an empty session when there
+// is none so the client goes through a full handshake.
+func (c *dtlsSessionCache) Get(key []byte) (dtls.Session, error) {
+	session, ok := c.session(key)
+	if !ok {
+		return dtls.Session{}, nil
+	}
+	return dtls.Session{ID: key, Secret: session.secret}, nil
+}
+
+func (c *dtlsSessionCache) Del(key []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, string(key))
+	return nil
+}
+
+// serverHello records the session id of a full handshake by server random,
+// for dtls.WithServerHelloMessageHook.
+func (c *dtlsSessionCache) serverHello(hello handshake.MessageServerHello) handshake.Message {
+	if len(hello.SessionID) > 0 {
+		c.mu.Lock()
+		c.cleanupLocked(time.Now())
+		if len(c.hellos) < maxDtlsSessions {
+			c.hellos[hello.Random.MarshalFixed()] = dtlsHello{
+				sessionId: append([]byte{}, hello.SessionID...),
+				expiresAt: time.Now().Add(radSecHandshakeTimeout),
+			}
+		}
+		c.mu.Unlock()
+	}
+	return &hello
+}
+
+// save stores the session of a full handshake, once its client certificate
+// is mapped to a NAS. When the cache is full the session is simply not
+// resumable.
+func (c *dtlsSessionCache) save(state dtls.State) error {
+	// the server random and master secret are only exposed by the binary
+	// form of the state
+	encoded, err := state.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	var keys struct {
+		LocalRandom  [handshake.RandomLength]byte
+		MasterSecret []byte
+	}
+	if err := gob.NewDecoder(bytes.NewReader(encoded)).Decode(&keys); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hello, ok := c.hellos[keys.LocalRandom]
+	delete(c.hellos, keys.LocalRandom)
+	if !ok || len(keys.MasterSecret) == 0 || len(c.sessions) >= maxDtlsSessions {
+		return nil
+	}
+	c.sessions[string(hello.sessionId)] = dtlsSession{
+		secret:           keys.MasterSecret,
+		peerCertificates: state.PeerCertificates,
+		expiresAt:        time.Now().Add(c.ttl),
+	}
+	return nil
+}
+
+// peerCertificates returns the certificate chain a resumed session was
+// established with.
+func (c *dtlsSessionCache) peerCertificates(sessionId []byte) ([][]byte, bool) {
+	session, ok := c.session(sessionId)
+	return session.peerCertificates, ok
+}
+
+func (c *dtlsSessionCache) session(sessionId []byte) (dtlsSession, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	session, ok := c.sessions[string(sessionId)]
+	if !ok || !time.Now().Before(session.expiresAt) {
+		return dtlsSession{}, false
+	}
+	return session, true
+}
+
+func (c *dtlsSessionCache) cleanupLocked(now time.Time) {
+	if now.Sub(c.lastCleanup) < radSecHandshakeTimeout {
+		return
+	}
+	for key, session := range c.sessions {
+		if !now.Before(session.expiresAt) {
+			delete(c.sessions, key)
+		}
+	}
+	for random, hello := range c.hellos {
+		if !now.Before(hello.expiresAt) {
+			delete(c.hellos, random)
+		}
+	}
+	c.lastCleanup = now
+}
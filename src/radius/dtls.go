@@ -0,0 +1,163 @@
+package radius
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"radius-server/src/config"
+	"radius-server/src/database/entities"
+	"radius-server/src/radius/revocation"
+	networkUtil "radius-server/src/utils/network"
+	timeUtil "radius-server/src/utils/time"
+
+	"github.com/pion/dtls/v3"
+	"layeh.com/radius"
+)
+
+// RADIUS over DTLS (RFC 7360). Each DTLS association is served like a RadSec
+// connection, with one RADIUS packet per record. Sessions are resumable for
+// RADSEC_DTLS_SESSION_TTL_SEC, a resumed session is mapped to the NAS of the
+// certificate it was established with. Associations also negotiate
+// connection IDs (RFC 9146): a NAS behind NAT keeps its association when its
+// source address or port changes, without a new handshake.
+
+const (
+	dtlsSecret             = "radius/dtls"
+	dtlsConnectionIdLength = 8
+)
+
+// dtlsListeners creates one DTLS listener per configured bind host, serving
+// access and accounting requests on the same port.
+func dtlsListeners(hosts []string, port int, handler radius.Handler) ([]listener, error) {
+	certificate, clientCas, err := loadRadSecCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	options := []dtls.ServerOption{
+		dtls.WithCertificates(certificate),
+		dtls.WithClientAuth(dtls.RequireAndVerifyClientCert),
+		dtls.WithClientCAs(clientCas),
+		dtls.WithVerifyPeerCertificate(revocation.VerifyPeerCertificate),
+		dtls.WithExtendedMasterSecret(dtls.RequireExtendedMasterSecret),
+		dtls.WithConnectionIDGenerator(dtls.RandomCIDGenerator(dtlsConnectionIdLength)),
+	}
+	var sessions *dtlsSessionCache
+	if ttl := config.AppConfig.RadiusServer.RadSec.DtlsSessionTtlSec; ttl > 0 {
+		sessions = newDtlsSessionCache(timeUtil.DurationSeconds(ttl))
+		options = append(options,
+			dtls.WithSessionStore(sessions),
+			dtls.WithServerHelloMessageHook(sessions.serverHello),
+		)
+	}
+
+	server := &connServer{
+		name:    "RadSec DTLS",
+		handler: handler,
+		authenticate: func(conn net.Conn) (*entities.RadiusNas, []byte, error) {
+			return authenticateDtlsConn(conn, clientCas, sessions)
+		},
+		idleTimeout: timeUtil.DurationSeconds(config.AppConfig.RadiusServer.RadSec.IdleTimeoutSec),
+		datagram:    true,
+	}
+
+	listeners := []listener{}
+	for _, host := range hosts {
+		network := networkUtil.ListenNetwork("udp", host)
+		address := net.JoinHostPort(host, strconv.Itoa(port))
+		listeners = append(listeners, listener{
+			name:    server.name,
+			network: network,
+			address: address,
+			serve: func() error {
+				udpAddr, err := net.ResolveUDPAddr(network, address)
+				if err != nil {
+					return err
+				}
+				l, err := dtls.ListenWithOptions(network, udpAddr, options...)
+				if err != nil {
+					return err
+				}
+				return server.Serve(l)
+			},
+		})
+	}
+	return listeners, nil
+}
+
+// authenticateDtlsConn completes the handshake and maps the verified client
+// certificate to a NAS. The certificate of a resumed session is verified
+// again, it may have expired or been revoked since the full handshake.
+func authenticateDtlsConn(conn net.Conn, clientCas *x509.CertPool, sessions *dtlsSessionCache) (*entities.RadiusNas, []byte, error) {
+	dtlsConn, ok := conn.(*dtls.Conn)
+	if !ok {
+		return nil, nil, errors.New("not a DTLS connection")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), radSecHandshakeTimeout)
+	defer cancel()
+	if err := dtlsConn.HandshakeContext(ctx); err != nil {
+		return nil, nil, fmt.Errorf("DTLS handshake: %w", err)
+	}
+
+	state, ok := dtlsConn.ConnectionState()
+	if !ok {
+		return nil, nil, errors.New("no connection state")
+	}
+	peerCertificates := state.PeerCertificates
+	resumed := len(peerCertificates) == 0 && len(state.SessionID) > 0 && sessions != nil
+	if resumed {
+		if peerCertificates, ok = sessions.peerCertificates(state.SessionID); !ok {
+			return nil, nil, errors.New("unknown resumed session")
+		}
+	}
+	if len(peerCertificates) == 0 {
+		return nil, nil, errors.New("no client certificate")
+	}
+	certificates := make([]*x509.Certificate, 0, len(peerCertificates))
+	for _, raw := range peerCertificates {
+		certificate, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse client certificate: %w", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if resumed {
+		if err := verifyResumedCertificate(certificates, clientCas); err != nil {
+			sessions.Del(state.SessionID)
+			return nil, nil, err
+		}
+	}
+	nas, err := radSecNas(certificateIdentities(certificates[0]))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !resumed && sessions != nil {
+		if err := sessions.save(state); err != nil {
+			return nil, nil, fmt.Errorf("save DTLS session: %w", err)
+		}
+	}
+	return nas, []byte(dtlsSecret), nil
+}
+
+// verifyResumedCertificate repeats the verification of a full handshake.
+func verifyResumedCertificate(certificates []*x509.Certificate, clientCas *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	chains, err := certificates[0].Verify(x509.VerifyOptions{
+		Roots:         clientCas,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("verify resumed client certificate: %w", err)
+	}
+	return revocation.VerifyPeerCertificate(nil, chains)
+}
@@ -0,0 +1,217 @@
+package dynauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"radius-server/src/cache"
+	"radius-server/src/config"
+	"radius-server/src/database/entities"
+	"radius-server/src/metrics"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2866"
+	"layeh.com/radius/rfc2869"
+	"layeh.com/radius/rfc3162"
+	"layeh.com/radius/rfc3576"
+)
+
+// Dynamic Authorization client (RFC 5176). Requests are sent to the NAS that
+// owns the session on the configured CoA port and retransmitted until the
+// NAS answers or the request times out.
+
+const (
+	requestTimeout   = 5 * time.Second
+	retransmitPeriod = time.Second
+)
+
+var (
+	ErrNasNotFound = errors.New("NAS not found")
+	ErrNoResponse  = errors.New("NAS did not respond")
+)
+
+type Result struct {
+	Acknowledged bool    `json:"acknowledged"`
+	Code         string  `json:"code"`
+	ErrorCause   *string `json:"error_cause"`
+	ReplyMessage *string `json:"reply_message"`
+}
+
+// CoaAttributes are the authorization changes that can be pushed to a session.
+type CoaAttributes struct {
+	SessionTimeout      *uint32 `json:"session_timeout"`
+	IdleTimeout         *uint32 `json:"idle_timeout"`
+	AcctInterimInterval *uint32 `json:"acct_interim_interval"`
+	FilterId            *string `json:"filter_id"`
+}
+
+func (a CoaAttributes) IsEmpty() bool {
+	return a.SessionTimeout == nil && a.IdleTimeout == nil && a.AcctInterimInterval == nil && a.FilterId == nil
+}
+
+// newClient creates a client bound to the first literal COA_HANDLER_SERVER_HOST
+// of the NAS address family, so NAS boxes that check the source address of
+// dynamic authorization requests accept them.
+func newClient(nasAddr netip.Addr) *radius.Client {
+	client := &radius.Client{
+		Retry:           retransmitPeriod,
+		MaxPacketErrors: 10,
+	}
+	for _, host := range config.AppConfig.RadiusServer.CoaHandlerServerHosts {
+		localAddr, err := netip.ParseAddr(host)
+		if err != nil {
+			continue
+		}
+		localAddr = localAddr.Unmap()
+		if localAddr.IsUnspecified() || localAddr.Is4() != nasAddr.Is4() {
+			continue
+		}
+		client.Dialer.LocalAddr = &net.UDPAddr{IP: localAddr.AsSlice()}
+		break
+	}
+	return client
+}
+
+// Disconnect sends a Disconnect-Request for the session.
+func Disconnect(ctx context.Context, session *entities.RadiusSession) (*Result, error) {
+	return exchange(ctx, radius.CodeDisconnectRequest, metrics.Disconnect, session, nil)
+}
+
+// ChangeOfAuthorization sends a CoA-Request carrying the given attributes.
+func ChangeOfAuthorization(ctx context.Context, session *entities.RadiusSession, attributes CoaAttributes) (*Result, error) {
+	return exchange(ctx, radius.CodeCoARequest, metrics.CoA, session, func(p *radius.Packet) error {
+		if attributes.SessionTimeout != nil {
+			if err := rfc2865.SessionTimeout_Set(p, rfc2865.SessionTimeout(*attributes.SessionTimeout)); err != nil {
+				return err
+			}
+		}
+		if attributes.IdleTimeout != nil {
+			if err := rfc2865.IdleTimeout_Set(p, rfc2865.IdleTimeout(*attributes.IdleTimeout)); err != nil {
+				return err
+			}
+		}
+		if attributes.AcctInterimInterval != nil {
+			if err := rfc2869.AcctInterimInterval_Set(p, rfc2869.AcctInterimInterval(*attributes.AcctInterimInterval)); err != nil {
+				return err
+			}
+		}
+		if attributes.FilterId != nil {
+			if err := rfc2865.FilterID_SetString(p, *attributes.FilterId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func exchange(ctx context.Context, code radius.Code, requestType metrics.RadiusRequestTypes, session *entities.RadiusSession, build func(p *radius.Packet) error) (*Result, error) {
+	start := time.Now()
+	result, err := send(ctx, code, session, build)
+	status := metrics.Failure
+	if err == nil && result.Acknowledged {
+		status = metrics.Success
+	}
+	metrics.CreateRequestMetric(requestType, status, time.Since(start).Seconds())
+	return result, err
+}
+
+func send(ctx context.Context, code radius.Code, session *entities.RadiusSession, build func(p *radius.Packet) error) (*Result, error) {
+	nas, err := cache.GetNasByIp(session.NasIpAddress)
+	if err != nil {
+		return nil, err
+	}
+	if nas == nil {
+		return nil, ErrNasNotFound
+	}
+
+	packet := radius.New(code, []byte(nas.Secret))
+	if err := addSessionIdentification(packet, session); err != nil {
+		return nil, err
+	}
+	if build != nil {
+		if err := build(packet); err != nil {
+			return nil, err
+		}
+	}
+
+	nasAddr, err := netip.ParseAddr(session.NasIpAddress)
+	if err != nil {
+		return nil, err
+	}
+	nasAddr = nasAddr.Unmap()
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(nasAddr.String(), strconv.Itoa(config.AppConfig.RadiusServer.CoaHandlerServerPort))
+	response, err := newClient(nasAddr).Exchange(ctx, packet, address)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, ErrNoResponse
+		}
+		return nil, err
+	}
+
+	return parseResult(response)
+}
+
+// addSessionIdentification adds the attributes the NAS uses to find the
+// session (RFC 5176 section 3).
+func addSessionIdentification(p *radius.Packet, session *entities.RadiusSession) error {
+	if err := rfc2866.AcctSessionID_SetString(p, session.AcctSessionId); err != nil {
+		return err
+	}
+	if nasIp := net.ParseIP(session.NasIpAddress); nasIp != nil {
+		if nasIp.To4() != nil {
+			if err := rfc2865.NASIPAddress_Set(p, nasIp); err != nil {
+				return err
+			}
+		} else if err := rfc3162.NASIPv6Address_Set(p, nasIp); err != nil {
+			return err
+		}
+	}
+	if session.Username != nil {
+		if err := rfc2865.UserName_SetString(p, *session.Username); err != nil {
+			return err
+		}
+	}
+	if session.FramedIpAddress != nil {
+		if framedIp := net.ParseIP(*session.FramedIpAddress); framedIp != nil && framedIp.To4() != nil {
+			if err := rfc2865.FramedIPAddress_Set(p, framedIp); err != nil {
+				return err
+			}
+		}
+	}
+	if session.CallingStationId != nil {
+		if err := rfc2865.CallingStationID_SetString(p, *session.CallingStationId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseResult(response *radius.Packet) (*Result, error) {
+	result := &Result{Code: response.Code.String()}
+	switch response.Code {
+	case radius.CodeDisconnectACK, radius.CodeCoAACK:
+		result.Acknowledged = true
+	case radius.CodeDisconnectNAK, radius.CodeCoANAK:
+		result.Acknowledged = false
+	default:
+		return nil, fmt.Errorf("unexpected response code %s", response.Code)
+	}
+	if errorCause, err := rfc3576.ErrorCause_Lookup(response); err == nil {
+		value := errorCause.String()
+		result.ErrorCause = &value
+	}
+	if replyMessage := rfc2865.ReplyMessage_GetString(response); replyMessage != "" {
+		result.ReplyMessage = &replyMessage
+	}
+	return result, nil
+}
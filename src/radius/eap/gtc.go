@@ -0,0 +1,31 @@
+package eap
+
+// EAP-GTC (RFC 3748 section 5.6). The password is sent in clear text, so it
+// belongs inside a tunnel such as PEAP or TTLS, and is checked against the
+// stored password whatever its form.
+
+const gtcPrompt = "Password: "
+
+type gtcMethod struct {
+	credentials Credentials
+}
+
+// NewGtc creates an EAP-GTC method.
+func NewGtc(identity string, users Users) (Method, error) {
+	credentials, err := userCredentials(users, identity)
+	if err != nil {
+		return nil, err
+	}
+	return &gtcMethod{credentials: credentials}, nil
+}
+
+func (m *gtcMethod) Start() ([]byte, error) {
+	return []byte(gtcPrompt), nil
+}
+
+func (m *gtcMethod) Process(response *Packet) (Outcome, []byte, error) {
+	if len(response.Data) == 0 || !m.credentials.VerifyPassword(string(response.Data)) {
+		return OutcomeFailure, nil, nil
+	}
+	return OutcomeSuccess, nil, nil
+}
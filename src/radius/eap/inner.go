@@ -0,0 +1,97 @@
+package eap
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Inner EAP conversations of the tunneled methods. As in the outer
+// conversation, the first method available to the user is proposed and the
+// peer may ask for another one with a Nak.
+
+// innerMethods are the methods an inner conversation can run.
+var innerMethods = map[Type]NewMethod{
+	TypeMschapv2:     NewMschapv2,
+	TypeGtc:          NewGtc,
+	TypeMd5Challenge: NewMd5,
+}
+
+// innerExchange sends an inner request of type t and returns the response
+// of the peer.
+type innerExchange func(t Type, data []byte) (*Packet, error)
+
+// authenticateInner authenticates identity with the enabled methods, in
+// their order of preference.
+func authenticateInner(identity string, users Users, enabled []Type, exchange innerExchange) error {
+	candidates := enabled
+	offered := []Type{}
+	for {
+		t, method, err := proposeInner(identity, users, enabled, candidates, offered)
+		if err != nil {
+			return err
+		}
+		offered = append(offered, t)
+		candidates, err = runInner(t, method, exchange)
+		if err != nil || candidates == nil {
+			return err
+		}
+	}
+}
+
+// proposeInner creates the first of the candidate methods that is enabled,
+// not offered yet and available to the user.
+func proposeInner(identity string, users Users, enabled, candidates, offered []Type) (Type, Method, error) {
+	for _, t := range candidates {
+		if !slices.Contains(enabled, t) || slices.Contains(offered, t) {
+			continue
+		}
+		method, err := innerMethods[t](identity, users)
+		if errors.Is(err, ErrMethodUnavailable) {
+			continue
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("inner identity %s: %w", identity, err)
+		}
+		return t, method, nil
+	}
+	return 0, nil, errors.New("no inner eap method available")
+}
+
+// runInner runs an inner method until it ends. When the peer refuses it, the
+// methods it asked for are returned.
+func runInner(t Type, method Method, exchange innerExchange) ([]Type, error) {
+	data, err := method.Start()
+	if err != nil {
+		return nil, err
+	}
+	responded := false
+	for {
+		response, err := exchange(t, data)
+		if err != nil {
+			return nil, err
+		}
+		if response.Type == TypeNak && !responded {
+			candidates := []Type{}
+			for _, requested := range response.Data {
+				candidates = append(candidates, Type(requested))
+			}
+			return candidates, nil
+		}
+		if response.Type != t {
+			return nil, fmt.Errorf("unexpected inner %s response to %s", response.Type, t)
+		}
+		responded = true
+
+		var outcome Outcome
+		outcome, data, err = method.Process(response)
+		switch {
+		case err != nil:
+			return nil, err
+		case outcome == OutcomeSuccess:
+			return nil, nil
+		case outcome == OutcomeFailure:
+			return nil, fmt.Errorf("inner %s authentication failed", t)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package eap
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+)
+
+// EAP-MD5 (RFC 3748 section 5.4), the CHAP exchange over EAP. It needs the
+// cleartext password and offers no key material, so it is only fit for
+// wired 802.1X.
+
+const md5ChallengeLength = 16
+
+type md5Method struct {
+	password  string
+	challenge []byte
+}
+
+// NewMd5 creates an EAP-MD5 method, available to users with a cleartext
+// password.
+func NewMd5(identity string, users Users) (Method, error) {
+	credentials, err := userCredentials(users, identity)
+	if err != nil {
+		return nil, err
+	}
+	password, ok := credentials.CleartextPassword()
+	if !ok {
+		return nil, ErrMethodUnavailable
+	}
+	return &md5Method{password: password}, nil
+}
+
+func (m *md5Method) Start() ([]byte, error) {
+	m.challenge = make([]byte, md5ChallengeLength)
+	if _, err := rand.Read(m.challenge); err != nil {
+		return nil, err
+	}
+	return append([]byte{md5ChallengeLength}, m.challenge...), nil
+}
+
+func (m *md5Method) Process(response *Packet) (Outcome, []byte, error) {
+	if len(response.Data) < 1+md5.Size || response.Data[0] != md5.Size {
+		return OutcomeFailure, nil, errors.New("malformed EAP-MD5 response")
+	}
+
+	// The identifier of a response is the one of the request it answers
+	hash := md5.New()
+	hash.Write([]byte{response.Identifier})
+	hash.Write([]byte(m.password))
+	hash.Write(m.challenge)
+	if subtle.ConstantTimeCompare(hash.Sum(nil), response.Data[1:1+md5.Size]) != 1 {
+		return OutcomeFailure, nil, nil
+	}
+	return OutcomeSuccess, nil, nil
+}
@@ -0,0 +1,87 @@
+package eap
+
+import "errors"
+
+var (
+	// ErrMethodUnavailable is returned by a method constructor when the
+	// credentials of the user cannot be used with the method, e.g. EAP-MD5
+	// for a user without a cleartext password.
+	ErrMethodUnavailable = errors.New("eap method unavailable for this user")
+	// ErrUnknownUser is returned when the identity is not a user allowed to
+	// authenticate.
+	ErrUnknownUser = errors.New("unknown or disallowed user")
+)
+
+// Credentials gives methods access to the secrets of the authenticating user,
+// without tying them to how they are stored.
+type Credentials interface {
+	// CleartextPassword returns the cleartext password, when it is stored.
+	CleartextPassword() (string, bool)
+	// VerifyPassword reports whether password is the password of the user.
+	VerifyPassword(password string) bool
+	// NtPasswordHash returns the NT hash of the password, when it is stored
+	// or can be computed.
+	NtPasswordHash() ([]byte, bool)
+}
+
+// Users resolves the identities a conversation authenticates, the outer
+// identity and the inner identity of tunneled methods.
+type Users interface {
+	// Credentials returns the credentials of identity, nil when it is not a
+	// user allowed to authenticate.
+	Credentials(identity string) (Credentials, error)
+}
+
+// userCredentials returns the credentials of identity, ErrUnknownUser when
+// there are none.
+func userCredentials(users Users, identity string) (Credentials, error) {
+	credentials, err := users.Credentials(identity)
+	if err != nil {
+		return nil, err
+	}
+	if credentials == nil {
+		return nil, ErrUnknownUser
+	}
+	return credentials, nil
+}
+
+// Outcome is the state of a method after a response.
+type Outcome int
+
+const (
+	// OutcomeContinue sends the next request of the method
+	OutcomeContinue Outcome = iota
+	OutcomeSuccess
+	OutcomeFailure
+)
+
+// Method is one authentication method of a single conversation.
+type Method interface {
+	// Start returns the type data of the first request.
+	Start() ([]byte, error)
+	// Process handles a response of the peer. With OutcomeContinue it returns
+	// the type data of the next request.
+	Process(response *Packet) (Outcome, []byte, error)
+}
+
+// KeyingMethod is implemented by methods deriving key material for the NAS.
+type KeyingMethod interface {
+	// Msk returns the Master Session Key once the method succeeded.
+	Msk() []byte
+}
+
+// TunneledMethod is implemented by methods authenticating an inner identity
+// inside a TLS tunnel, the outer identity being only used for routing.
+type TunneledMethod interface {
+	// InnerIdentity returns the identity sent inside the tunnel, empty until
+	// the peer sent it.
+	InnerIdentity() string
+}
+
+// Methods holding resources, such as the TLS connection of EAP-TLS, also
+// implement io.Closer. Close is called when the conversation ends or
+// expires.
+
+// NewMethod creates a method for a conversation of identity. Methods resolve
+// the credentials of the identities they authenticate with users.
+type NewMethod func(identity string, users Users) (Method, error)
@@ -0,0 +1,110 @@
+package eap
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"radius-server/src/radius/mschap"
+)
+
+// EAP-MSCHAPv2 (draft-kamath-pppext-eap-mschapv2), the MS-CHAPv2 exchange
+// of RFC 2759 over EAP, checked against the NT hash of the user. The peer
+// acknowledges the Success or Failure request before the method ends. It is
+// only offered inside PEAP.
+
+const (
+	mschapv2OpChallenge = 1
+	mschapv2OpResponse  = 2
+	mschapv2OpSuccess   = 3
+	mschapv2OpFailure   = 4
+
+	mschapv2HeaderLength    = 4
+	mschapv2ChallengeLength = 16
+	// mschapv2ValueLength is the peer challenge, 8 reserved bytes, the
+	// NT-Response and the flags
+	mschapv2ValueLength = 49
+	mschapv2ServerName  = "radius-server"
+
+	mschapv2ErrorAuthFailure = 691
+)
+
+type mschapv2Method struct {
+	ntHash    []byte
+	id        uint8
+	challenge []byte
+	// result is the outcome announced by the last request, the peer
+	// acknowledges it with the same opcode
+	result   Outcome
+	resultOp uint8
+}
+
+// NewMschapv2 creates an EAP-MSCHAPv2 method, available to users whose NT
+// hash is known.
+func NewMschapv2(identity string, users Users) (Method, error) {
+	credentials, err := userCredentials(users, identity)
+	if err != nil {
+		return nil, err
+	}
+	ntHash, ok := credentials.NtPasswordHash()
+	if !ok {
+		return nil, ErrMethodUnavailable
+	}
+	return &mschapv2Method{ntHash: ntHash}, nil
+}
+
+func (m *mschapv2Method) Start() ([]byte, error) {
+	random := make([]byte, 1+mschapv2ChallengeLength)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	m.id = random[0]
+	m.challenge = random[1:]
+
+	value := append([]byte{mschapv2ChallengeLength}, m.challenge...)
+	return m.request(mschapv2OpChallenge, append(value, mschapv2ServerName...)), nil
+}
+
+func (m *mschapv2Method) Process(response *Packet) (Outcome, []byte, error) {
+	data := response.Data
+	if m.resultOp != 0 {
+		if len(data) < 1 || data[0] != m.resultOp {
+			return OutcomeFailure, nil, errors.New("EAP-MSCHAPv2 result not acknowledged")
+		}
+		return m.result, nil, nil
+	}
+
+	if len(data) < mschapv2HeaderLength+1+mschapv2ValueLength || data[0] != mschapv2OpResponse ||
+		data[1] != m.id || data[mschapv2HeaderLength] != mschapv2ValueLength {
+		return OutcomeFailure, nil, errors.New("malformed EAP-MSCHAPv2 response")
+	}
+	value := data[mschapv2HeaderLength+1 : mschapv2HeaderLength+1+mschapv2ValueLength]
+	peerChallenge := value[0:16]
+	peerResponse := value[24:48]
+	challengeUsername := mschap.ChallengeUsername(string(data[mschapv2HeaderLength+1+mschapv2ValueLength:]))
+
+	ntResponse := mschap.NtResponse(m.challenge, peerChallenge, challengeUsername, m.ntHash)
+	if subtle.ConstantTimeCompare(ntResponse, peerResponse) != 1 {
+		m.result, m.resultOp = OutcomeFailure, mschapv2OpFailure
+		message := fmt.Sprintf("E=%d R=0 C=%s V=3 M=Authentication failed",
+			mschapv2ErrorAuthFailure, strings.ToUpper(hex.EncodeToString(m.challenge)))
+		return OutcomeContinue, m.request(mschapv2OpFailure, []byte(message)), nil
+	}
+
+	m.result, m.resultOp = OutcomeSuccess, mschapv2OpSuccess
+	message := mschap.AuthenticatorResponse(m.challenge, peerChallenge, ntResponse, challengeUsername, m.ntHash) +
+		" M=Authentication succeeded"
+	return OutcomeContinue, m.request(mschapv2OpSuccess, []byte(message)), nil
+}
+
+// request returns the type data of a request: the opcode, the MS-CHAPv2 ID
+// of the exchange and the length of the type data.
+func (m *mschapv2Method) request(opCode uint8, payload []byte) []byte {
+	data := []byte{opCode, m.id}
+	data = binary.BigEndian.AppendUint16(data, uint16(mschapv2HeaderLength+len(payload)))
+	return append(data, payload...)
+}
@@ -0,0 +1,109 @@
+package eap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// EAP packet format (RFC 3748 section 4).
+
+type Code uint8
+
+const (
+	CodeRequest  Code = 1
+	CodeResponse Code = 2
+	CodeSuccess  Code = 3
+	CodeFailure  Code = 4
+)
+
+// Type is the method type of a Request or Response.
+type Type uint8
+
+const (
+	TypeIdentity     Type = 1
+	TypeNotification Type = 2
+	TypeNak          Type = 3
+	TypeMd5Challenge Type = 4
+	TypeGtc          Type = 6
+	TypeTls          Type = 13
+	TypeTtls         Type = 21
+	TypePeap         Type = 25
+	TypeMschapv2     Type = 26
+	TypeExtensions   Type = 33
+)
+
+var typeNames = map[Type]string{
+	TypeIdentity:     "Identity",
+	TypeNotification: "Notification",
+	TypeNak:          "Nak",
+	TypeMd5Challenge: "MD5-Challenge",
+	TypeGtc:          "GTC",
+	TypeTls:          "TLS",
+	TypeTtls:         "TTLS",
+	TypePeap:         "PEAP",
+	TypeMschapv2:     "MSCHAPv2",
+	TypeExtensions:   "Extensions",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "Type-" + strconv.Itoa(int(t))
+}
+
+const headerLength = 4
+
+// Packet is a decoded EAP packet. Type and Data are only set on Requests and
+// Responses.
+type Packet struct {
+	Code       Code
+	Identifier uint8
+	Type       Type
+	Data       []byte
+}
+
+// Parse decodes an EAP packet, as carried by the joined EAP-Message
+// attributes of a RADIUS packet.
+func Parse(b []byte) (*Packet, error) {
+	if len(b) < headerLength {
+		return nil, errors.New("eap packet too short")
+	}
+	length := int(binary.BigEndian.Uint16(b[2:4]))
+	if length < headerLength || length > len(b) {
+		return nil, fmt.Errorf("invalid eap packet length %d", length)
+	}
+
+	p := &Packet{Code: Code(b[0]), Identifier: b[1]}
+	switch p.Code {
+	case CodeRequest, CodeResponse:
+		if length < headerLength+1 {
+			return nil, errors.New("eap packet without type")
+		}
+		p.Type = Type(b[headerLength])
+		p.Data = append([]byte(nil), b[headerLength+1:length]...)
+	case CodeSuccess, CodeFailure:
+	default:
+		return nil, fmt.Errorf("unknown eap code %d", p.Code)
+	}
+	return p, nil
+}
+
+// Encode returns the wire form of the packet.
+func (p *Packet) Encode() []byte {
+	length := headerLength
+	if p.Code == CodeRequest || p.Code == CodeResponse {
+		length += 1 + len(p.Data)
+	}
+	b := make([]byte, headerLength, length)
+	b[0] = byte(p.Code)
+	b[1] = p.Identifier
+	binary.BigEndian.PutUint16(b[2:4], uint16(length))
+	if p.Code == CodeRequest || p.Code == CodeResponse {
+		b = append(b, byte(p.Type))
+		b = append(b, p.Data...)
+	}
+	return b
+}
@@ -0,0 +1,179 @@
+package eap
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// PEAPv0 ([MS-PEAP], draft-kamath-pppext-peapv0). The server authenticates
+// with its certificate, then the peer sends its inner identity and runs
+// EAP-MSCHAPv2 inside the tunnel. The outcome is confirmed by a Result TLV
+// in an Extensions packet. Crypto-binding is not used, as by most deployed
+// servers, so the Master Session Key is the one of the TLS session.
+// Inner packets are sent without their EAP header, except Extensions.
+
+const (
+	peapTlvResult    = 3
+	peapTlvMandatory = 0x8000
+	peapTlvTypeMask  = 0x3fff
+
+	peapResultSuccess = 1
+	peapResultFailure = 2
+
+	// maxInnerLength is the plaintext size of a TLS record
+	maxInnerLength = 16 * 1024
+)
+
+var peapInnerMethods = []Type{TypeMschapv2}
+
+type peapMethod struct {
+	tunnel        *tlsTunnel
+	users         Users
+	innerIdentity string
+	msk           []byte
+}
+
+// NewPeap returns the constructor of PEAP methods. The outer identity is
+// only used for routing, the inner identity is resolved once received.
+func NewPeap(config TlsConfig) NewMethod {
+	return func(identity string, users Users) (Method, error) {
+		tlsConfig := config.Tls.Clone()
+		tlsConfig.ClientAuth = tls.NoClientCert
+		tlsConfig.SessionTicketsDisabled = true
+
+		m := &peapMethod{users: users}
+		m.tunnel = &tlsTunnel{config: tlsConfig, fragmentSize: config.FragmentSize, run: m.run}
+		return m, nil
+	}
+}
+
+func (m *peapMethod) Start() ([]byte, error) {
+	return m.tunnel.start(), nil
+}
+
+func (m *peapMethod) Process(response *Packet) (Outcome, []byte, error) {
+	return m.tunnel.process(response.Data)
+}
+
+func (m *peapMethod) Msk() []byte {
+	return m.msk
+}
+
+func (m *peapMethod) InnerIdentity() string {
+	return m.innerIdentity
+}
+
+func (m *peapMethod) Close() error {
+	return m.tunnel.close()
+}
+
+func (m *peapMethod) run(conn *tls.Conn) error {
+	if err := conn.Handshake(); err != nil {
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	state := conn.ConnectionState()
+	msk, err := exportMsk(state, TypePeap)
+	if err != nil {
+		return err
+	}
+	if state.Version != tls.VersionTLS13 {
+		// the peer acknowledges the Finished message of the server before
+		// the first inner request
+		if err := m.tunnel.conn.flush(); err != nil {
+			return err
+		}
+	}
+
+	inner := &peapInner{conn: conn}
+	response, err := inner.exchange(TypeIdentity, nil)
+	if err != nil {
+		return err
+	}
+	if response.Type != TypeIdentity {
+		return fmt.Errorf("unexpected inner %s response to Identity", response.Type)
+	}
+	m.innerIdentity = string(response.Data)
+
+	authErr := authenticateInner(m.innerIdentity, m.users, peapInnerMethods, inner.exchange)
+	result := uint16(peapResultSuccess)
+	if authErr != nil {
+		result = peapResultFailure
+	}
+	response, err = inner.exchange(TypeExtensions, peapResultTlv(result))
+	if err != nil {
+		return err
+	}
+	if authErr != nil {
+		return authErr
+	}
+	if response.Type != TypeExtensions || peapPeerResult(response.Data) != peapResultSuccess {
+		return errors.New("peap result not confirmed by the peer")
+	}
+	m.msk = msk
+	return nil
+}
+
+// peapInner exchanges the inner EAP packets over the tunnel.
+type peapInner struct {
+	conn       *tls.Conn
+	identifier uint8
+}
+
+// exchange sends an inner request and returns the response of the peer.
+func (c *peapInner) exchange(t Type, data []byte) (*Packet, error) {
+	c.identifier++
+	record := (&Packet{Code: CodeRequest, Identifier: c.identifier, Type: t, Data: data}).Encode()
+	if t != TypeExtensions {
+		record = record[headerLength:]
+	}
+	if _, err := c.conn.Write(record); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, maxInnerLength)
+	n, err := c.conn.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return c.parse(b[:n])
+}
+
+// parse decodes an inner response, with or without its EAP header. Peers
+// send Extensions, and some of them all packets, with the header.
+func (c *peapInner) parse(b []byte) (*Packet, error) {
+	// a compressed response starts with its type, never Notification (2)
+	// as the server sends none
+	if len(b) > headerLength && Code(b[0]) == CodeResponse && int(binary.BigEndian.Uint16(b[2:4])) == len(b) {
+		return Parse(b)
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty inner eap response")
+	}
+	return &Packet{Code: CodeResponse, Identifier: c.identifier, Type: Type(b[0]), Data: b[1:]}, nil
+}
+
+// peapResultTlv returns a mandatory Result TLV.
+func peapResultTlv(result uint16) []byte {
+	tlv := binary.BigEndian.AppendUint16(nil, peapTlvMandatory|peapTlvResult)
+	tlv = binary.BigEndian.AppendUint16(tlv, 2)
+	return binary.BigEndian.AppendUint16(tlv, result)
+}
+
+// peapPeerResult returns the status of the Result TLV of an Extensions
+// response, 0 when there is none.
+func peapPeerResult(data []byte) uint16 {
+	for len(data) >= 4 {
+		tlvType := binary.BigEndian.Uint16(data) & peapTlvTypeMask
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if len(data) < 4+length {
+			return 0
+		}
+		if tlvType == peapTlvResult && length >= 2 {
+			return binary.BigEndian.Uint16(data[4:6])
+		}
+		data = data[4+length:]
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package eap
+
+import (
+	"sync"
+	"time"
+)
+
+// Identities authenticated in resumable TLS sessions, keyed by an id carried
+// in the session tickets. Only the id travels in the ticket, so a session
+// resumed after the entry expired is authenticated again.
+
+const ticketIdLength = 16
+
+type resumption struct {
+	identity  string
+	expiresAt time.Time
+}
+
+type resumptionCache struct {
+	mu          sync.Mutex
+	entries     map[string]resumption
+	ttl         time.Duration
+	maxSize     int
+	lastCleanup time.Time
+}
+
+func newResumptionCache(ttl time.Duration, maxSize int) *resumptionCache {
+	return &resumptionCache{
+		entries:     map[string]resumption{},
+		ttl:         ttl,
+		maxSize:     maxSize,
+		lastCleanup: time.Now(),
+	}
+}
+
+// get returns the identity authenticated in the session of a ticket.
+func (c *resumptionCache) get(ticket string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[ticket]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return "", false
+	}
+	return entry.identity, true
+}
+
+// put remembers the identity of the session of a ticket. When the cache is
+// full the session is simply not resumable without authentication.
+func (c *resumptionCache) put(ticket string, identity string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastCleanup) >= c.ttl {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+		c.lastCleanup = now
+	}
+	if len(c.entries) >= c.maxSize {
+		return
+	}
+	c.entries[ticket] = resumption{identity: identity, expiresAt: now.Add(c.ttl)}
+}
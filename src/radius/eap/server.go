@@ -0,0 +1,257 @@
+package eap
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// EAP authenticator state machine for RADIUS (RFC 3579). A conversation
+// starts with the Identity response forwarded by the NAS, the first enabled
+// method available to the user is proposed and the peer may refuse it with
+// a Nak listing the methods it wants instead. Each round trip is an
+// Access-Challenge correlated by its State attribute.
+
+// Action is what the RADIUS layer answers to a round.
+type Action int
+
+const (
+	ActionChallenge Action = iota
+	ActionAccept
+	ActionReject
+	// ActionDiscard drops the request without an answer
+	ActionDiscard
+)
+
+// Reply is the outcome of a round.
+type Reply struct {
+	Action Action
+	// Message is the EAP packet to send in EAP-Message
+	Message []byte
+	// State is the State attribute of an Access-Challenge
+	State []byte
+	// Method is the method of the conversation, if one was proposed
+	Method Type
+	// Msk is the Master Session Key of an accepted conversation, when the
+	// method derives one
+	Msk []byte
+	// Identity is the identity the conversation authenticated, the inner
+	// identity of tunneled methods
+	Identity string
+	// Reason explains a reject or discard, for logs
+	Reason string
+}
+
+// Config of a Server.
+type Config struct {
+	// Methods are the enabled methods, by order of preference
+	Methods     []Type
+	SessionTtl  time.Duration
+	MaxSessions int
+}
+
+// Server runs the EAP conversations of the access handler.
+type Server struct {
+	config     Config
+	newMethods map[Type]NewMethod
+	sessions   *sessionStore
+}
+
+// NewServer creates a server with the EAP-MD5 method registered. EAP-GTC
+// sends the password in clear text and only runs inside the EAP-TTLS tunnel.
+func NewServer(config Config) *Server {
+	return &Server{
+		config: config,
+		newMethods: map[Type]NewMethod{
+			TypeMd5Challenge: NewMd5,
+		},
+		sessions: newSessionStore(config.SessionTtl, config.MaxSessions),
+	}
+}
+
+// Register adds the constructor of a method type, for methods that need
+// their own configuration. The method is only used once enabled in Config.
+func (s *Server) Register(t Type, newMethod NewMethod) {
+	s.newMethods[t] = newMethod
+}
+
+var methodNames = map[string]Type{
+	"md5":  TypeMd5Challenge,
+	"gtc":  TypeGtc,
+	"tls":  TypeTls,
+	"ttls": TypeTtls,
+	"peap": TypePeap,
+}
+
+// ParseMethod returns the type of a method name as used in the
+// configuration, e.g. "md5".
+func ParseMethod(name string) (Type, error) {
+	t, ok := methodNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported eap method %s", name)
+	}
+	return t, nil
+}
+
+// Handle processes the EAP message of an Access-Request. owner identifies
+// the NAS and user, the State of a challenge is only accepted from the same
+// owner. users resolves the identities of a new conversation.
+func (s *Server) Handle(owner string, state []byte, message []byte, users Users) Reply {
+	response, err := Parse(message)
+	if err != nil {
+		return failure(nil, err.Error())
+	}
+	if response.Code != CodeResponse {
+		return failure(response, fmt.Sprintf("unexpected eap code %d", response.Code))
+	}
+	if len(state) == 0 {
+		if response.Type != TypeIdentity {
+			return failure(response, fmt.Sprintf("conversation started with %s instead of Identity", response.Type))
+		}
+		current := &session{
+			owner:      owner,
+			identity:   string(response.Data),
+			users:      users,
+			identifier: response.Identifier,
+		}
+		return s.propose(current, response, s.config.Methods)
+	}
+
+	current := s.sessions.take(string(state))
+	if current == nil {
+		return failure(response, "unknown or expired State")
+	}
+	if current.owner != owner {
+		current.close()
+		return failure(response, "State of another conversation")
+	}
+	if response.Identifier != current.identifier {
+		// a stale retransmission, the peer still answers the current request
+		if err := s.sessions.put(string(state), current); err != nil {
+			current.close()
+			return failure(response, err.Error())
+		}
+		return Reply{Action: ActionDiscard, Method: current.methodType, Reason: "eap identifier mismatch"}
+	}
+
+	switch {
+	case response.Type == TypeNak && !current.responded:
+		return s.nak(current, response)
+	case response.Type == current.methodType:
+		return s.process(current, response)
+	}
+	current.close()
+	reply := failure(response, fmt.Sprintf("unexpected %s response to %s", response.Type, current.methodType))
+	reply.Method = current.methodType
+	return reply
+}
+
+// propose starts the first of the candidate methods that is enabled, not
+// offered yet and available to the user.
+func (s *Server) propose(current *session, response *Packet, candidates []Type) Reply {
+	for _, t := range candidates {
+		newMethod, ok := s.newMethods[t]
+		if !ok || !slices.Contains(s.config.Methods, t) || slices.Contains(current.offered, t) {
+			continue
+		}
+		method, err := newMethod(current.identity, current.users)
+		if errors.Is(err, ErrMethodUnavailable) {
+			continue
+		}
+		if err != nil {
+			return failure(response, err.Error())
+		}
+		data, err := method.Start()
+		if err != nil {
+			return failure(response, err.Error())
+		}
+		current.methodType = t
+		current.method = method
+		current.responded = false
+		current.offered = append(current.offered, t)
+		return s.challenge(current, response, data)
+	}
+	return failure(response, "no eap method available")
+}
+
+// nak proposes the methods the peer asked for, in its order of preference.
+func (s *Server) nak(current *session, response *Packet) Reply {
+	current.close()
+	candidates := []Type{}
+	for _, t := range response.Data {
+		candidates = append(candidates, Type(t))
+	}
+	reply := s.propose(current, response, candidates)
+	if reply.Action == ActionReject {
+		reply.Reason = fmt.Sprintf("%s refused, %s", current.methodType, reply.Reason)
+		reply.Method = current.methodType
+	}
+	return reply
+}
+
+func (s *Server) process(current *session, response *Packet) Reply {
+	current.responded = true
+	outcome, data, err := current.method.Process(response)
+	var reply Reply
+	switch {
+	case err != nil:
+		reply = failure(response, err.Error())
+	case outcome == OutcomeContinue:
+		reply = s.challenge(current, response, data)
+	case outcome == OutcomeSuccess:
+		reply = Reply{
+			Action:  ActionAccept,
+			Message: (&Packet{Code: CodeSuccess, Identifier: response.Identifier}).Encode(),
+		}
+		if keying, ok := current.method.(KeyingMethod); ok {
+			reply.Msk = keying.Msk()
+		}
+	default:
+		reply = failure(response, "authentication failed")
+	}
+	if reply.Action != ActionChallenge {
+		current.close()
+	}
+	reply.Method = current.methodType
+	reply.Identity = current.identity
+	if tunneled, ok := current.method.(TunneledMethod); ok && tunneled.InnerIdentity() != "" {
+		reply.Identity = tunneled.InnerIdentity()
+	}
+	return reply
+}
+
+// challenge sends the next request of the current method.
+func (s *Server) challenge(current *session, response *Packet, data []byte) Reply {
+	state, err := newState()
+	if err != nil {
+		return failure(response, err.Error())
+	}
+	current.identifier++
+	if err := s.sessions.put(state, current); err != nil {
+		return failure(response, err.Error())
+	}
+	request := &Packet{Code: CodeRequest, Identifier: current.identifier, Type: current.methodType, Data: data}
+	return Reply{
+		Action:  ActionChallenge,
+		Message: request.Encode(),
+		State:   []byte(state),
+		Method:  current.methodType,
+	}
+}
+
+// FailureMessage returns the EAP-Failure answering the EAP message of a
+// rejected request.
+func FailureMessage(message []byte) []byte {
+	response, _ := Parse(message)
+	return failure(response, "").Message
+}
+
+func failure(response *Packet, reason string) Reply {
+	failure := &Packet{Code: CodeFailure}
+	if response != nil {
+		failure.Identifier = response.Identifier
+	}
+	return Reply{Action: ActionReject, Message: failure.Encode(), Reason: reason}
+}
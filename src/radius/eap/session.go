@@ -0,0 +1,110 @@
+package eap
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Conversations in progress, keyed by the State attribute of the last
+// Access-Challenge. A session is taken out of the store while a response is
+// processed and stored again under a fresh State for the next round, so a
+// State is only accepted once.
+
+const stateLength = 16
+
+var errTooManySessions = errors.New("too many eap conversations in progress")
+
+type session struct {
+	// owner binds the conversation to the NAS and user it started with
+	owner    string
+	identity string
+	users    Users
+	// identifier of the last request, the response must repeat it
+	identifier uint8
+	methodType Type
+	method     Method
+	// responded is set once the peer answered the method, it can no longer
+	// be refused with a Nak
+	responded bool
+	offered   []Type
+	expiresAt time.Time
+}
+
+// close releases the resources of the current method.
+func (s *session) close() {
+	if closer, ok := s.method.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+type sessionStore struct {
+	mu          sync.Mutex
+	entries     map[string]*session
+	ttl         time.Duration
+	maxSize     int
+	lastCleanup time.Time
+}
+
+func newSessionStore(ttl time.Duration, maxSize int) *sessionStore {
+	return &sessionStore{
+		entries:     map[string]*session{},
+		ttl:         ttl,
+		maxSize:     maxSize,
+		lastCleanup: time.Now(),
+	}
+}
+
+// take removes and returns the live session stored under state.
+func (s *sessionStore) take(state string) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[state]
+	if !ok {
+		return nil
+	}
+	delete(s.entries, state)
+	if !time.Now().Before(entry.expiresAt) {
+		entry.close()
+		return nil
+	}
+	return entry
+}
+
+// put stores the session under state until it expires.
+func (s *sessionStore) put(state string, entry *session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastCleanup) >= s.ttl {
+		s.cleanupLocked(now)
+	}
+	if len(s.entries) >= s.maxSize {
+		return errTooManySessions
+	}
+	entry.expiresAt = now.Add(s.ttl)
+	s.entries[state] = entry
+	return nil
+}
+
+func (s *sessionStore) cleanupLocked(now time.Time) {
+	for state, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, state)
+			entry.close()
+		}
+	}
+	s.lastCleanup = now
+}
+
+func newState() (string, error) {
+	state := make([]byte, stateLength)
+	if _, err := rand.Read(state); err != nil {
+		return "", err
+	}
+	return string(state), nil
+}
@@ -0,0 +1,106 @@
+package eap
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// tlsConn carries the TLS records of a conversation between crypto/tls,
+// which runs in its own goroutine, and the EAP rounds. When TLS reads and no
+// input is left, it signals idle and blocks until the next round hands over
+// the records of the peer. Writes are buffered until the round collects
+// them.
+type tlsConn struct {
+	in      chan []byte
+	idle    chan struct{}
+	closed  chan struct{}
+	once    sync.Once
+	pending []byte
+
+	mu  sync.Mutex
+	out []byte
+}
+
+func newTlsConn() *tlsConn {
+	return &tlsConn{
+		in:     make(chan []byte),
+		idle:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *tlsConn) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		select {
+		case c.idle <- struct{}{}:
+		case <-c.closed:
+			return 0, net.ErrClosed
+		}
+		select {
+		case c.pending = <-c.in:
+		case <-c.closed:
+			return 0, net.ErrClosed
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// flush hands the records written so far to the peer and waits for its
+// next response, usually an empty acknowledgement. Records it carries are
+// kept for the next Read.
+func (c *tlsConn) flush() error {
+	select {
+	case c.idle <- struct{}{}:
+	case <-c.closed:
+		return net.ErrClosed
+	}
+	select {
+	case input := <-c.in:
+		c.pending = append(c.pending, input...)
+		return nil
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+func (c *tlsConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.out = append(c.out, b...)
+	return len(b), nil
+}
+
+// takeOutput returns and clears the records written since the last call.
+func (c *tlsConn) takeOutput() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := c.out
+	c.out = nil
+	return out
+}
+
+func (c *tlsConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *tlsConn) LocalAddr() net.Addr                { return eapAddr{} }
+func (c *tlsConn) RemoteAddr() net.Addr               { return eapAddr{} }
+func (c *tlsConn) SetDeadline(t time.Time) error      { return nil }
+func (c *tlsConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *tlsConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type eapAddr struct{}
+
+func (eapAddr) Network() string { return "eap" }
+func (eapAddr) String() string  { return "eap" }
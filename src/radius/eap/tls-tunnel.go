@@ -0,0 +1,187 @@
+package eap
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// EAP-TLS framing (RFC 5216 section 3.1), shared by the TLS based methods.
+// TLS messages longer than the fragment size are split over several
+// requests, each acknowledged by an empty response, and fragmented responses
+// of the peer are acknowledged with empty requests until they are complete.
+
+const (
+	tlsFlagLength = 0x80
+	tlsFlagMore   = 0x40
+	tlsFlagStart  = 0x20
+
+	// maxTlsMessageLength bounds the reassembly of a fragmented message
+	maxTlsMessageLength = 64 * 1024
+)
+
+// tlsTunnel drives a TLS server over the requests and responses of a
+// conversation. run is called in its own goroutine with the server side of
+// the connection and ends the tunnel when it returns.
+type tlsTunnel struct {
+	config       *tls.Config
+	fragmentSize int
+	// version is carried in the low bits of the flags by PEAP and TTLS
+	version byte
+	run     func(conn *tls.Conn) error
+
+	conn    *tlsConn
+	started bool
+	done    chan struct{}
+	runErr  error
+
+	inbound        []byte
+	outbound       []byte
+	outboundLength int
+}
+
+// start returns the type data of the EAP-TLS Start request.
+func (t *tlsTunnel) start() []byte {
+	return []byte{tlsFlagStart | t.version}
+}
+
+// process handles the type data of a response. With OutcomeContinue it
+// returns the type data of the next request.
+func (t *tlsTunnel) process(data []byte) (Outcome, []byte, error) {
+	if len(data) == 0 {
+		return OutcomeFailure, nil, errors.New("empty tls response")
+	}
+	flags := data[0]
+	message := data[1:]
+	if flags&tlsFlagLength != 0 {
+		if len(message) < 4 {
+			return OutcomeFailure, nil, errors.New("tls response too short for its length")
+		}
+		if length := binary.BigEndian.Uint32(message); length > maxTlsMessageLength {
+			return OutcomeFailure, nil, fmt.Errorf("tls message length %d too long", length)
+		}
+		message = message[4:]
+	}
+
+	if len(t.outbound) > 0 {
+		if len(message) != 0 {
+			return OutcomeFailure, nil, errors.New("tls data instead of a fragment acknowledgement")
+		}
+		return OutcomeContinue, t.nextFragment(), nil
+	}
+	if len(t.inbound)+len(message) > maxTlsMessageLength {
+		return OutcomeFailure, nil, errors.New("fragmented tls message too long")
+	}
+	t.inbound = append(t.inbound, message...)
+	if flags&tlsFlagMore != 0 {
+		return OutcomeContinue, []byte{t.version}, nil
+	}
+
+	input := t.inbound
+	t.inbound = nil
+	switch {
+	case len(input) == 0 && t.finished():
+		// the acknowledgement of the last request of the tunnel
+		return t.outcome()
+	case len(input) == 0 && !t.started:
+		return OutcomeFailure, nil, errors.New("unexpected tls acknowledgement")
+	case t.finished():
+		return OutcomeFailure, nil, errors.New("tls data after the end of the tunnel")
+	}
+
+	t.outbound = t.exchange(input)
+	t.outboundLength = len(t.outbound)
+	if len(t.outbound) == 0 {
+		switch {
+		case t.finished():
+			return t.outcome()
+		case len(input) == 0:
+			return OutcomeFailure, nil, errors.New("tls waits for data without answering")
+		}
+		// an empty request lets the peer send the rest of its data, such as
+		// the inner credentials following its Finished message
+		return OutcomeContinue, []byte{t.version}, nil
+	}
+	return OutcomeContinue, t.nextFragment(), nil
+}
+
+// exchange hands the records of the peer to TLS and returns the records it
+// answers with, once it waits for more input or the tunnel ended. An empty
+// input is the acknowledgement a flush of the connection waits for.
+func (t *tlsTunnel) exchange(input []byte) []byte {
+	if !t.started {
+		t.started = true
+		t.conn = newTlsConn()
+		t.done = make(chan struct{})
+		go func() {
+			defer close(t.done)
+			t.runErr = t.run(tls.Server(t.conn, t.config))
+		}()
+		if !t.wait() {
+			return t.conn.takeOutput()
+		}
+	}
+
+	select {
+	case t.conn.in <- input:
+		t.wait()
+	case <-t.done:
+	}
+	return t.conn.takeOutput()
+}
+
+// wait blocks until TLS waits for input, reported as true, or the tunnel
+// ended.
+func (t *tlsTunnel) wait() bool {
+	select {
+	case <-t.conn.idle:
+		return true
+	case <-t.done:
+		return false
+	}
+}
+
+func (t *tlsTunnel) finished() bool {
+	if !t.started {
+		return false
+	}
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *tlsTunnel) outcome() (Outcome, []byte, error) {
+	if t.runErr != nil {
+		return OutcomeFailure, nil, t.runErr
+	}
+	return OutcomeSuccess, nil, nil
+}
+
+// nextFragment returns the type data of the next request carrying the
+// pending records. The first fragment of a message holds its total length.
+func (t *tlsTunnel) nextFragment() []byte {
+	size := min(len(t.outbound), t.fragmentSize)
+	data := []byte{t.version}
+	if len(t.outbound) == t.outboundLength {
+		data[0] |= tlsFlagLength
+		data = binary.BigEndian.AppendUint32(data, uint32(t.outboundLength))
+	}
+	if size < len(t.outbound) {
+		data[0] |= tlsFlagMore
+	}
+	data = append(data, t.outbound[:size]...)
+	t.outbound = t.outbound[size:]
+	return data
+}
+
+// close stops the TLS goroutine of a tunnel that did not end.
+func (t *tlsTunnel) close() error {
+	if t.started {
+		return t.conn.Close()
+	}
+	return nil
+}
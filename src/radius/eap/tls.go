@@ -0,0 +1,146 @@
+package eap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EAP-TLS (RFC 5216, RFC 9190 for TLS 1.3). The peer authenticates with a
+// client certificate verified against the configured CAs, and the Master
+// Session Key exported from the TLS session is handed to the NAS.
+
+const mskLength = 64
+
+// TlsConfig configures the TLS based methods.
+type TlsConfig struct {
+	// Tls holds the server certificate, the CAs client certificates are
+	// verified against and the protocol versions
+	Tls          *tls.Config
+	FragmentSize int
+	// CheckIdentity requires the EAP identity to be one of the names of the
+	// client certificate
+	CheckIdentity bool
+	// VerifyRevocation, when set, rejects revoked client certificates
+	VerifyRevocation func(state tls.ConnectionState) error
+	// ResumptionTtl is how long EAP-TTLS sessions can be resumed without
+	// inner authentication, 0 disables session tickets
+	ResumptionTtl  time.Duration
+	MaxResumptions int
+}
+
+type tlsMethod struct {
+	tunnel *tlsTunnel
+	msk    []byte
+}
+
+// NewTls returns the constructor of EAP-TLS methods.
+func NewTls(config TlsConfig) NewMethod {
+	return func(identity string, users Users) (Method, error) {
+		// the certificate authenticates a user of the store
+		if _, err := userCredentials(users, identity); err != nil {
+			return nil, err
+		}
+		tlsConfig := config.Tls.Clone()
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		// without resumption no ticket follows the TLS 1.3 handshake
+		tlsConfig.SessionTicketsDisabled = true
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("no client certificate")
+			}
+			if config.CheckIdentity {
+				if err := matchCertificateIdentity(state.PeerCertificates[0], identity); err != nil {
+					return err
+				}
+			}
+			if config.VerifyRevocation != nil {
+				return config.VerifyRevocation(state)
+			}
+			return nil
+		}
+
+		m := &tlsMethod{}
+		m.tunnel = &tlsTunnel{config: tlsConfig, fragmentSize: config.FragmentSize, run: m.run}
+		return m, nil
+	}
+}
+
+func (m *tlsMethod) Start() ([]byte, error) {
+	return m.tunnel.start(), nil
+}
+
+func (m *tlsMethod) Process(response *Packet) (Outcome, []byte, error) {
+	return m.tunnel.process(response.Data)
+}
+
+func (m *tlsMethod) Msk() []byte {
+	return m.msk
+}
+
+func (m *tlsMethod) Close() error {
+	return m.tunnel.close()
+}
+
+func (m *tlsMethod) run(conn *tls.Conn) error {
+	if err := conn.Handshake(); err != nil {
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	state := conn.ConnectionState()
+	msk, err := exportMsk(state, TypeTls)
+	if err != nil {
+		return err
+	}
+	if state.Version == tls.VersionTLS13 {
+		// the commitment message, no handshake message follows (RFC 9190
+		// section 2.5)
+		if _, err := conn.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	m.msk = msk
+	return nil
+}
+
+// exportMsk derives the Master Session Key of a TLS based method, RFC 5216
+// section 2.3 for TLS 1.2 (RFC 5281 section 8 for EAP-TTLS) and RFC 9190
+// section 2.3 for TLS 1.3.
+func exportMsk(state tls.ConnectionState, t Type) ([]byte, error) {
+	var keyMaterial []byte
+	var err error
+	switch {
+	case state.Version == tls.VersionTLS13:
+		keyMaterial, err = state.ExportKeyingMaterial("EXPORTER_EAP_TLS_Key_Material", []byte{byte(t)}, 2*mskLength)
+	case t == TypeTtls:
+		keyMaterial, err = state.ExportKeyingMaterial("ttls keying material", nil, 2*mskLength)
+	default:
+		keyMaterial, err = state.ExportKeyingMaterial("client EAP encryption", nil, 2*mskLength)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("export tls key material: %w", err)
+	}
+	return keyMaterial[:mskLength], nil
+}
+
+// matchCertificateIdentity checks that identity is the subject common name,
+// a DNS, email or URI subject alternative name of the certificate. Machine
+// identities (host/name) are matched without their prefix.
+func matchCertificateIdentity(certificate *x509.Certificate, identity string) error {
+	names := []string{certificate.Subject.CommonName}
+	names = append(names, certificate.DNSNames...)
+	names = append(names, certificate.EmailAddresses...)
+	for _, uri := range certificate.URIs {
+		names = append(names, uri.String())
+	}
+
+	host, _ := strings.CutPrefix(identity, "host/")
+	for _, name := range names {
+		if name != "" && (strings.EqualFold(name, identity) || strings.EqualFold(name, host)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("identity %s does not match the client certificate %s", identity, certificate.Subject.String())
+}
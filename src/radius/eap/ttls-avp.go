@@ -0,0 +1,129 @@
+package eap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Diameter AVPs carried inside the EAP-TTLS tunnel (RFC 5281 section 10).
+// RADIUS attributes keep their number as AVP code, vendor attributes their
+// vendor id. Each AVP is padded to a multiple of 4 bytes.
+
+const (
+	avpFlagVendor    = 0x80
+	avpFlagMandatory = 0x40
+	avpHeaderLength  = 8
+
+	avpUserName      = 1
+	avpUserPassword  = 2
+	avpChapPassword  = 3
+	avpChapChallenge = 60
+	avpEapMessage    = 79
+
+	vendorMicrosoft    = 311
+	avpMsChapChallenge = 11
+	avpMsChap2Response = 25
+	avpMsChap2Success  = 26
+)
+
+type avpKey struct {
+	code   uint32
+	vendor uint32
+}
+
+type avp struct {
+	avpKey
+	data []byte
+}
+
+type avps []avp
+
+// knownAvps are the AVPs the inner authentication understands, mandatory
+// AVPs outside of them are refused.
+var knownAvps = map[avpKey]bool{
+	{code: avpUserName}:                                 true,
+	{code: avpUserPassword}:                             true,
+	{code: avpChapPassword}:                             true,
+	{code: avpChapChallenge}:                            true,
+	{code: avpEapMessage}:                               true,
+	{code: avpMsChapChallenge, vendor: vendorMicrosoft}: true,
+	{code: avpMsChap2Response, vendor: vendorMicrosoft}: true,
+}
+
+func parseAvps(b []byte) (avps, error) {
+	list := avps{}
+	for len(b) > 0 {
+		if len(b) < avpHeaderLength {
+			return nil, errors.New("avp too short")
+		}
+		code := binary.BigEndian.Uint32(b)
+		flags := b[4]
+		length := int(binary.BigEndian.Uint32(b[4:8]) & 0xffffff)
+		headerLength := avpHeaderLength
+		var vendor uint32
+		if flags&avpFlagVendor != 0 {
+			headerLength += 4
+			if len(b) < headerLength {
+				return nil, errors.New("vendor avp too short")
+			}
+			vendor = binary.BigEndian.Uint32(b[8:12])
+		}
+		if length < headerLength || length > len(b) {
+			return nil, fmt.Errorf("invalid length %d of avp %d", length, code)
+		}
+		key := avpKey{code: code, vendor: vendor}
+		if flags&avpFlagMandatory != 0 && !knownAvps[key] {
+			return nil, fmt.Errorf("unsupported mandatory avp %d of vendor %d", code, vendor)
+		}
+		list = append(list, avp{avpKey: key, data: b[headerLength:length]})
+
+		padded := (length + 3) &^ 3
+		if padded > len(b) {
+			padded = len(b)
+		}
+		b = b[padded:]
+	}
+	return list, nil
+}
+
+// get returns the data of the first AVP with code, nil when there is none.
+func (a avps) get(code uint32, vendor uint32) []byte {
+	for _, entry := range a {
+		if entry.code == code && entry.vendor == vendor {
+			return entry.data
+		}
+	}
+	return nil
+}
+
+// join returns the data of all the AVPs with code, as one value.
+func (a avps) join(code uint32) []byte {
+	var data []byte
+	for _, entry := range a {
+		if entry.code == code && entry.vendor == 0 {
+			data = append(data, entry.data...)
+		}
+	}
+	return data
+}
+
+// appendAvp encodes a mandatory AVP.
+func appendAvp(b []byte, code uint32, vendor uint32, data []byte) []byte {
+	headerLength := avpHeaderLength
+	flags := uint32(avpFlagMandatory)
+	if vendor != 0 {
+		headerLength += 4
+		flags |= avpFlagVendor
+	}
+	b = binary.BigEndian.AppendUint32(b, code)
+	b = binary.BigEndian.AppendUint32(b, flags<<24|uint32(headerLength+len(data)))
+	if vendor != 0 {
+		b = binary.BigEndian.AppendUint32(b, vendor)
+	}
+	b = append(b, data...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
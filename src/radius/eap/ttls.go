@@ -0,0 +1,283 @@
+package eap
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	"radius-server/src/radius/mschap"
+)
+
+// EAP-TTLS (RFC 5281, RFC 9427 for TLS 1.3). The server authenticates with
+// its certificate, then the peer sends its inner identity and credentials as
+// AVPs: PAP, CHAP or MS-CHAPv2 attributes, or an inner EAP conversation in
+// EAP-Message. The outer identity is only used for routing. Sessions resumed
+// from a ticket skip the inner authentication while the identity they
+// authenticated is remembered.
+
+const (
+	// ttlsChallengeLength is the CHAP or MS-CHAPv2 challenge followed by its
+	// identifier, both derived from the TLS session (RFC 5281 section 11.1)
+	ttlsChallengeLength   = 17
+	msChap2ResponseLength = 50
+)
+
+var ttlsInnerMethods = []Type{TypeMschapv2, TypeGtc, TypeMd5Challenge}
+
+type ttlsMethod struct {
+	tunnel      *tlsTunnel
+	users       Users
+	resumptions *resumptionCache
+	// ticket is the id of the ticket issued in this session, resumedTicket
+	// the id of the ticket the session was resumed from
+	ticket        string
+	resumedTicket string
+	innerIdentity string
+	msk           []byte
+}
+
+// NewTtls returns the constructor of EAP-TTLS methods.
+func NewTtls(config TlsConfig) NewMethod {
+	// tickets of all the conversations are sealed with the keys of one
+	// configuration
+	base := config.Tls.Clone()
+	base.ClientAuth = tls.NoClientCert
+	base.SessionTicketsDisabled = config.ResumptionTtl <= 0
+	resumptions := newResumptionCache(config.ResumptionTtl, config.MaxResumptions)
+
+	return func(identity string, users Users) (Method, error) {
+		m := &ttlsMethod{users: users, resumptions: resumptions}
+		tlsConfig := base.Clone()
+		tlsConfig.WrapSession = func(state tls.ConnectionState, session *tls.SessionState) ([]byte, error) {
+			ticket := make([]byte, ticketIdLength)
+			if _, err := rand.Read(ticket); err != nil {
+				return nil, err
+			}
+			session.Extra = [][]byte{ticket}
+			m.ticket = string(ticket)
+			return base.EncryptTicket(state, session)
+		}
+		tlsConfig.UnwrapSession = func(sealed []byte, state tls.ConnectionState) (*tls.SessionState, error) {
+			session, err := base.DecryptTicket(sealed, state)
+			if err != nil || session == nil {
+				return session, err
+			}
+			if len(session.Extra) == 1 {
+				m.resumedTicket = string(session.Extra[0])
+			}
+			return session, nil
+		}
+		m.tunnel = &tlsTunnel{config: tlsConfig, fragmentSize: config.FragmentSize, run: m.run}
+		return m, nil
+	}
+}
+
+func (m *ttlsMethod) Start() ([]byte, error) {
+	return m.tunnel.start(), nil
+}
+
+func (m *ttlsMethod) Process(response *Packet) (Outcome, []byte, error) {
+	return m.tunnel.process(response.Data)
+}
+
+func (m *ttlsMethod) Msk() []byte {
+	return m.msk
+}
+
+func (m *ttlsMethod) InnerIdentity() string {
+	return m.innerIdentity
+}
+
+func (m *ttlsMethod) Close() error {
+	return m.tunnel.close()
+}
+
+func (m *ttlsMethod) run(conn *tls.Conn) error {
+	if err := conn.Handshake(); err != nil {
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	state := conn.ConnectionState()
+	msk, err := exportMsk(state, TypeTtls)
+	if err != nil {
+		return err
+	}
+
+	identity, resumed := "", false
+	if state.DidResume && m.resumedTicket != "" {
+		identity, resumed = m.resumptions.get(m.resumedTicket)
+	}
+	if resumed {
+		m.innerIdentity = identity
+	} else if err := m.authenticate(conn, state); err != nil {
+		return err
+	}
+
+	if m.ticket != "" {
+		m.resumptions.put(m.ticket, m.innerIdentity)
+	}
+	m.msk = msk
+	return nil
+}
+
+// authenticate verifies the inner credentials sent by the peer.
+func (m *ttlsMethod) authenticate(conn *tls.Conn, state tls.ConnectionState) error {
+	request, err := readAvps(conn)
+	if err != nil {
+		return err
+	}
+	if message := request.join(avpEapMessage); message != nil {
+		return m.authenticateEap(conn, message)
+	}
+
+	username := request.get(avpUserName, 0)
+	if len(username) == 0 {
+		return errors.New("inner User-Name missing")
+	}
+	m.innerIdentity = string(username)
+	credentials, err := userCredentials(m.users, m.innerIdentity)
+	if err != nil {
+		return fmt.Errorf("inner identity %s: %w", m.innerIdentity, err)
+	}
+
+	switch {
+	case request.get(avpUserPassword, 0) != nil:
+		// the password is padded with zeros to a multiple of 16 bytes
+		password := strings.TrimRight(string(request.get(avpUserPassword, 0)), "\x00")
+		if password == "" || !credentials.VerifyPassword(password) {
+			return errors.New("inner PAP authentication failed")
+		}
+		return nil
+	case request.get(avpChapPassword, 0) != nil:
+		return authenticateTtlsChap(request, state, credentials)
+	case request.get(avpMsChap2Response, vendorMicrosoft) != nil:
+		return m.authenticateMschapv2(conn, request, state, credentials)
+	}
+	return errors.New("no supported inner credentials")
+}
+
+// authenticateTtlsChap verifies CHAP-Password (RFC 1994) against the
+// cleartext password.
+func authenticateTtlsChap(request avps, state tls.ConnectionState, credentials Credentials) error {
+	challenge, err := ttlsChallenge(state)
+	if err != nil {
+		return err
+	}
+	chapPassword := request.get(avpChapPassword, 0)
+	if len(chapPassword) != 1+md5.Size || chapPassword[0] != challenge[16] ||
+		!bytes.Equal(request.get(avpChapChallenge, 0), challenge[:16]) {
+		return errors.New("inner CHAP challenge mismatch")
+	}
+	password, ok := credentials.CleartextPassword()
+	if !ok {
+		return fmt.Errorf("inner CHAP: %w", ErrMethodUnavailable)
+	}
+
+	hash := md5.New()
+	hash.Write(chapPassword[:1])
+	hash.Write([]byte(password))
+	hash.Write(challenge[:16])
+	if subtle.ConstantTimeCompare(hash.Sum(nil), chapPassword[1:]) != 1 {
+		return errors.New("inner CHAP authentication failed")
+	}
+	return nil
+}
+
+// authenticateMschapv2 verifies MS-CHAP2-Response (RFC 2548 section 2.3.2)
+// against the NT hash and sends MS-CHAP2-Success, which the peer
+// acknowledges before the conversation ends (RFC 5281 section 11.2.4).
+func (m *ttlsMethod) authenticateMschapv2(conn *tls.Conn, request avps, state tls.ConnectionState, credentials Credentials) error {
+	challenge, err := ttlsChallenge(state)
+	if err != nil {
+		return err
+	}
+	response := request.get(avpMsChap2Response, vendorMicrosoft)
+	if len(response) != msChap2ResponseLength || response[0] != challenge[16] ||
+		!bytes.Equal(request.get(avpMsChapChallenge, vendorMicrosoft), challenge[:16]) {
+		return errors.New("inner MS-CHAPv2 challenge mismatch")
+	}
+	ntHash, ok := credentials.NtPasswordHash()
+	if !ok {
+		return fmt.Errorf("inner MS-CHAPv2: %w", ErrMethodUnavailable)
+	}
+
+	ident := response[0]
+	peerChallenge := response[2:18]
+	peerResponse := response[26:50]
+	challengeUsername := mschap.ChallengeUsername(m.innerIdentity)
+	ntResponse := mschap.NtResponse(challenge[:16], peerChallenge, challengeUsername, ntHash)
+	if subtle.ConstantTimeCompare(ntResponse, peerResponse) != 1 {
+		return errors.New("inner MS-CHAPv2 authentication failed")
+	}
+
+	success := append([]byte{ident}, mschap.AuthenticatorResponse(challenge[:16], peerChallenge, ntResponse, challengeUsername, ntHash)...)
+	if _, err := conn.Write(appendAvp(nil, avpMsChap2Success, vendorMicrosoft, success)); err != nil {
+		return err
+	}
+	return m.tunnel.conn.flush()
+}
+
+// authenticateEap runs the inner EAP conversation started by the
+// EAP-Response/Identity of the peer.
+func (m *ttlsMethod) authenticateEap(conn *tls.Conn, message []byte) error {
+	response, err := Parse(message)
+	if err != nil {
+		return err
+	}
+	if response.Code != CodeResponse || response.Type != TypeIdentity {
+		return fmt.Errorf("inner eap conversation started with %s instead of Identity", response.Type)
+	}
+	m.innerIdentity = string(response.Data)
+	inner := &ttlsInner{conn: conn, identifier: response.Identifier}
+	return authenticateInner(m.innerIdentity, m.users, ttlsInnerMethods, inner.exchange)
+}
+
+// ttlsInner exchanges the inner EAP packets in EAP-Message AVPs.
+type ttlsInner struct {
+	conn       *tls.Conn
+	identifier uint8
+}
+
+func (c *ttlsInner) exchange(t Type, data []byte) (*Packet, error) {
+	c.identifier++
+	request := (&Packet{Code: CodeRequest, Identifier: c.identifier, Type: t, Data: data}).Encode()
+	if _, err := c.conn.Write(appendAvp(nil, avpEapMessage, 0, request)); err != nil {
+		return nil, err
+	}
+
+	avps, err := readAvps(c.conn)
+	if err != nil {
+		return nil, err
+	}
+	response, err := Parse(avps.join(avpEapMessage))
+	if err != nil {
+		return nil, err
+	}
+	if response.Code != CodeResponse || response.Identifier != c.identifier {
+		return nil, errors.New("inner eap response does not answer the request")
+	}
+	return response, nil
+}
+
+// readAvps reads the next AVPs sent by the peer.
+func readAvps(conn *tls.Conn) (avps, error) {
+	b := make([]byte, maxInnerLength)
+	n, err := conn.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return parseAvps(b[:n])
+}
+
+// ttlsChallenge derives the challenge of inner CHAP and MS-CHAPv2.
+func ttlsChallenge(state tls.ConnectionState) ([]byte, error) {
+	challenge, err := state.ExportKeyingMaterial("ttls challenge", nil, ttlsChallengeLength)
+	if err != nil {
+		return nil, fmt.Errorf("export tls challenge: %w", err)
+	}
+	return challenge, nil
+}
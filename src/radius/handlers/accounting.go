@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"time"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/database"
+	"radius-server/src/database/entities"
+	"radius-server/src/metrics"
+	networkUtil "radius-server/src/utils/network"
+	numberUtil "radius-server/src/utils/number"
+
+	"gorm.io/gorm"
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2866"
+	"layeh.com/radius/rfc2869"
+	"layeh.com/radius/rfc3162"
+)
+
+// AccountingHandler persists Accounting-Request packets (RFC 2866) into
+// radius_accounting, keeps radius_sessions in sync and answers with
+// Accounting-Response. No response is sent
+// when the record could not be stored, so the NAS retransmits it later.
+func AccountingHandler(w radius.ResponseWriter, r *radius.Request) {
+	start := time.Now()
+	logRequestAttributes(r)
+	statusType := rfc2866.AcctStatusType_Get(r.Packet)
+	requestType, hasMetric := accountingRequestType(statusType)
+
+	if !isAuthenticAccountingRequest(r.Packet) {
+		logger.Logger.Warn().Str("remote", r.RemoteAddr.String()).Msg("Accounting request dropped. Invalid request authenticator")
+		if hasMetric {
+			metrics.CreateRequestMetric(requestType, metrics.Failure, time.Since(start).Seconds())
+		}
+		return
+	}
+
+	record := accountingRecordFromPacket(r)
+	err := database.DbConn.Transaction(func(tx *gorm.DB) error {
+		if err := database.CreateAccounting(tx, record); err != nil {
+			return err
+		}
+		return applySession(tx, statusType, record)
+	})
+	if err != nil {
+		logger.Logger.Error().Str("acct_session_id", record.AcctSessionId).Msgf("Create accounting record error. %s", err.Error())
+		if hasMetric {
+			metrics.CreateRequestMetric(requestType, metrics.Failure, time.Since(start).Seconds())
+		}
+		return
+	}
+
+	if err := w.Write(r.Response(radius.CodeAccountingResponse)); err != nil {
+		logger.Logger.Error().Str("acct_session_id", record.AcctSessionId).Msgf("Write accounting response error. %s", err.Error())
+	}
+	if hasMetric {
+		metrics.CreateRequestMetric(requestType, metrics.Success, time.Since(start).Seconds())
+	}
+}
+
+// isAuthenticAccountingRequest checks the Request Authenticator of an
+// Accounting-Request (RFC 2866 section 3) independently of the server's
+// InsecureSkipVerify setting.
+func isAuthenticAccountingRequest(p *radius.Packet) bool {
+	if p.Code != radius.CodeAccountingRequest {
+		return false
+	}
+	raw, err := p.MarshalBinary()
+	if err != nil {
+		return false
+	}
+	return radius.IsAuthenticRequest(raw, p.Secret)
+}
+
+// applySession opens, updates or closes the radius_sessions row matching the
+// accounting record. Accounting-On/Off closes every session of the NAS.
+func applySession(tx *gorm.DB, statusType rfc2866.AcctStatusType, record *entities.RadiusAccounting) error {
+	switch statusType {
+	case rfc2866.AcctStatusType_Value_Start:
+		session := sessionFromRecord(record)
+		session.SubscriberId = subscriberId(record.Username)
+		return database.OpenSession(tx, session)
+	case rfc2866.AcctStatusType_Value_InterimUpdate:
+		return database.UpdateSession(tx, sessionFromRecord(record))
+	case rfc2866.AcctStatusType_Value_Stop:
+		session := sessionFromRecord(record)
+		session.IsOnline = false
+		session.TerminateCause = record.AcctTerminateCause
+		session.StoppedAt = &record.EventTimestamp
+		return database.CloseSession(tx, session)
+	case rfc2866.AcctStatusType_Value_AccountingOn, rfc2866.AcctStatusType_Value_AccountingOff:
+		return database.CloseNasSessions(tx, record.NasIpAddress, rfc2866.AcctTerminateCause_Value_NASReboot.String(), record.EventTimestamp)
+	}
+	return nil
+}
+
+func sessionFromRecord(record *entities.RadiusAccounting) *entities.RadiusSession {
+	return &entities.RadiusSession{
+		AcctSessionId:    record.AcctSessionId,
+		NasIpAddress:     record.NasIpAddress,
+		Username:         record.Username,
+		NasPortId:        record.NasPortId,
+		FramedIpAddress:  record.FramedIpAddress,
+		CallingStationId: record.CallingStationId,
+		CalledStationId:  record.CalledStationId,
+		SessionTime:      record.AcctSessionTime,
+		InputOctets:      record.AcctInputOctets,
+		OutputOctets:     record.AcctOutputOctets,
+		InputPackets:     record.AcctInputPackets,
+		OutputPackets:    record.AcctOutputPackets,
+		IsOnline:         true,
+		StartedAt:        record.EventTimestamp - record.AcctSessionTime,
+		LastUpdatedAt:    record.EventTimestamp,
+	}
+}
+
+// subscriberId resolves the radius_users id of the session owner, if known.
+func subscriberId(username *string) *string {
+	if username == nil {
+		return nil
+	}
+	user, err := database.GetUserByUsername(*username)
+	if err != nil {
+		logger.Logger.Error().Str("username", *username).Msgf("Get session subscriber error. %s", err.Error())
+		return nil
+	}
+	if user == nil {
+		return nil
+	}
+	return optionalString(numberUtil.Int64ToString(user.Id))
+}
+
+func accountingRequestType(statusType rfc2866.AcctStatusType) (metrics.RadiusRequestTypes, bool) {
+	switch statusType {
+	case rfc2866.AcctStatusType_Value_Start:
+		return metrics.AccountingStart, true
+	case rfc2866.AcctStatusType_Value_Stop:
+		return metrics.AccountingStop, true
+	case rfc2866.AcctStatusType_Value_InterimUpdate:
+		return metrics.InterimUpdate, true
+	}
+	return "", false
+}
+
+func accountingRecordFromPacket(r *radius.Request) *entities.RadiusAccounting {
+	p := r.Packet
+	record := &entities.RadiusAccounting{
+		AcctSessionId:     rfc2866.AcctSessionID_GetString(p),
+		AcctStatusType:    rfc2866.AcctStatusType_Get(p).String(),
+		Username:          optionalString(rfc2865.UserName_GetString(p)),
+		NasIpAddress:      nasIpAddress(r),
+		NasIdentifier:     optionalString(rfc2865.NASIdentifier_GetString(p)),
+		NasPortId:         optionalString(rfc2869.NASPortID_GetString(p)),
+		CallingStationId:  optionalString(rfc2865.CallingStationID_GetString(p)),
+		CalledStationId:   optionalString(rfc2865.CalledStationID_GetString(p)),
+		AcctSessionTime:   int64(rfc2866.AcctSessionTime_Get(p)),
+		AcctInputOctets:   octetsWithGigawords(uint32(rfc2866.AcctInputOctets_Get(p)), uint32(rfc2869.AcctInputGigawords_Get(p))),
+		AcctOutputOctets:  octetsWithGigawords(uint32(rfc2866.AcctOutputOctets_Get(p)), uint32(rfc2869.AcctOutputGigawords_Get(p))),
+		AcctInputPackets:  int64(rfc2866.AcctInputPackets_Get(p)),
+		AcctOutputPackets: int64(rfc2866.AcctOutputPackets_Get(p)),
+		AcctDelayTime:     int64(rfc2866.AcctDelayTime_Get(p)),
+		EventTimestamp:    eventTimestamp(p),
+	}
+	if framedIp := rfc2865.FramedIPAddress_Get(p); framedIp != nil {
+		record.FramedIpAddress = optionalString(framedIp.String())
+	}
+	if _, err := rfc2866.AcctTerminateCause_Lookup(p); err == nil {
+		record.AcctTerminateCause = optionalString(rfc2866.AcctTerminateCause_Get(p).String())
+	}
+	return record
+}
+
+// nasIpAddress prefers NAS-IP-Address or NAS-IPv6-Address and falls back to
+// the packet source.
+func nasIpAddress(r *radius.Request) string {
+	if ip := rfc2865.NASIPAddress_Get(r.Packet); ip != nil {
+		return ip.String()
+	}
+	if ip := rfc3162.NASIPv6Address_Get(r.Packet); ip != nil {
+		return ip.String()
+	}
+	ip, err := networkUtil.AddrFromNetAddr(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr.String()
+	}
+	return ip.String()
+}
+
+// eventTimestamp returns Event-Timestamp, or the receive time corrected by
+// Acct-Delay-Time when the NAS does not send it.
+func eventTimestamp(p *radius.Packet) int64 {
+	if _, err := rfc2869.EventTimestamp_Lookup(p); err == nil {
+		return rfc2869.EventTimestamp_Get(p).Unix()
+	}
+	return time.Now().Unix() - int64(rfc2866.AcctDelayTime_Get(p))
+}
+
+func octetsWithGigawords(octets uint32, gigawords uint32) int64 {
+	return int64(gigawords)<<32 | int64(octets)
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
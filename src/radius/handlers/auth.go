@@ -1,17 +1,178 @@
 package handlers
 
 import (
-	"fmt"
+	"strings"
+	"time"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/database"
+	"radius-server/src/database/entities"
+	"radius-server/src/metrics"
+	"radius-server/src/radius/dictionary"
+	"radius-server/src/radius/eap"
+	"radius-server/src/radius/policy"
 
 	"layeh.com/radius"
 	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/vendors/microsoft"
+)
+
+const (
+	rejectMessageInvalidCredentials = "Invalid username or password"
+	rejectMessageUserDisabled       = "User is disabled"
+	rejectMessageInternalError      = "Authentication temporarily unavailable"
+	rejectMessageUnsupportedMethod  = "Unsupported authentication method"
 )
 
 func AccessHandler(w radius.ResponseWriter, r *radius.Request) {
+	start := time.Now()
+	logRequestAttributes(r)
+	response := authenticate(r)
+	if response == nil {
+		return
+	}
+
+	status := metrics.Failure
+	switch response.Code {
+	case radius.CodeAccessAccept:
+		status = metrics.Success
+	case radius.CodeAccessChallenge:
+		status = metrics.Challenge
+	}
+	if err := w.Write(response); err != nil {
+		logger.Logger.Error().Str("remote", r.RemoteAddr.String()).Msgf("Write access response error. %s", err.Error())
+	}
+	metrics.CreateRequestMetric(metrics.AccessRequest, status, time.Since(start).Seconds())
+}
+
+// authenticate returns the response to an Access-Request, nil when the
+// request is discarded.
+func authenticate(r *radius.Request) *radius.Packet {
 	username := rfc2865.UserName_GetString(r.Packet)
-	password := rfc2865.UserPassword_GetString(r.Packet)
+	if username == "" {
+		logger.Logger.Info().Msg("Access rejected. Missing username")
+		return rejectResponse(r, rejectMessageInvalidCredentials)
+	}
+	if message := requestEapMessage(r); message != nil {
+		// the EAP methods resolve the identities they authenticate, the
+		// User-Name of tunneled methods is usually anonymous
+		return eapAuthenticate(r, username, message)
+	}
+
+	authorized, rejectMessage := authorizeUser(r, username)
+	if authorized == nil {
+		return rejectResponse(r, rejectMessage)
+	}
+
+	var response *radius.Packet
+	if authType, _ := authorized.authorization.Control.Get(policy.AttributeAuthType); strings.EqualFold(authType, "accept") {
+		logger.Logger.Info().Str("username", username).Msg("Access accepted. Auth-Type Accept")
+		response = acceptResponse(r)
+	} else {
+		response = authenticateCredentials(r, authorized.user)
+	}
+	if response.Code != radius.CodeAccessAccept {
+		return response
+	}
+	return applyReplyItems(r, authorized, response)
+}
+
+// authorizedUser is a user allowed to authenticate, with the result of its
+// check items.
+type authorizedUser struct {
+	user          *entities.RadiusUser
+	authorization *policy.Result
+}
 
-	fmt.Printf("request %v %v", username, password)
+// authorizeUser looks the user up and evaluates its check items. It returns
+// nil and the message of the reject when the user may not authenticate.
+func authorizeUser(r *radius.Request, username string) (*authorizedUser, string) {
+	user, err := database.GetUserByUsername(username)
+	if err != nil {
+		logger.Logger.Error().Str("username", username).Msgf("Get user error. %s", err.Error())
+		return nil, rejectMessageInternalError
+	}
+	authorization, err := policy.Authorize(r.Packet, username)
+	if err != nil {
+		logger.Logger.Error().Str("username", username).Msgf("Authorize user error. %s", err.Error())
+		return nil, rejectMessageInternalError
+	}
+	if user == nil && !authorization.Found {
+		logger.Logger.Info().Str("username", username).Msg("Access rejected. User not found")
+		return nil, rejectMessageInvalidCredentials
+	}
+	if user == nil {
+		// users defined only by check items, as in FreeRADIUS radcheck
+		user = &entities.RadiusUser{Username: username, IsActive: true}
+	}
+	if !user.IsActive {
+		logger.Logger.Info().Str("username", username).Msg("Access rejected. User is disabled")
+		return nil, rejectMessageUserDisabled
+	}
+	if !authorization.UserMatched {
+		logger.Logger.Info().Str("username", username).Msg("Access rejected. Check items do not match")
+		return nil, rejectMessageInvalidCredentials
+	}
+	applyControlCredentials(user, authorization.Control)
+
+	if authType, _ := authorization.Control.Get(policy.AttributeAuthType); strings.EqualFold(authType, "reject") {
+		logger.Logger.Info().Str("username", username).Msg("Access rejected. Auth-Type Reject")
+		return nil, rejectMessageInvalidCredentials
+	}
+	return &authorizedUser{user: user, authorization: authorization}, ""
+}
+
+// applyReplyItems adds the reply items of the user to an Access-Accept.
+func applyReplyItems(r *radius.Request, authorized *authorizedUser, response *radius.Packet) *radius.Packet {
+	if err := policy.ApplyReply(response, authorized.authorization.Reply); err != nil {
+		logger.Logger.Error().Str("username", authorized.user.Username).Msgf("Apply reply items error. %s", err.Error())
+		return rejectResponse(r, rejectMessageInternalError)
+	}
+	return response
+}
+
+// authenticateCredentials verifies the credentials of the request with the
+// method they were sent with.
+func authenticateCredentials(r *radius.Request, user *entities.RadiusUser) *radius.Packet {
+	switch {
+	case len(microsoft.MSCHAP2Response_Get(r.Packet)) > 0:
+		return mschapv2Authenticate(r, user)
+	case len(rfc2865.CHAPPassword_Get(r.Packet)) > 0:
+		return chapAuthenticate(r, user)
+	case len(rfc2865.UserPassword_Get(r.Packet)) > 0:
+		return papAuthenticate(r, user)
+	default:
+		logger.Logger.Info().Str("username", user.Username).Msg("Access rejected. No supported credentials in request")
+		return rejectResponse(r, rejectMessageUnsupportedMethod)
+	}
+}
+
+// applyControlCredentials replaces the stored credentials of the user with the
+// Cleartext-Password and NT-Password control items.
+func applyControlCredentials(user *entities.RadiusUser, control policy.Items) {
+	if password, ok := control.Get(policy.AttributeCleartextPassword); ok {
+		user.Password = ""
+		user.CleartextPassword = &password
+		user.NtPasswordHash = nil
+	}
+	if hash, ok := control.Get(policy.AttributeNtPassword); ok {
+		hash = strings.TrimPrefix(strings.ToLower(hash), "0x")
+		user.NtPasswordHash = &hash
+	}
+}
+
+func acceptResponse(r *radius.Request) *radius.Packet {
+	return r.Response(radius.CodeAccessAccept)
+}
 
-	w.Write(r.Response(radius.CodeAccessAccept))
+func rejectResponse(r *radius.Request, message string) *radius.Packet {
+	response := r.Response(radius.CodeAccessReject)
+	rfc2865.ReplyMessage_SetString(response, message)
+	if eapMessage := requestEapMessage(r); eapMessage != nil {
+		// An Access-Reject ends the EAP conversation (RFC 3579 section 2.6.3)
+		if err := dictionary.Add(response, "EAP-Message", eap.FailureMessage(eapMessage)); err != nil {
+			logger.Logger.Error().Msgf("Set EAP-Message error. %s", err.Error())
+		}
+	}
+	return response
 }
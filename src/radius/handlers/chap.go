@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/database/entities"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+)
+
+const (
+	chapPasswordLength = 17
+
+	rejectMessageChapMalformed        = "Malformed CHAP-Password"
+	rejectMessageChapNoCleartext      = "CHAP is not available for this user, only a one-way password hash is stored"
+	rejectMessageChapChallengeInvalid = "Invalid CHAP-Challenge"
+)
+
+// chapAuthenticate verifies CHAP-Password (RFC 2865 section 5.3). The
+// challenge is taken from CHAP-Challenge or, when absent, from the Request
+// Authenticator. CHAP requires the cleartext password, so users that only
+// have a bcrypt hash are rejected with an explicit reason.
+func chapAuthenticate(r *radius.Request, user *entities.RadiusUser) *radius.Packet {
+	chapPassword := rfc2865.CHAPPassword_Get(r.Packet)
+	if len(chapPassword) != chapPasswordLength {
+		logger.Logger.Info().Str("username", user.Username).Msg("CHAP access rejected. Malformed CHAP-Password")
+		return rejectResponse(r, rejectMessageChapMalformed)
+	}
+
+	challenge := rfc2865.CHAPChallenge_Get(r.Packet)
+	if challenge == nil {
+		challenge = r.Authenticator[:]
+	} else if len(challenge) < 5 {
+		logger.Logger.Info().Str("username", user.Username).Msg("CHAP access rejected. CHAP-Challenge is too short")
+		return rejectResponse(r, rejectMessageChapChallengeInvalid)
+	}
+
+	if user.CleartextPassword == nil || *user.CleartextPassword == "" {
+		logger.Logger.Info().Str("username", user.Username).Msg("CHAP access rejected. No cleartext credential stored")
+		return rejectResponse(r, rejectMessageChapNoCleartext)
+	}
+
+	expected := chapResponse(chapPassword[0], []byte(*user.CleartextPassword), challenge)
+	if subtle.ConstantTimeCompare(expected, chapPassword[1:]) != 1 {
+		logger.Logger.Info().Str("username", user.Username).Msg("CHAP access rejected. Response mismatch")
+		return rejectResponse(r, rejectMessageInvalidCredentials)
+	}
+
+	logger.Logger.Info().Str("username", user.Username).Msg("CHAP access accepted")
+	return acceptResponse(r)
+}
+
+// chapResponse computes MD5(CHAP ID + secret + challenge) as defined in RFC 1994.
+func chapResponse(id byte, secret, challenge []byte) []byte {
+	hash := md5.New()
+	hash.Write([]byte{id})
+	hash.Write(secret)
+	hash.Write(challenge)
+	return hash.Sum(nil)
+}
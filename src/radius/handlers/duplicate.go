@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/config"
+	"radius-server/src/metrics"
+	timeUtil "radius-server/src/utils/time"
+
+	"layeh.com/radius"
+)
+
+// Duplicate request detection (RFC 5080 section 2.2.2). A retransmission is
+// recognised by source address, port, Identifier and Request Authenticator:
+// while the original is being processed it is discarded, afterwards the cached
+// response is sent again instead of running the handler twice.
+
+type duplicateKey struct {
+	remote        string
+	identifier    byte
+	authenticator [16]byte
+}
+
+type duplicateEntry struct {
+	response  *radius.Packet
+	done      bool
+	expiresAt time.Time
+}
+
+type duplicateCache struct {
+	mu          sync.Mutex
+	entries     map[duplicateKey]*duplicateEntry
+	ttl         time.Duration
+	maxSize     int
+	lastCleanup time.Time
+}
+
+// WithDuplicateDetection wraps next with its own response cache. It must wrap
+// WithMessageAuthenticator, so the cached response is the signed packet.
+func WithDuplicateDetection(next radius.Handler) radius.Handler {
+	cache := &duplicateCache{
+		entries:     map[duplicateKey]*duplicateEntry{},
+		ttl:         timeUtil.DurationSeconds(config.AppConfig.RadiusServer.DuplicateCacheTtlSec),
+		maxSize:     config.AppConfig.RadiusServer.DuplicateCacheMaxSize,
+		lastCleanup: time.Now(),
+	}
+
+	return radius.HandlerFunc(func(w radius.ResponseWriter, r *radius.Request) {
+		key := duplicateKey{
+			remote:        r.RemoteAddr.String(),
+			identifier:    r.Identifier,
+			authenticator: r.Authenticator,
+		}
+
+		entry, tracked := cache.begin(key)
+		if entry != nil {
+			if !entry.done {
+				metrics.CreateDuplicateRequestMetric(metrics.DuplicateDiscarded)
+				return
+			}
+			metrics.CreateDuplicateRequestMetric(metrics.DuplicateReplayed)
+			if err := w.Write(entry.response); err != nil {
+				logger.Logger.Error().Str("remote", key.remote).Msgf("Write cached response error. %s", err.Error())
+			}
+			return
+		}
+		if !tracked {
+			next.ServeRADIUS(w, r)
+			return
+		}
+
+		writer := &capturingWriter{ResponseWriter: w}
+		next.ServeRADIUS(writer, r)
+		cache.finish(key, writer.response)
+	})
+}
+
+// begin returns the existing entry for a duplicate. Otherwise it records the
+// request as in flight and reports whether it is tracked, which it is not
+// when the cache is full.
+func (c *duplicateCache) begin(key duplicateKey) (*duplicateEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastCleanup) >= c.ttl {
+		c.cleanupLocked(now)
+	}
+
+	if entry, ok := c.entries[key]; ok && now.Before(entry.expiresAt) {
+		return entry, true
+	}
+	if len(c.entries) >= c.maxSize {
+		return nil, false
+	}
+	c.entries[key] = &duplicateEntry{expiresAt: now.Add(c.ttl)}
+	return nil, true
+}
+
+// finish stores the response. Requests that got no response are forgotten,
+// so a retransmission is processed again (e.g. after a database error).
+func (c *duplicateCache) finish(key duplicateKey, response *radius.Packet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if response == nil {
+		delete(c.entries, key)
+		return
+	}
+	c.entries[key] = &duplicateEntry{
+		response:  response,
+		done:      true,
+		expiresAt: time.Now().Add(c.ttl),
+	}
+}
+
+func (c *duplicateCache) cleanupLocked(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	c.lastCleanup = now
+}
+
+type capturingWriter struct {
+	radius.ResponseWriter
+	response *radius.Packet
+}
+
+func (w *capturingWriter) Write(p *radius.Packet) error {
+	w.response = p
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/config"
+	"radius-server/src/database/entities"
+	"radius-server/src/metrics"
+	"radius-server/src/radius/dictionary"
+	"radius-server/src/radius/eap"
+	"radius-server/src/radius/revocation"
+	timeUtil "radius-server/src/utils/time"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/vendors/microsoft"
+)
+
+// EAP over RADIUS (RFC 3579). The EAP packet is split over EAP-Message
+// attributes and every round trip of the conversation is an Access-Challenge.
+
+var eapServer *eap.Server
+
+// InitEap creates the EAP server from the configuration. It must be called
+// before the access handler serves requests.
+func InitEap() error {
+	methods := []eap.Type{}
+	for _, name := range config.AppConfig.RadiusServer.Eap.Methods {
+		if name == "" {
+			continue
+		}
+		method, err := eap.ParseMethod(name)
+		if err != nil {
+			return err
+		}
+		if method == eap.TypeGtc {
+			return errors.New("EAP-GTC sends the password in clear text, it is only offered inside EAP-TTLS and cannot be enabled in EAP_METHODS")
+		}
+		methods = append(methods, method)
+	}
+
+	server := eap.NewServer(eap.Config{
+		Methods:     methods,
+		SessionTtl:  timeUtil.DurationSeconds(config.AppConfig.RadiusServer.Eap.SessionTtlSec),
+		MaxSessions: config.AppConfig.RadiusServer.Eap.MaxSessions,
+	})
+	if slices.Contains(methods, eap.TypeTls) || slices.Contains(methods, eap.TypePeap) || slices.Contains(methods, eap.TypeTtls) {
+		tlsConfig, err := eapTlsConfig()
+		if err != nil {
+			return err
+		}
+		if slices.Contains(methods, eap.TypeTls) {
+			if tlsConfig.Tls.ClientCAs == nil {
+				return errors.New("EAP_TLS_CA_FILE is required for EAP-TLS")
+			}
+			server.Register(eap.TypeTls, eap.NewTls(tlsConfig))
+		}
+		server.Register(eap.TypePeap, eap.NewPeap(tlsConfig))
+		server.Register(eap.TypeTtls, eap.NewTtls(tlsConfig))
+	}
+	eapServer = server
+	return nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// eapTlsConfig loads the server certificate and, when configured, the CA
+// bundle client certificates are verified against.
+func eapTlsConfig() (eap.TlsConfig, error) {
+	eapConfig := config.AppConfig.RadiusServer.Eap
+	if eapConfig.TlsCertFile == "" || eapConfig.TlsKeyFile == "" {
+		return eap.TlsConfig{}, errors.New("EAP_TLS_CERT_FILE and EAP_TLS_KEY_FILE are required for EAP-TLS, PEAP and EAP-TTLS")
+	}
+	minVersion, minOk := tlsVersions[eapConfig.TlsMinVersion]
+	maxVersion, maxOk := tlsVersions[eapConfig.TlsMaxVersion]
+	if !minOk || !maxOk || minVersion > maxVersion {
+		return eap.TlsConfig{}, fmt.Errorf("invalid EAP TLS versions %s to %s", eapConfig.TlsMinVersion, eapConfig.TlsMaxVersion)
+	}
+
+	certificate, err := tls.LoadX509KeyPair(eapConfig.TlsCertFile, eapConfig.TlsKeyFile)
+	if err != nil {
+		return eap.TlsConfig{}, fmt.Errorf("load EAP TLS certificate: %w", err)
+	}
+	var clientCas *x509.CertPool
+	if eapConfig.TlsCaFile != "" {
+		caPem, err := os.ReadFile(eapConfig.TlsCaFile)
+		if err != nil {
+			return eap.TlsConfig{}, fmt.Errorf("load EAP TLS CA: %w", err)
+		}
+		clientCas = x509.NewCertPool()
+		if !clientCas.AppendCertsFromPEM(caPem) {
+			return eap.TlsConfig{}, fmt.Errorf("load EAP TLS CA: no certificate found in %s", eapConfig.TlsCaFile)
+		}
+	}
+
+	return eap.TlsConfig{
+		Tls: &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			ClientCAs:    clientCas,
+			MinVersion:   minVersion,
+			MaxVersion:   maxVersion,
+		},
+		FragmentSize:     eapConfig.TlsFragmentSize,
+		CheckIdentity:    eapConfig.TlsCheckIdentity,
+		VerifyRevocation: revocation.VerifyConnection,
+		ResumptionTtl:    timeUtil.DurationSeconds(eapConfig.TtlsResumptionTtlSec),
+		MaxResumptions:   eapConfig.MaxSessions,
+	}, nil
+}
+
+// requestEapMessage returns the joined EAP-Message attributes of the
+// request, nil when there are none.
+func requestEapMessage(r *radius.Request) []byte {
+	value, err := dictionary.Lookup(r.Packet, "EAP-Message")
+	if err != nil {
+		return nil
+	}
+	message, _ := value.([]byte)
+	return message
+}
+
+// eapAuthenticate runs one round of the EAP conversation of the request. A
+// nil response means the request is discarded.
+func eapAuthenticate(r *radius.Request, username string, message []byte) *radius.Packet {
+	// EAP-Message without a valid Message-Authenticator is silently
+	// discarded whatever the NAS policy (RFC 3579 section 3.2)
+	present, valid := verifyMessageAuthenticator(r.Packet)
+	if !present || !valid {
+		reason := metrics.MessageAuthenticatorMissing
+		if present {
+			reason = metrics.MessageAuthenticatorInvalid
+		}
+		logger.Logger.Warn().Str("remote", r.RemoteAddr.String()).Msg("Request dropped. EAP-Message without valid Message-Authenticator")
+		metrics.CreateDroppedPacketMetric(reason)
+		return nil
+	}
+
+	owner, err := eapOwner(r, username)
+	if err != nil {
+		logger.Logger.Error().Str("username", username).Msgf("Resolve EAP conversation NAS error. %s", err.Error())
+		return rejectResponse(r, rejectMessageInternalError)
+	}
+	reply := eapServer.Handle(owner, rfc2865.State_Get(r.Packet), message, eapUsers{r: r})
+
+	switch reply.Action {
+	case eap.ActionChallenge:
+		response := r.Response(radius.CodeAccessChallenge)
+		if err := rfc2865.State_Set(response, reply.State); err != nil {
+			logger.Logger.Error().Str("username", username).Msgf("Set State error. %s", err.Error())
+			return rejectResponse(r, rejectMessageInternalError)
+		}
+		if err := dictionary.Add(response, "EAP-Message", reply.Message); err != nil {
+			logger.Logger.Error().Str("username", username).Msgf("Set EAP-Message error. %s", err.Error())
+			return rejectResponse(r, rejectMessageInternalError)
+		}
+		return response
+	case eap.ActionAccept:
+		return eapAccept(r, username, reply)
+	case eap.ActionDiscard:
+		logger.Logger.Info().Str("username", username).Msgf("EAP request dropped. %s", reply.Reason)
+		return nil
+	}
+	logger.Logger.Info().Str("username", username).Str("identity", reply.Identity).Msgf("EAP access rejected. %s", reply.Reason)
+	return rejectResponse(r, rejectMessageInvalidCredentials)
+}
+
+// eapAccept answers a successful conversation with the reply items of the
+// authenticated identity, the inner identity of tunneled methods.
+func eapAccept(r *radius.Request, username string, reply eap.Reply) *radius.Packet {
+	authorized, rejectMessage := authorizeUser(r, reply.Identity)
+	if authorized == nil {
+		return rejectResponse(r, rejectMessage)
+	}
+
+	response := acceptResponse(r)
+	if err := dictionary.Add(response, "EAP-Message", reply.Message); err != nil {
+		logger.Logger.Error().Str("username", username).Msgf("Set EAP-Message error. %s", err.Error())
+		return rejectResponse(r, rejectMessageInternalError)
+	}
+	if err := addEapKeys(response, reply.Msk); err != nil {
+		logger.Logger.Error().Str("username", username).Msgf("EAP-%s add MPPE keys error. %s", reply.Method, err.Error())
+		return rejectResponse(r, rejectMessageInternalError)
+	}
+	logger.Logger.Info().Str("username", username).Str("identity", reply.Identity).Msgf("EAP-%s access accepted", reply.Method)
+	return applyReplyItems(r, authorized, response)
+}
+
+// addEapKeys hands the Master Session Key to the NAS, its first half as
+// MS-MPPE-Recv-Key and its second half as MS-MPPE-Send-Key (RFC 5216
+// section 2.3).
+func addEapKeys(p *radius.Packet, msk []byte) error {
+	if len(msk) == 0 {
+		return nil
+	}
+	half := len(msk) / 2
+	if err := microsoft.MSMPPERecvKey_Add(p, msk[:half]); err != nil {
+		return err
+	}
+	return microsoft.MSMPPESendKey_Add(p, msk[half:])
+}
+
+// eapOwner binds a conversation to the NAS and the user name, so a State is
+// not accepted from another NAS or for another user.
+func eapOwner(r *radius.Request, username string) (string, error) {
+	nas, err := requestNas(r)
+	if err != nil {
+		return "", err
+	}
+	if nas == nil {
+		return "", errors.New("unknown NAS")
+	}
+	return strconv.FormatInt(nas.Id, 10) + "/" + username, nil
+}
+
+// eapUsers resolves the identities of an EAP conversation with the user
+// store and the check items, evaluated against the request.
+type eapUsers struct {
+	r *radius.Request
+}
+
+func (u eapUsers) Credentials(identity string) (eap.Credentials, error) {
+	authorized, rejectMessage := authorizeUser(u.r, identity)
+	if rejectMessage == rejectMessageInternalError {
+		return nil, errors.New("user lookup failed")
+	}
+	if authorized == nil {
+		return nil, nil
+	}
+	return eapCredentials{user: authorized.user}, nil
+}
+
+// eapCredentials exposes the credentials of a user to the EAP methods.
+type eapCredentials struct {
+	user *entities.RadiusUser
+}
+
+func (c eapCredentials) CleartextPassword() (string, bool) {
+	if c.user.CleartextPassword == nil || *c.user.CleartextPassword == "" {
+		return "", false
+	}
+	return *c.user.CleartextPassword, true
+}
+
+func (c eapCredentials) VerifyPassword(password string) bool {
+	return papPasswordMatches(c.user, password)
+}
+
+func (c eapCredentials) NtPasswordHash() ([]byte, bool) {
+	return userNtPasswordHash(c.user)
+}
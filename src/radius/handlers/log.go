@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"radius-server/src/common/logger"
+	"radius-server/src/radius/dictionary"
+
+	"layeh.com/radius"
+)
+
+// logRequestAttributes writes the attributes of a request, decoded with the
+// dictionary, at debug level.
+func logRequestAttributes(r *radius.Request) {
+	event := logger.Logger.Debug()
+	if !event.Enabled() {
+		return
+	}
+	event.Str("remote", r.RemoteAddr.String()).
+		Str("code", r.Code.String()).
+		Strs("attributes", dictionary.Format(r.Packet)).
+		Msg("Request received")
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"errors"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/database/entities"
+	"radius-server/src/metrics"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2869"
+)
+
+// Message-Authenticator (RFC 3579 section 3.2) handling, the mitigation for
+// the Blast-RADIUS forgery attack (CVE-2024-3596). Only the require policy
+// protects a NAS: the attacker strips Message-Authenticator from the forged
+// request, which require-if-present accepts. New NAS default to require,
+// require-if-present is for NAS that cannot send it yet.
+
+const messageAuthenticatorLength = md5.Size
+
+// WithMessageAuthenticator enforces the Message-Authenticator policy of the
+// NAS on incoming requests and adds Message-Authenticator as the first
+// attribute of every response. Requests failing the policy are silently
+// discarded.
+func WithMessageAuthenticator(next radius.Handler) radius.Handler {
+	return radius.HandlerFunc(func(w radius.ResponseWriter, r *radius.Request) {
+		policy := nasMessageAuthenticatorPolicy(r)
+		if policy != entities.MessageAuthenticatorOff {
+			present, valid := verifyMessageAuthenticator(r.Packet)
+			if present && !valid {
+				logger.Logger.Warn().Str("remote", r.RemoteAddr.String()).Msg("Request dropped. Invalid Message-Authenticator")
+				metrics.CreateDroppedPacketMetric(metrics.MessageAuthenticatorInvalid)
+				return
+			}
+			if !present && r.Code == radius.CodeAccessRequest && policy == entities.MessageAuthenticatorRequire {
+				logger.Logger.Warn().Str("remote", r.RemoteAddr.String()).Msg("Request dropped. Missing Message-Authenticator")
+				metrics.CreateDroppedPacketMetric(metrics.MessageAuthenticatorMissing)
+				return
+			}
+		}
+
+		next.ServeRADIUS(&messageAuthenticatorWriter{ResponseWriter: w}, r)
+	})
+}
+
+func nasMessageAuthenticatorPolicy(r *radius.Request) entities.MessageAuthenticatorPolicy {
+	nas, err := requestNas(r)
+	if err != nil || nas == nil || nas.MessageAuthenticatorPolicy == "" {
+		// The secret was resolved a moment ago, so fail closed
+		return entities.MessageAuthenticatorRequire
+	}
+	return nas.MessageAuthenticatorPolicy
+}
+
+type messageAuthenticatorWriter struct {
+	radius.ResponseWriter
+}
+
+func (w *messageAuthenticatorWriter) Write(p *radius.Packet) error {
+	if err := SignMessageAuthenticator(p); err != nil {
+		return err
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// SignMessageAuthenticator places Message-Authenticator first in the packet
+// and fills it with HMAC-MD5 over the packet, keyed with the shared secret.
+// For responses p.Authenticator must still hold the Request Authenticator,
+// as it does for packets created by Packet.Response.
+func SignMessageAuthenticator(p *radius.Packet) error {
+	rfc2869.MessageAuthenticator_Del(p)
+	p.Attributes = append(radius.Attributes{{
+		Type:      rfc2869.MessageAuthenticator_Type,
+		Attribute: make(radius.Attribute, messageAuthenticatorLength),
+	}}, p.Attributes...)
+
+	raw, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	copy(p.Attributes[0].Attribute, messageAuthenticatorHash(raw, p.Secret))
+	return nil
+}
+
+// verifyMessageAuthenticator reports whether the packet carries exactly one
+// Message-Authenticator and whether it matches.
+func verifyMessageAuthenticator(p *radius.Packet) (present bool, valid bool) {
+	raw, err := p.MarshalBinary()
+	if err != nil {
+		return false, false
+	}
+	offset, err := messageAuthenticatorOffset(raw)
+	if err != nil {
+		return true, false
+	}
+	if offset < 0 {
+		return false, false
+	}
+
+	received := append([]byte(nil), raw[offset:offset+messageAuthenticatorLength]...)
+	clear(raw[offset : offset+messageAuthenticatorLength])
+	switch p.Code {
+	case radius.CodeAccountingRequest, radius.CodeDisconnectRequest, radius.CodeCoARequest:
+		// The Request Authenticator of these requests is itself a hash over
+		// the packet, so it is zeroed for the HMAC
+		clear(raw[4:20])
+	}
+	return true, hmac.Equal(received, messageAuthenticatorHash(raw, p.Secret))
+}
+
+// messageAuthenticatorOffset returns the offset of the Message-Authenticator
+// value in an encoded packet, or -1 when the attribute is absent.
+func messageAuthenticatorOffset(raw []byte) (int, error) {
+	offset := -1
+	for i := 20; i+2 <= len(raw); {
+		length := int(raw[i+1])
+		if length < 2 || i+length > len(raw) {
+			return -1, errors.New("malformed attributes")
+		}
+		if radius.Type(raw[i]) == rfc2869.MessageAuthenticator_Type {
+			if offset >= 0 || length != 2+messageAuthenticatorLength {
+				return -1, errors.New("malformed Message-Authenticator")
+			}
+			offset = i + 2
+		}
+		i += length
+	}
+	return offset, nil
+}
+
+func messageAuthenticatorHash(raw []byte, secret []byte) []byte {
+	hash := hmac.New(md5.New, secret)
+	hash.Write(raw)
+	return hash.Sum(nil)
+}
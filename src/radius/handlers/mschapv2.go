@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/database/entities"
+	"radius-server/src/radius/mschap"
+	cryptoUtil "radius-server/src/utils/crypto"
+
+	"layeh.com/radius"
+	"layeh.com/radius/vendors/microsoft"
+)
+
+const (
+	mschapChallengeLength  = 16
+	mschap2ResponseLength  = 50
+	mschapErrorAuthFailure = 691
+
+	rejectMessageMschapMalformed = "Malformed MS-CHAPv2 request"
+	rejectMessageMschapNoHash    = "MS-CHAPv2 is not available for this user, no NT password hash is stored"
+)
+
+// mschapv2Authenticate verifies MS-CHAP2-Response (RFC 2548 section 2.3.2)
+// against the NT hash of the user. On success MS-CHAP2-Success and the
+// salt-encrypted MS-MPPE-Send/Recv-Key are returned, on failure MS-CHAP-Error.
+func mschapv2Authenticate(r *radius.Request, user *entities.RadiusUser) *radius.Packet {
+	challenge := microsoft.MSCHAPChallenge_Get(r.Packet)
+	response := microsoft.MSCHAP2Response_Get(r.Packet)
+	if len(challenge) != mschapChallengeLength || len(response) != mschap2ResponseLength {
+		logger.Logger.Info().Str("username", user.Username).Msg("MS-CHAPv2 access rejected. Malformed challenge or response")
+		return rejectResponse(r, rejectMessageMschapMalformed)
+	}
+
+	// See RFC 2548 section 2.3.2 for the MS-CHAP2-Response layout
+	ident := response[0]
+	peerChallenge := response[2:18]
+	peerResponse := response[26:50]
+
+	ntHash, ok := userNtPasswordHash(user)
+	if !ok {
+		logger.Logger.Info().Str("username", user.Username).Msg("MS-CHAPv2 access rejected. No NT password hash stored")
+		return mschapErrorResponse(r, ident, challenge, rejectMessageMschapNoHash)
+	}
+
+	challengeUsername := mschap.ChallengeUsername(user.Username)
+	ntResponse := mschap.NtResponse(challenge, peerChallenge, challengeUsername, ntHash)
+	if subtle.ConstantTimeCompare(ntResponse, peerResponse) != 1 {
+		logger.Logger.Info().Str("username", user.Username).Msg("MS-CHAPv2 access rejected. Response mismatch")
+		return mschapErrorResponse(r, ident, challenge, rejectMessageInvalidCredentials)
+	}
+
+	sendKey, recvKey, err := mschap.MppeKeys(ntHash, ntResponse)
+	if err != nil {
+		logger.Logger.Error().Str("username", user.Username).Msgf("MS-CHAPv2 make MPPE keys error. %s", err.Error())
+		return rejectResponse(r, rejectMessageInternalError)
+	}
+
+	authenticatorResponse := mschap.AuthenticatorResponse(challenge, peerChallenge, ntResponse, challengeUsername, ntHash)
+	success := make([]byte, 0, 1+len(authenticatorResponse))
+	success = append(success, ident)
+	success = append(success, authenticatorResponse...)
+
+	accept := acceptResponse(r)
+	if err := addMppeAttributes(accept, success, sendKey, recvKey); err != nil {
+		logger.Logger.Error().Str("username", user.Username).Msgf("MS-CHAPv2 add MPPE attributes error. %s", err.Error())
+		return rejectResponse(r, rejectMessageInternalError)
+	}
+
+	logger.Logger.Info().Str("username", user.Username).Msg("MS-CHAPv2 access accepted")
+	return accept
+}
+
+func addMppeAttributes(p *radius.Packet, success, sendKey, recvKey []byte) error {
+	if err := microsoft.MSCHAP2Success_Add(p, success); err != nil {
+		return err
+	}
+	if err := microsoft.MSMPPESendKey_Add(p, sendKey); err != nil {
+		return err
+	}
+	if err := microsoft.MSMPPERecvKey_Add(p, recvKey); err != nil {
+		return err
+	}
+	if err := microsoft.MSMPPEEncryptionPolicy_Add(p, microsoft.MSMPPEEncryptionPolicy_Value_EncryptionAllowed); err != nil {
+		return err
+	}
+	return microsoft.MSMPPEEncryptionTypes_Add(p, microsoft.MSMPPEEncryptionTypes_Value_RC440or128BitAllowed)
+}
+
+// mschapErrorResponse builds an Access-Reject carrying MS-CHAP-Error
+// (RFC 2759 section 6) so the peer gets a proper failure packet.
+func mschapErrorResponse(r *radius.Request, ident byte, challenge []byte, message string) *radius.Packet {
+	response := rejectResponse(r, message)
+	mschapError := fmt.Sprintf("E=%d R=0 C=%s V=3 M=%s", mschapErrorAuthFailure, strings.ToUpper(hex.EncodeToString(challenge)), message)
+	microsoft.MSCHAPError_Add(response, append([]byte{ident}, mschapError...))
+	return response
+}
+
+// userNtPasswordHash returns the stored NT hash of the user, falling back to
+// hashing the cleartext credential when only that is available.
+func userNtPasswordHash(user *entities.RadiusUser) ([]byte, bool) {
+	if user.NtPasswordHash != nil && *user.NtPasswordHash != "" {
+		return cryptoUtil.DecodeNtPasswordHash(*user.NtPasswordHash)
+	}
+	if user.CleartextPassword != nil && *user.CleartextPassword != "" {
+		return cryptoUtil.NtPasswordHash(*user.CleartextPassword), true
+	}
+	return nil, false
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"context"
+
+	"radius-server/src/cache"
+	"radius-server/src/database/entities"
+	networkUtil "radius-server/src/utils/network"
+
+	"layeh.com/radius"
+)
+
+type nasContextKey struct{}
+
+// ContextWithNas attaches the NAS a connection was authenticated as, for
+// transports where the source address does not identify the NAS (RadSec).
+func ContextWithNas(ctx context.Context, nas *entities.RadiusNas) context.Context {
+	return context.WithValue(ctx, nasContextKey{}, nas)
+}
+
+// requestNas returns the NAS attached to the request context, or the NAS
+// registered for the packet source address.
+func requestNas(r *radius.Request) (*entities.RadiusNas, error) {
+	if nas, ok := r.Context().Value(nasContextKey{}).(*entities.RadiusNas); ok && nas != nil {
+		return nas, nil
+	}
+	ip, err := networkUtil.AddrFromNetAddr(r.RemoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	return cache.GetNasByIp(ip.String())
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"crypto/subtle"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/database/entities"
+	cryptoUtil "radius-server/src/utils/crypto"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+)
+
+// papAuthenticate verifies User-Password (RFC 2865 section 5.2) against the
+// bcrypt hash of the user, or its cleartext password or NT hash when it has
+// no bcrypt hash. The decrypted password is never logged.
+func papAuthenticate(r *radius.Request, user *entities.RadiusUser) *radius.Packet {
+	password := rfc2865.UserPassword_GetString(r.Packet)
+	if password == "" || !papPasswordMatches(user, password) {
+		logger.Logger.Info().Str("username", user.Username).Msg("PAP access rejected. Password mismatch")
+		return rejectResponse(r, rejectMessageInvalidCredentials)
+	}
+
+	logger.Logger.Info().Str("username", user.Username).Msg("PAP access accepted")
+	return acceptResponse(r)
+}
+
+func papPasswordMatches(user *entities.RadiusUser, password string) bool {
+	if user.Password != "" {
+		return cryptoUtil.ComparePassword(user.Password, password)
+	}
+	if user.CleartextPassword != nil && *user.CleartextPassword != "" {
+		return subtle.ConstantTimeCompare([]byte(*user.CleartextPassword), []byte(password)) == 1
+	}
+	if ntHash, ok := userNtPasswordHash(user); ok {
+		return subtle.ConstantTimeCompare(ntHash, cryptoUtil.NtPasswordHash(password)) == 1
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/binary"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/config"
+	"radius-server/src/metrics"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+)
+
+// Status-Server (RFC 5997) support. Statistics are returned in the FreeRADIUS
+// vendor attributes, which existing monitoring tools (radclient, radsniff,
+// collectd) already understand, when the request carries
+// FreeRADIUS-Statistics-Type and STATUS_SERVER_STATISTICS is enabled.
+
+const (
+	freeRadiusVendorId = 11344
+
+	freeRadiusStatisticsType           byte = 127
+	freeRadiusTotalAccessRequests      byte = 128
+	freeRadiusTotalAccessAccepts       byte = 129
+	freeRadiusTotalAccessRejects       byte = 130
+	freeRadiusTotalAuthResponses       byte = 132
+	freeRadiusTotalAccountingRequests  byte = 138
+	freeRadiusTotalAccountingResponses byte = 139
+	freeRadiusStatsStartTime           byte = 176
+
+	freeRadiusStatisticsAuthentication uint32 = 1
+	freeRadiusStatisticsAccounting     uint32 = 2
+)
+
+var accountingRequestTypes = []metrics.RadiusRequestTypes{metrics.AccountingStart, metrics.AccountingStop, metrics.InterimUpdate}
+
+// WithStatusServer answers Status-Server requests with responseCode
+// (Access-Accept on the authentication port, Accounting-Response on the
+// accounting port) and passes every other request to next. Status-Server
+// without a valid Message-Authenticator is silently discarded, and responses
+// are not cached for duplicate detection.
+func WithStatusServer(next radius.Handler, responseCode radius.Code) radius.Handler {
+	return radius.HandlerFunc(func(w radius.ResponseWriter, r *radius.Request) {
+		if r.Code != radius.CodeStatusServer {
+			next.ServeRADIUS(w, r)
+			return
+		}
+
+		present, valid := verifyMessageAuthenticator(r.Packet)
+		if !present || !valid {
+			logger.Logger.Warn().Str("remote", r.RemoteAddr.String()).Msg("Status-Server dropped. Missing or invalid Message-Authenticator")
+			if present {
+				metrics.CreateDroppedPacketMetric(metrics.MessageAuthenticatorInvalid)
+			} else {
+				metrics.CreateDroppedPacketMetric(metrics.MessageAuthenticatorMissing)
+			}
+			return
+		}
+
+		response := r.Response(responseCode)
+		if config.AppConfig.RadiusServer.StatusServerStatistics {
+			if statisticsType, ok := requestedStatisticsType(r.Packet); ok {
+				addStatistics(response, statisticsType, responseCode)
+			}
+		}
+		if err := SignMessageAuthenticator(response); err != nil {
+			logger.Logger.Error().Str("remote", r.RemoteAddr.String()).Msgf("Sign Status-Server response error. %s", err.Error())
+			return
+		}
+		if err := w.Write(response); err != nil {
+			logger.Logger.Error().Str("remote", r.RemoteAddr.String()).Msgf("Write Status-Server response error. %s", err.Error())
+		}
+	})
+}
+
+func requestedStatisticsType(p *radius.Packet) (uint32, bool) {
+	value, ok := freeRadiusAttribute(p, freeRadiusStatisticsType)
+	if !ok || len(value) != 4 {
+		return 0, false
+	}
+	statisticsType := binary.BigEndian.Uint32(value)
+	return statisticsType, statisticsType != 0
+}
+
+func addStatistics(p *radius.Packet, statisticsType uint32, responseCode radius.Code) {
+	addFreeRadiusInteger(p, freeRadiusStatisticsType, statisticsType)
+
+	if responseCode == radius.CodeAccessAccept && statisticsType&freeRadiusStatisticsAuthentication != 0 {
+		accepts := metrics.GetRequestCount(metrics.AccessRequest, metrics.Success)
+		rejects := metrics.GetRequestCount(metrics.AccessRequest, metrics.Failure)
+		addFreeRadiusInteger(p, freeRadiusTotalAccessRequests, uint32(accepts+rejects))
+		addFreeRadiusInteger(p, freeRadiusTotalAccessAccepts, uint32(accepts))
+		addFreeRadiusInteger(p, freeRadiusTotalAccessRejects, uint32(rejects))
+		addFreeRadiusInteger(p, freeRadiusTotalAuthResponses, uint32(accepts+rejects))
+	}
+	if responseCode == radius.CodeAccountingResponse && statisticsType&freeRadiusStatisticsAccounting != 0 {
+		var requests, responses int64
+		for _, requestType := range accountingRequestTypes {
+			successes := metrics.GetRequestCount(requestType, metrics.Success)
+			requests += successes + metrics.GetRequestCount(requestType, metrics.Failure)
+			responses += successes
+		}
+		addFreeRadiusInteger(p, freeRadiusTotalAccountingRequests, uint32(requests))
+		addFreeRadiusInteger(p, freeRadiusTotalAccountingResponses, uint32(responses))
+	}
+	addFreeRadiusInteger(p, freeRadiusStatsStartTime, uint32(metrics.StartTime.Unix()))
+}
+
+func freeRadiusAttribute(p *radius.Packet, typ byte) ([]byte, bool) {
+	for _, avp := range p.Attributes {
+		if avp.Type != rfc2865.VendorSpecific_Type {
+			continue
+		}
+		vendorId, value, err := radius.VendorSpecific(avp.Attribute)
+		if err != nil || vendorId != freeRadiusVendorId {
+			continue
+		}
+		for len(value) >= 2 {
+			length := int(value[1])
+			if length < 2 || length > len(value) {
+				break
+			}
+			if value[0] == typ {
+				return value[2:length], true
+			}
+			value = value[length:]
+		}
+	}
+	return nil, false
+}
+
+func addFreeRadiusInteger(p *radius.Packet, typ byte, value uint32) {
+	attribute := make(radius.Attribute, 6)
+	attribute[0] = typ
+	attribute[1] = byte(len(attribute))
+	binary.BigEndian.PutUint32(attribute[2:], value)
+	vsa, err := radius.NewVendorSpecific(freeRadiusVendorId, attribute)
+	if err != nil {
+		return
+	}
+	p.Add(rfc2865.VendorSpecific_Type, vsa)
+}
@@ -0,0 +1,82 @@
+package mschap
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/crypto/md4"
+	"layeh.com/radius/rfc2759"
+	"layeh.com/radius/rfc3079"
+)
+
+// MS-CHAPv2 helpers working on the NT password hash instead of the cleartext
+// password, so users only need their NT hash stored (RFC 2759, RFC 3079).
+
+var (
+	authenticatorMagic1 = []byte("Magic server to client signing constant")
+	authenticatorMagic2 = []byte("Pad to make it do more than one iteration")
+)
+
+// ChallengeUsername strips a prepended NT domain from the user name, as
+// required for the challenge hash (RFC 2759 section 8.2).
+func ChallengeUsername(username string) string {
+	if i := strings.LastIndex(username, "\\"); i >= 0 {
+		return username[i+1:]
+	}
+	return username
+}
+
+// NtResponse computes the expected 24 byte NT-Response (RFC 2759 section 8.1).
+func NtResponse(authenticatorChallenge, peerChallenge []byte, username string, ntHash []byte) []byte {
+	challenge := rfc2759.ChallengeHash(peerChallenge, authenticatorChallenge, []byte(username))
+	return rfc2759.ChallengeResponse(challenge, ntHash)
+}
+
+// AuthenticatorResponse computes the "S=" authenticator response string
+// (RFC 2759 section 8.7).
+func AuthenticatorResponse(authenticatorChallenge, peerChallenge, ntResponse []byte, username string, ntHash []byte) string {
+	ntHashHash := hashNtHash(ntHash)
+
+	sha := sha1.New()
+	sha.Write(ntHashHash)
+	sha.Write(ntResponse)
+	sha.Write(authenticatorMagic1)
+	digest := sha.Sum(nil)
+
+	challenge := rfc2759.ChallengeHash(peerChallenge, authenticatorChallenge, []byte(username))
+
+	sha = sha1.New()
+	sha.Write(digest)
+	sha.Write(challenge)
+	sha.Write(authenticatorMagic2)
+	digest = sha.Sum(nil)
+
+	return "S=" + strings.ToUpper(hex.EncodeToString(digest))
+}
+
+// MasterKey derives the 16 byte MPPE master key (RFC 3079 section 3.4).
+func MasterKey(ntHash, ntResponse []byte) []byte {
+	return rfc3079.GetMasterKey(hashNtHash(ntHash), ntResponse)
+}
+
+// MppeKeys derives the 128 bit MPPE send and receive keys from the server's
+// point of view (RFC 3079 section 3.4).
+func MppeKeys(ntHash, ntResponse []byte) (sendKey []byte, recvKey []byte, err error) {
+	masterKey := MasterKey(ntHash, ntResponse)
+	sendKey, err = rfc3079.GetAsymmetricStartKey(masterKey, rfc3079.KeyLength128Bit, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	recvKey, err = rfc3079.GetAsymmetricStartKey(masterKey, rfc3079.KeyLength128Bit, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sendKey, recvKey, nil
+}
+
+func hashNtHash(ntHash []byte) []byte {
+	h := md4.New()
+	h.Write(ntHash)
+	return h.Sum(nil)
+}
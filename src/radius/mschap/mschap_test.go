@@ -0,0 +1,88 @@
+package mschap
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	cryptoUtil "radius-server/src/utils/crypto"
+)
+
+// Test vectors of RFC 2759 section 9.2 and RFC 3079 section 3.5.3.
+
+const (
+	vectorUsername = "User"
+	vectorPassword = "clientPass"
+)
+
+var (
+	vectorAuthenticatorChallenge = decodeHex("5B5D7C7D7B3F2F3E3C2C602132262628")
+	vectorPeerChallenge          = decodeHex("21402324255E262A28295F2B3A337C7E")
+	vectorNtHash                 = decodeHex("44EBBA8D5312B8D611474411F56989AE")
+	vectorNtResponse             = decodeHex("82309ECD8D708B5EA08FAA3981CD83544233114A3D85D6DF")
+)
+
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestNtPasswordHash(t *testing.T) {
+	if got := cryptoUtil.NtPasswordHash(vectorPassword); !bytes.Equal(got, vectorNtHash) {
+		t.Errorf("NtPasswordHash %X, want %X", got, vectorNtHash)
+	}
+	if got, want := hashNtHash(vectorNtHash), decodeHex("41C00C584BD2D91C4017A2A12FA59F3F"); !bytes.Equal(got, want) {
+		t.Errorf("PasswordHashHash %X, want %X", got, want)
+	}
+}
+
+func TestNtResponse(t *testing.T) {
+	got := NtResponse(vectorAuthenticatorChallenge, vectorPeerChallenge, vectorUsername, vectorNtHash)
+	if !bytes.Equal(got, vectorNtResponse) {
+		t.Errorf("NtResponse %X, want %X", got, vectorNtResponse)
+	}
+}
+
+func TestAuthenticatorResponse(t *testing.T) {
+	got := AuthenticatorResponse(vectorAuthenticatorChallenge, vectorPeerChallenge, vectorNtResponse, vectorUsername, vectorNtHash)
+	if want := "S=407A5589115FD0D6209F510FE9C04566932CDA56"; got != want {
+		t.Errorf("AuthenticatorResponse %s, want %s", got, want)
+	}
+}
+
+func TestChallengeUsername(t *testing.T) {
+	for username, want := range map[string]string{
+		"User":                 vectorUsername,
+		"DOMAIN\\User":         vectorUsername,
+		"FOREST\\DOMAIN\\User": vectorUsername,
+	} {
+		if got := ChallengeUsername(username); got != want {
+			t.Errorf("ChallengeUsername(%q) %q, want %q", username, got, want)
+		}
+	}
+	// the domain is not part of the challenge hash
+	got := NtResponse(vectorAuthenticatorChallenge, vectorPeerChallenge, ChallengeUsername("DOMAIN\\"+vectorUsername), vectorNtHash)
+	if !bytes.Equal(got, vectorNtResponse) {
+		t.Errorf("NtResponse with a domain %X, want %X", got, vectorNtResponse)
+	}
+}
+
+func TestMppeKeys(t *testing.T) {
+	if got, want := MasterKey(vectorNtHash, vectorNtResponse), decodeHex("FDECE3717A8C838CB388E527AE3CDD31"); !bytes.Equal(got, want) {
+		t.Errorf("MasterKey %X, want %X", got, want)
+	}
+	sendKey, recvKey, err := MppeKeys(vectorNtHash, vectorNtResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SendStartKey128 of the sample is the key of the sending server
+	if want := decodeHex("8B7CDC149B993A1BA118CB153F56DCCB"); !bytes.Equal(sendKey, want) {
+		t.Errorf("send key %X, want %X", sendKey, want)
+	}
+	if len(recvKey) != 16 || bytes.Equal(recvKey, sendKey) {
+		t.Errorf("receive key %X, want 16 bytes distinct from the send key", recvKey)
+	}
+}
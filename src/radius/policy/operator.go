@@ -0,0 +1,171 @@
+package policy
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"radius-server/src/radius/dictionary"
+
+	"layeh.com/radius"
+)
+
+// Operator is a FreeRADIUS check or reply item operator.
+type Operator string
+
+const (
+	// OpSet adds the attribute unless it is already present
+	OpSet Operator = "="
+	// OpAssign replaces every instance of the attribute
+	OpAssign Operator = ":="
+	// OpAdd adds the attribute, even if it is already present
+	OpAdd Operator = "+="
+
+	OpEqual        Operator = "=="
+	OpNotEqual     Operator = "!="
+	OpGreater      Operator = ">"
+	OpGreaterEqual Operator = ">="
+	OpLess         Operator = "<"
+	OpLessEqual    Operator = "<="
+	OpRegex        Operator = "=~"
+	OpNotRegex     Operator = "!~"
+	OpPresent      Operator = "=*"
+	OpAbsent       Operator = "!*"
+)
+
+// IsComparison reports whether a check item with op is matched against the
+// request rather than added to the control items.
+func (op Operator) IsComparison() bool {
+	switch op {
+	case OpEqual, OpNotEqual, OpGreater, OpGreaterEqual, OpLess, OpLessEqual,
+		OpRegex, OpNotRegex, OpPresent, OpAbsent:
+		return true
+	}
+	return false
+}
+
+// IsAssignment reports whether op is valid on a reply item.
+func (op Operator) IsAssignment() bool {
+	switch op {
+	case OpSet, OpAssign, OpAdd:
+		return true
+	}
+	return false
+}
+
+// matchRequest reports whether the request satisfies the comparison item.
+// Any instance of the attribute may satisfy it, an absent attribute only
+// satisfies !*.
+func matchRequest(request *radius.Packet, item Item) (bool, error) {
+	values, err := dictionary.LookupAll(request, item.Attribute)
+	if errors.Is(err, radius.ErrNoAttribute) {
+		return item.Op == OpAbsent, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch item.Op {
+	case OpPresent:
+		return true, nil
+	case OpAbsent:
+		return false, nil
+	case OpRegex, OpNotRegex:
+		re, err := regexp.Compile(item.Value)
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression %q", item.Value)
+		}
+		for _, value := range values {
+			text, err := dictionary.FormatValue(item.Attribute, value)
+			if err != nil {
+				return false, err
+			}
+			if re.MatchString(text) == (item.Op == OpRegex) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	expected, err := dictionary.ParseValue(item.Attribute, item.Value)
+	if err != nil {
+		return false, err
+	}
+	for _, value := range values {
+		order, err := compareValues(item.Attribute, value, expected)
+		if err != nil {
+			return false, err
+		}
+		if item.Op.holds(order) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// holds reports whether the ordering of the request value against the item
+// value satisfies op.
+func (op Operator) holds(order int) bool {
+	switch op {
+	case OpEqual:
+		return order == 0
+	case OpNotEqual:
+		return order != 0
+	case OpGreater:
+		return order > 0
+	case OpGreaterEqual:
+		return order >= 0
+	case OpLess:
+		return order < 0
+	case OpLessEqual:
+		return order <= 0
+	}
+	return false
+}
+
+// compareValues orders integer and date values numerically and every other
+// value by its text form.
+func compareValues(name string, a any, b any) (int, error) {
+	if x, ok := unsigned(a); ok {
+		if y, ok := unsigned(b); ok {
+			return cmp.Compare(x, y), nil
+		}
+	}
+	if x, ok := a.(int32); ok {
+		if y, ok := b.(int32); ok {
+			return cmp.Compare(x, y), nil
+		}
+	}
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), nil
+		}
+	}
+
+	x, err := dictionary.FormatValue(name, a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := dictionary.FormatValue(name, b)
+	if err != nil {
+		return 0, err
+	}
+	return strings.Compare(x, y), nil
+}
+
+func unsigned(value any) (uint64, bool) {
+	switch v := value.(type) {
+	case uint64:
+		return v, true
+	case uint32:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint8:
+		return uint64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,231 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/database"
+	"radius-server/src/radius/dictionary"
+
+	"layeh.com/radius"
+)
+
+// Check and reply items evaluated like the FreeRADIUS sql module. The check
+// items of the user are matched against the request and, when they match,
+// its reply items are added to the reply. The groups of the user follow by
+// ascending priority unless the user reply sets Fall-Through = No. A group
+// whose check items match adds its reply items, and evaluation stops after
+// the first such group with reply items unless they set Fall-Through = Yes.
+// Check items that are not comparisons become control items.
+
+// Attributes interpreted by the server, they are never sent in a reply.
+const (
+	AttributeAuthType          = "Auth-Type"
+	AttributeCleartextPassword = "Cleartext-Password"
+	AttributeNtPassword        = "NT-Password"
+	AttributeFallThrough       = "Fall-Through"
+)
+
+// Item is a check or reply item, e.g. Calling-Station-Id =~ "^00:11".
+type Item struct {
+	Attribute string
+	Op        Operator
+	Value     string
+}
+
+// Items is a list of items, in the order they apply.
+type Items []Item
+
+// Get returns the value of the first item of attribute.
+func (items Items) Get(attribute string) (string, bool) {
+	for _, item := range items {
+		if strings.EqualFold(item.Attribute, attribute) {
+			return item.Value, true
+		}
+	}
+	return "", false
+}
+
+// merge applies item to items with the semantics of its operator.
+func (items Items) merge(item Item) Items {
+	switch item.Op {
+	case OpAssign:
+		items = slices.DeleteFunc(items, func(existing Item) bool {
+			return strings.EqualFold(existing.Attribute, item.Attribute)
+		})
+	case OpSet:
+		if _, ok := items.Get(item.Attribute); ok {
+			return items
+		}
+	}
+	return append(items, item)
+}
+
+// Result is the outcome of Authorize.
+type Result struct {
+	// Found is set when the user has check items, reply items or groups
+	Found bool
+	// UserMatched is set when the check items of the user match the
+	// request, or the user has none. The user must not authenticate
+	// otherwise.
+	UserMatched bool
+	// Control holds the check items that are not comparisons, e.g.
+	// Auth-Type := Reject
+	Control Items
+	// Reply holds the items to add to an Access-Accept
+	Reply Items
+}
+
+// Authorize evaluates the check and reply items of username against request.
+func Authorize(request *radius.Packet, username string) (*Result, error) {
+	checkItems, replyItems, err := userItems(username)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := database.GetUserGroups(username)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Found: len(checkItems) > 0 || len(replyItems) > 0 || len(groups) > 0}
+	matched, err := result.apply(request, "user "+username, checkItems, replyItems)
+	if err != nil {
+		return nil, err
+	}
+	result.UserMatched = matched
+	if matched {
+		if value, ok := replyItems.Get(AttributeFallThrough); ok && strings.EqualFold(value, "No") {
+			return result, nil
+		}
+	}
+
+	for _, group := range groups {
+		checkItems, replyItems, err := groupItems(group.GroupName)
+		if err != nil {
+			return nil, err
+		}
+		matched, err := result.apply(request, "group "+group.GroupName, checkItems, replyItems)
+		if err != nil {
+			return nil, err
+		}
+		if !matched || len(replyItems) == 0 {
+			continue
+		}
+		if value, ok := replyItems.Get(AttributeFallThrough); !ok || !strings.EqualFold(value, "Yes") {
+			break
+		}
+	}
+	return result, nil
+}
+
+func userItems(username string) (Items, Items, error) {
+	checks, err := database.GetUserCheckItems(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	replies, err := database.GetUserReplyItems(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	checkItems := make(Items, 0, len(checks))
+	for _, check := range checks {
+		checkItems = append(checkItems, Item{Attribute: check.Attribute, Op: Operator(check.Op), Value: check.Value})
+	}
+	replyItems := make(Items, 0, len(replies))
+	for _, reply := range replies {
+		replyItems = append(replyItems, Item{Attribute: reply.Attribute, Op: Operator(reply.Op), Value: reply.Value})
+	}
+	return checkItems, replyItems, nil
+}
+
+func groupItems(groupName string) (Items, Items, error) {
+	checks, err := database.GetGroupCheckItems(groupName)
+	if err != nil {
+		return nil, nil, err
+	}
+	replies, err := database.GetGroupReplyItems(groupName)
+	if err != nil {
+		return nil, nil, err
+	}
+	checkItems := make(Items, 0, len(checks))
+	for _, check := range checks {
+		checkItems = append(checkItems, Item{Attribute: check.Attribute, Op: Operator(check.Op), Value: check.Value})
+	}
+	replyItems := make(Items, 0, len(replies))
+	for _, reply := range replies {
+		replyItems = append(replyItems, Item{Attribute: reply.Attribute, Op: Operator(reply.Op), Value: reply.Value})
+	}
+	return checkItems, replyItems, nil
+}
+
+// apply matches the check items of owner against the request and, when they
+// match, merges its control and reply items into the result.
+func (result *Result) apply(request *radius.Packet, owner string, checks Items, replies Items) (bool, error) {
+	for _, item := range checks {
+		if !item.Op.IsComparison() && !item.Op.IsAssignment() {
+			return false, fmt.Errorf("%s: invalid operator %q for check item %s", owner, item.Op, item.Attribute)
+		}
+	}
+	for _, item := range replies {
+		if !item.Op.IsAssignment() {
+			return false, fmt.Errorf("%s: invalid operator %q for reply item %s", owner, item.Op, item.Attribute)
+		}
+		if strings.EqualFold(item.Attribute, AttributeFallThrough) {
+			continue
+		}
+		if _, err := dictionary.ParseValue(item.Attribute, item.Value); err != nil {
+			return false, fmt.Errorf("%s: reply item %s. %w", owner, item.Attribute, err)
+		}
+	}
+
+	for _, item := range checks {
+		if !item.Op.IsComparison() {
+			continue
+		}
+		ok, err := matchRequest(request, item)
+		if err != nil {
+			logger.Logger.Warn().Msgf("Check item %s %s %s of %s ignored. %s", item.Attribute, item.Op, item.Value, owner, err.Error())
+			return false, nil
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	for _, item := range checks {
+		if !item.Op.IsComparison() {
+			result.Control = result.Control.merge(item)
+		}
+	}
+	for _, item := range replies {
+		if !strings.EqualFold(item.Attribute, AttributeFallThrough) {
+			result.Reply = result.Reply.merge(item)
+		}
+	}
+	return true, nil
+}
+
+// ApplyReply adds the reply items to response with the semantics of their
+// operator, against the attributes the response already holds.
+func ApplyReply(response *radius.Packet, items Items) error {
+	for _, item := range items {
+		var err error
+		switch item.Op {
+		case OpAssign:
+			err = dictionary.Set(response, item.Attribute, item.Value)
+		case OpAdd:
+			err = dictionary.Add(response, item.Attribute, item.Value)
+		default:
+			if _, lookupErr := dictionary.Lookup(response, item.Attribute); errors.Is(lookupErr, radius.ErrNoAttribute) {
+				err = dictionary.Add(response, item.Attribute, item.Value)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("reply item %s. %w", item.Attribute, err)
+		}
+	}
+	return nil
+}
@@ -2,13 +2,15 @@ package radius
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
 	"net"
+	"radius-server/src/cache"
 	"radius-server/src/config"
-	"radius-server/src/database"
+	"radius-server/src/database/entities"
 	"radius-server/src/radius/handlers"
+	networkUtil "radius-server/src/utils/network"
+	"strconv"
 
 	"layeh.com/radius"
 )
@@ -20,46 +22,118 @@ func New() *RadiusServer {
 	return &RadiusServer{}
 }
 
+// listener is a single bound transport of a RADIUS service.
+type listener struct {
+	name    string
+	network string
+	address string
+	serve   func() error
+}
+
 func (rs *RadiusServer) Start() error {
 	log.Println("Starting RADIUS server...")
 	secretSource := &SecretSource{}
-	// Here you would add the actual RADIUS server initialization and start logic
-	errChan := make(chan error)
+	if err := handlers.InitEap(); err != nil {
+		return err
+	}
 
-	go func() {
-		accessSrv := radius.PacketServer{
-			Addr:         fmt.Sprintf(":%d", config.AppConfig.RadiusServer.AccessHandlerServerPort),
-			Handler:      radius.HandlerFunc(handlers.AccessHandler),
-			SecretSource: secretSource,
+	accessHandler := handlers.WithStatusServer(handlers.WithDuplicateDetection(handlers.WithMessageAuthenticator(radius.HandlerFunc(handlers.AccessHandler))), radius.CodeAccessAccept)
+	accountingHandler := handlers.WithStatusServer(handlers.WithDuplicateDetection(handlers.WithMessageAuthenticator(radius.HandlerFunc(handlers.AccountingHandler))), radius.CodeAccountingResponse)
+
+	listeners := []listener{}
+	listeners = append(listeners, packetListeners("Access", config.AppConfig.RadiusServer.AccessHandlerServerHosts, config.AppConfig.RadiusServer.AccessHandlerServerPort, accessHandler, secretSource)...)
+	listeners = append(listeners, packetListeners("Accounting", config.AppConfig.RadiusServer.AccountingHandlerServerHosts, config.AppConfig.RadiusServer.AccountingHandlerServerPort, accountingHandler, secretSource)...)
+	if config.AppConfig.RadiusServer.TcpEnabled {
+		listeners = append(listeners, tcpListeners("Access", config.AppConfig.RadiusServer.AccessHandlerServerHosts, config.AppConfig.RadiusServer.AccessHandlerServerPort, accessHandler, secretSource)...)
+		listeners = append(listeners, tcpListeners("Accounting", config.AppConfig.RadiusServer.AccountingHandlerServerHosts, config.AppConfig.RadiusServer.AccountingHandlerServerPort, accountingHandler, secretSource)...)
+	}
+	if config.AppConfig.RadiusServer.RadSec.Enabled {
+		radSecListeners, err := radSecListeners(config.AppConfig.RadiusServer.RadSec.ServerHosts, config.AppConfig.RadiusServer.RadSec.ServerPort, connHandler(accessHandler, accountingHandler))
+		if err != nil {
+			return err
 		}
-		log.Printf("Access server running on :%d", config.AppConfig.RadiusServer.AccessHandlerServerPort)
-		if err := accessSrv.ListenAndServe(); err != nil {
-			errChan <- err
+		listeners = append(listeners, radSecListeners...)
+	}
+	if config.AppConfig.RadiusServer.RadSec.DtlsEnabled {
+		dtlsListeners, err := dtlsListeners(config.AppConfig.RadiusServer.RadSec.DtlsServerHosts, config.AppConfig.RadiusServer.RadSec.DtlsServerPort, connHandler(accessHandler, accountingHandler))
+		if err != nil {
+			return err
 		}
-	}()
+		listeners = append(listeners, dtlsListeners...)
+	}
+
+	errChan := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l listener) {
+			log.Printf("%s server running on %s/%s", l.name, l.network, l.address)
+			if err := l.serve(); err != nil {
+				errChan <- fmt.Errorf("%s server on %s/%s: %w", l.name, l.network, l.address, err)
+			}
+		}(l)
+	}
 
 	err := <-errChan
 
 	return err
 }
 
+// packetListeners creates one UDP server per configured bind host. Literal
+// IPv4 and IPv6 addresses are bound with udp4/udp6 so both wildcards can
+// share a port, an empty host binds every address of both families.
+func packetListeners(name string, hosts []string, port int, handler radius.Handler, secretSource radius.SecretSource) []listener {
+	listeners := []listener{}
+	for _, host := range hosts {
+		server := &radius.PacketServer{
+			Addr:         net.JoinHostPort(host, strconv.Itoa(port)),
+			Network:      networkUtil.ListenNetwork("udp", host),
+			Handler:      handler,
+			SecretSource: secretSource,
+		}
+		listeners = append(listeners, listener{
+			name:    name,
+			network: server.Network,
+			address: server.Addr,
+			serve:   server.ListenAndServe,
+		})
+	}
+	return listeners
+}
+
 type SecretSource struct {
 }
 
 func (s *SecretSource) RADIUSSecret(ctx context.Context, addr net.Addr) ([]byte, error) {
-	udpAddr, ok := addr.(*net.UDPAddr)
-	if !ok {
-		return nil, fmt.Errorf("invalid addr type: %T", addr)
+	nas, err := s.nas(addr)
+	if err != nil {
+		return nil, err
 	}
 
-	ip := udpAddr.IP.String()
-	nas, err := database.GetNasByIp(ip)
+	return []byte(nas.Secret), nil
+}
+
+// authenticateConn binds a TCP connection to the NAS of its source address.
+func (s *SecretSource) authenticateConn(conn net.Conn) (*entities.RadiusNas, []byte, error) {
+	nas, err := s.nas(conn.RemoteAddr())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nas, []byte(nas.Secret), nil
+}
+
+func (s *SecretSource) nas(addr net.Addr) (*entities.RadiusNas, error) {
+	ip, err := networkUtil.AddrFromNetAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	nas, err := cache.GetNasByIp(ip.String())
 	if err != nil {
 		return nil, err
 	}
 	if nas == nil {
-		return nil, errors.New("NAS not found")
+		return nil, fmt.Errorf("NAS not found for %s", ip.String())
 	}
 
-	return []byte(nas.Secret), nil
+	return nas, nil
 }
@@ -0,0 +1,158 @@
+package radius
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"radius-server/src/cache"
+	"radius-server/src/config"
+	"radius-server/src/database/entities"
+	"radius-server/src/radius/revocation"
+	networkUtil "radius-server/src/utils/network"
+	timeUtil "radius-server/src/utils/time"
+
+	"layeh.com/radius"
+)
+
+// RadSec, RADIUS over TLS (RFC 6614) and DTLS (RFC 7360). Clients
+// authenticate with a certificate issued by RADSEC_CLIENT_CA_FILE and are
+// mapped to the NAS whose tls_identity matches one of the certificate
+// identities. Packets use the fixed "radsec" shared secret over TLS and
+// "radius/dtls" over DTLS (RFC 7360 section 2.1), the TLS session provides the
+// security.
+
+const (
+	radSecSecret           = "radsec"
+	radSecHandshakeTimeout = 10 * time.Second
+)
+
+// radSecListeners creates one TLS listener per configured bind host, serving
+// access and accounting requests on the same port.
+func radSecListeners(hosts []string, port int, handler radius.Handler) ([]listener, error) {
+	tlsConfig, err := radSecTlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	server := &connServer{
+		name:         "RadSec",
+		handler:      handler,
+		authenticate: authenticateRadSecConn,
+		idleTimeout:  timeUtil.DurationSeconds(config.AppConfig.RadiusServer.RadSec.IdleTimeoutSec),
+	}
+
+	listeners := []listener{}
+	for _, host := range hosts {
+		network := networkUtil.ListenNetwork("tcp", host)
+		address := net.JoinHostPort(host, strconv.Itoa(port))
+		listeners = append(listeners, listener{
+			name:    server.name,
+			network: network,
+			address: address,
+			serve: func() error {
+				l, err := net.Listen(network, address)
+				if err != nil {
+					return err
+				}
+				return server.Serve(tls.NewListener(l, tlsConfig))
+			},
+		})
+	}
+	return listeners, nil
+}
+
+func radSecTlsConfig() (*tls.Config, error) {
+	certificate, clientCas, err := loadRadSecCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates:     []tls.Certificate{certificate},
+		ClientAuth:       tls.RequireAndVerifyClientCert,
+		ClientCAs:        clientCas,
+		MinVersion:       tls.VersionTLS12,
+		VerifyConnection: revocation.VerifyConnection,
+	}, nil
+}
+
+// loadRadSecCredentials loads the server certificate and the CA pool client
+// certificates are verified against, shared by the TLS and DTLS listeners.
+func loadRadSecCredentials() (tls.Certificate, *x509.CertPool, error) {
+	radSecConfig := config.AppConfig.RadiusServer.RadSec
+	certificate, err := tls.LoadX509KeyPair(radSecConfig.CertFile, radSecConfig.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("load RadSec certificate: %w", err)
+	}
+	caPem, err := os.ReadFile(radSecConfig.ClientCaFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("load RadSec client CA: %w", err)
+	}
+	clientCas := x509.NewCertPool()
+	if !clientCas.AppendCertsFromPEM(caPem) {
+		return tls.Certificate{}, nil, fmt.Errorf("load RadSec client CA: no certificate found in %s", radSecConfig.ClientCaFile)
+	}
+	return certificate, clientCas, nil
+}
+
+// authenticateRadSecConn completes the handshake and maps the verified client
+// certificate to a NAS.
+func authenticateRadSecConn(conn net.Conn) (*entities.RadiusNas, []byte, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, nil, errors.New("not a TLS connection")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), radSecHandshakeTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, nil, fmt.Errorf("TLS handshake: %w", err)
+	}
+
+	peerCertificates := tlsConn.ConnectionState().PeerCertificates
+	if len(peerCertificates) == 0 {
+		return nil, nil, errors.New("no client certificate")
+	}
+	nas, err := radSecNas(certificateIdentities(peerCertificates[0]))
+	if err != nil {
+		return nil, nil, err
+	}
+	return nas, []byte(radSecSecret), nil
+}
+
+// radSecNas returns the NAS registered for one of the identities of a verified
+// client certificate.
+func radSecNas(identities []string) (*entities.RadiusNas, error) {
+	nas, err := cache.GetNasByTlsIdentity(identities...)
+	if err != nil {
+		return nil, err
+	}
+	if nas == nil {
+		return nil, fmt.Errorf("no NAS registered for certificate identities %v", identities)
+	}
+	return nas, nil
+}
+
+// certificateIdentities lists the names a NAS can be registered with, the
+// subject alternative names first and the subject common name last.
+func certificateIdentities(certificate *x509.Certificate) []string {
+	identities := []string{}
+	for _, uri := range certificate.URIs {
+		identities = append(identities, uri.String())
+	}
+	identities = append(identities, certificate.DNSNames...)
+	for _, ip := range certificate.IPAddresses {
+		identities = append(identities, ip.String())
+	}
+	if certificate.Subject.CommonName != "" {
+		identities = append(identities, certificate.Subject.CommonName)
+	}
+	return identities
+}
@@ -0,0 +1,121 @@
+package revocation
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/config"
+	timeUtil "radius-server/src/utils/time"
+)
+
+const (
+	// maxDownloadLength bounds the CRLs and OCSP responses read over HTTP
+	maxDownloadLength  = 32 << 20
+	crlDownloadTimeout = time.Minute
+)
+
+type crlStore struct {
+	mu sync.RWMutex
+	// lists holds the last CRL loaded from each source
+	lists map[string]*x509.RevocationList
+}
+
+var (
+	crls      = &crlStore{lists: map[string]*x509.RevocationList{}}
+	crlClient = &http.Client{Timeout: crlDownloadTimeout}
+)
+
+// load reads the CRL of a source, PEM or DER encoded, and replaces the one
+// previously loaded from it.
+func (s *crlStore) load(source string) error {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = download(crlClient, source)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return fmt.Errorf("load CRL %s: %w", source, err)
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	list, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return fmt.Errorf("parse CRL %s: %w", source, err)
+	}
+
+	s.mu.Lock()
+	s.lists[source] = list
+	s.mu.Unlock()
+	return nil
+}
+
+// status looks the certificate up in the CRLs signed by its issuer. CRLs
+// past their next update are ignored.
+func (s *crlStore) status(certificate *x509.Certificate, issuer *x509.Certificate) status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	result := statusUnknown
+	for _, list := range s.lists {
+		if !bytes.Equal(list.RawIssuer, certificate.RawIssuer) || list.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+		if !list.NextUpdate.IsZero() && now.After(list.NextUpdate) {
+			continue
+		}
+		for _, entry := range list.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+				return statusRevoked
+			}
+		}
+		result = statusGood
+	}
+	return result
+}
+
+func refreshCrlsPeriodically(ctx context.Context, sources []string) {
+	ticker := time.NewTicker(timeUtil.DurationSeconds(config.AppConfig.RadiusServer.Revocation.CrlRefreshIntervalSec))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, source := range sources {
+				if err := crls.load(source); err != nil {
+					logger.Logger.Warn().Msgf("Refresh CRL error, serving last loaded CRL. %s", err.Error())
+				}
+			}
+		}
+	}
+}
+
+func download(client *http.Client, url string) ([]byte, error) {
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	return readResponse(response)
+}
+
+func readResponse(response *http.Response) ([]byte, error) {
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", response.Status)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, maxDownloadLength))
+}
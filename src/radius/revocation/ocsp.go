@@ -0,0 +1,127 @@
+package revocation
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"radius-server/src/config"
+	timeUtil "radius-server/src/utils/time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSP answers by issuer and serial number. Errors are not cached, so an
+// unreachable responder is asked again on the next connection.
+
+const (
+	maxOcspCacheEntries = 10000
+	// ocspClockSkew tolerates responders whose clock is slightly ahead
+	ocspClockSkew = 5 * time.Minute
+)
+
+type ocspEntry struct {
+	status    status
+	expiresAt time.Time
+}
+
+type ocspCache struct {
+	mu      sync.Mutex
+	entries map[string]ocspEntry
+}
+
+var (
+	ocspAnswers = &ocspCache{entries: map[string]ocspEntry{}}
+	ocspClient  = &http.Client{}
+)
+
+func (c *ocspCache) get(key string) (status, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return statusUnknown, false
+	}
+	return entry.status, true
+}
+
+func (c *ocspCache) put(key string, entry ocspEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxOcspCacheEntries {
+		now := time.Now()
+		for key, cached := range c.entries {
+			if !now.Before(cached.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxOcspCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = entry
+}
+
+// ocspCertificateStatus asks the OCSP responder for the status of the
+// certificate, the configured responder or else the one of the certificate.
+func ocspCertificateStatus(certificate *x509.Certificate, issuer *x509.Certificate) (status, error) {
+	key := string(certificate.RawIssuer) + "/" + certificate.SerialNumber.String()
+	if cached, ok := ocspAnswers.get(key); ok {
+		return cached, nil
+	}
+
+	revocationConfig := config.AppConfig.RadiusServer.Revocation
+	responderUrl := revocationConfig.OcspResponderUrl
+	if responderUrl == "" {
+		if len(certificate.OCSPServer) == 0 {
+			return statusUnknown, errors.New("no OCSP responder for the certificate")
+		}
+		responderUrl = certificate.OCSPServer[0]
+	}
+
+	request, err := ocsp.CreateRequest(certificate, issuer, nil)
+	if err != nil {
+		return statusUnknown, fmt.Errorf("create OCSP request: %w", err)
+	}
+	httpResponse, err := ocspClient.Post(responderUrl, "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return statusUnknown, fmt.Errorf("OCSP request: %w", err)
+	}
+	body, err := readResponse(httpResponse)
+	if err != nil {
+		return statusUnknown, fmt.Errorf("OCSP request: %w", err)
+	}
+	// the signature must be the issuer's or of a responder it delegated to
+	response, err := ocsp.ParseResponseForCert(body, certificate, issuer)
+	if err != nil {
+		return statusUnknown, fmt.Errorf("parse OCSP response: %w", err)
+	}
+
+	now := time.Now()
+	if response.ThisUpdate.After(now.Add(ocspClockSkew)) || (!response.NextUpdate.IsZero() && now.After(response.NextUpdate)) {
+		return statusUnknown, errors.New("stale OCSP response")
+	}
+	result := statusUnknown
+	switch response.Status {
+	case ocsp.Good:
+		result = statusGood
+	case ocsp.Revoked:
+		result = statusRevoked
+	}
+
+	expiresAt := now.Add(timeUtil.DurationSeconds(revocationConfig.OcspCacheTtlSec))
+	if !response.NextUpdate.IsZero() && response.NextUpdate.Before(expiresAt) {
+		expiresAt = response.NextUpdate
+	}
+	ocspAnswers.put(key, ocspEntry{status: result, expiresAt: expiresAt})
+	if result == statusUnknown {
+		return result, errors.New("certificate unknown to the OCSP responder")
+	}
+	return result, nil
+}
@@ -0,0 +1,129 @@
+package revocation
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"radius-server/src/common/logger"
+	"radius-server/src/config"
+	timeUtil "radius-server/src/utils/time"
+)
+
+// Revocation checking of the client certificates of EAP-TLS and RadSec. CRLs
+// are loaded from files or HTTP URLs and refreshed periodically, OCSP
+// (RFC 6960) answers are cached until their next update. A certificate found
+// revoked by any source is rejected. When no source knows its status, the
+// soft-fail policy accepts it and the hard-fail policy rejects it. Only the
+// client certificate is checked, not the intermediate CAs of its chain.
+
+// ErrRevoked is returned for a revoked client certificate.
+var ErrRevoked = errors.New("certificate revoked")
+
+type status int
+
+const (
+	statusUnknown status = iota
+	statusGood
+	statusRevoked
+)
+
+// Start loads the configured CRLs and starts their periodic refresh, which
+// stops when ctx is cancelled.
+func Start(ctx context.Context) error {
+	revocationConfig := config.AppConfig.RadiusServer.Revocation
+	ocspClient.Timeout = timeUtil.DurationSeconds(revocationConfig.OcspTimeoutSec)
+
+	sources := crlSources()
+	if len(sources) == 0 {
+		return nil
+	}
+	for _, source := range sources {
+		if err := crls.load(source); err != nil {
+			return err
+		}
+	}
+	go refreshCrlsPeriodically(ctx, sources)
+	return nil
+}
+
+// VerifyConnection rejects a TLS connection whose client certificate is
+// revoked, for tls.Config.VerifyConnection. Connections without a verified
+// client certificate are left to the TLS configuration.
+func VerifyConnection(state tls.ConnectionState) error {
+	return verifyChains(state.VerifiedChains)
+}
+
+// VerifyPeerCertificate is VerifyConnection for the DTLS listeners, which
+// only expose the verified chains.
+func VerifyPeerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return verifyChains(verifiedChains)
+}
+
+func verifyChains(chains [][]*x509.Certificate) error {
+	revocationConfig := config.AppConfig.RadiusServer.Revocation
+	if len(crlSources()) == 0 && !revocationConfig.OcspEnabled {
+		return nil
+	}
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil
+	}
+	certificate := chains[0][0]
+	if len(chains[0]) < 2 {
+		// a trusted certificate without issuer in the chain
+		return unknownStatus(certificate, errors.New("no issuer in the verified chain"))
+	}
+	issuer := chains[0][1]
+
+	certificateStatus := crls.status(certificate, issuer)
+	if certificateStatus == statusRevoked {
+		return revoked(certificate, "CRL")
+	}
+	var ocspErr error
+	if revocationConfig.OcspEnabled {
+		var ocspStatus status
+		ocspStatus, ocspErr = ocspCertificateStatus(certificate, issuer)
+		switch ocspStatus {
+		case statusRevoked:
+			return revoked(certificate, "OCSP")
+		case statusGood:
+			certificateStatus = statusGood
+		}
+	}
+	if certificateStatus == statusUnknown {
+		if ocspErr == nil {
+			ocspErr = errors.New("no CRL of the issuer and no OCSP answer")
+		}
+		return unknownStatus(certificate, ocspErr)
+	}
+	return nil
+}
+
+func revoked(certificate *x509.Certificate, source string) error {
+	logger.Logger.Warn().Str("subject", certificate.Subject.String()).Msgf("Client certificate rejected. Revoked according to %s", source)
+	return fmt.Errorf("%w: serial %s of %s", ErrRevoked, certificate.SerialNumber.String(), certificate.Subject.String())
+}
+
+// unknownStatus applies the fail policy to a certificate whose status is
+// unknown.
+func unknownStatus(certificate *x509.Certificate, reason error) error {
+	if config.AppConfig.RadiusServer.Revocation.FailPolicy == "hard" {
+		logger.Logger.Warn().Str("subject", certificate.Subject.String()).Msgf("Client certificate rejected. Unknown revocation status, %s", reason.Error())
+		return fmt.Errorf("unknown revocation status of %s: %w", certificate.Subject.String(), reason)
+	}
+	logger.Logger.Warn().Str("subject", certificate.Subject.String()).Msgf("Client certificate accepted with unknown revocation status. %s", reason.Error())
+	return nil
+}
+
+// crlSources returns the configured CRL sources, without empty entries.
+func crlSources() []string {
+	sources := []string{}
+	for _, source := range config.AppConfig.RadiusServer.Revocation.CrlSources {
+		if source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
@@ -0,0 +1,45 @@
+package radius
+
+import (
+	"net"
+	"strconv"
+
+	"radius-server/src/config"
+	networkUtil "radius-server/src/utils/network"
+	timeUtil "radius-server/src/utils/time"
+
+	"layeh.com/radius"
+)
+
+// tcpListeners creates one RADIUS over TCP (RFC 6613) listener per configured
+// bind host, on the same port as the UDP service. Each connection is bound to
+// the NAS of its source address when it is accepted. NAS use Status-Server as
+// the connection watchdog, idle connections are closed after
+// TCP_IDLE_TIMEOUT_SEC.
+func tcpListeners(name string, hosts []string, port int, handler radius.Handler, secretSource *SecretSource) []listener {
+	server := &connServer{
+		name:         name + " TCP",
+		handler:      handler,
+		authenticate: secretSource.authenticateConn,
+		idleTimeout:  timeUtil.DurationSeconds(config.AppConfig.RadiusServer.TcpIdleTimeoutSec),
+	}
+
+	listeners := []listener{}
+	for _, host := range hosts {
+		network := networkUtil.ListenNetwork("tcp", host)
+		address := net.JoinHostPort(host, strconv.Itoa(port))
+		listeners = append(listeners, listener{
+			name:    server.name,
+			network: network,
+			address: address,
+			serve: func() error {
+				l, err := net.Listen(network, address)
+				if err != nil {
+					return err
+				}
+				return server.Serve(l)
+			},
+		})
+	}
+	return listeners
+}
@@ -2,9 +2,12 @@ package routes
 
 import (
 	"radius-server/src/common/logger"
+	"radius-server/src/common/security"
 	"radius-server/src/config"
 	apiModule "radius-server/src/modules/api"
 	metricsModule "radius-server/src/modules/metrics"
+	nasModule "radius-server/src/modules/nas"
+	sessionsModule "radius-server/src/modules/sessions"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -28,5 +31,16 @@ func New() (*fiber.App, string) {
 	apiMethods.Get("/healthcheck", apiModule.HealthCheck)
 	apiMethods.Get("/metrics", metricsModule.GetMetrics)
 
+	sessionMethods := app.Group("/sessions", security.ApiKeyMiddleware())
+	sessionMethods.Post("/:id/disconnect", sessionsModule.Disconnect)
+	sessionMethods.Post("/:id/coa", sessionsModule.ChangeOfAuthorization)
+
+	nasMethods := app.Group("/nas", security.ApiKeyMiddleware())
+	nasMethods.Get("/", nasModule.GetNasList)
+	nasMethods.Get("/:id", nasModule.GetNas)
+	nasMethods.Post("/", nasModule.CreateNas)
+	nasMethods.Put("/:id", nasModule.UpdateNas)
+	nasMethods.Delete("/:id", nasModule.DeleteNas)
+
 	return app, ":" + strconv.Itoa(config.AppConfig.ServerPort)
 }
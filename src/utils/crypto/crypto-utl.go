@@ -2,11 +2,13 @@ package cryptoUtil
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"strings"
+	"unicode/utf16"
 
 	"golang.org/x/crypto/bcrypt"
-
+	"golang.org/x/crypto/md4"
 )
 
 // HashPassword hashes a plain password using bcrypt.
@@ -20,6 +22,33 @@ func ComparePassword(hashedPassword, password string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
 }
 
+// HashNtPassword hashes a plain password into the hex encoded NT hash
+// (MD4 over UTF-16LE) used by MS-CHAP.
+func HashNtPassword(password string) string {
+	return hex.EncodeToString(NtPasswordHash(password))
+}
+
+// NtPasswordHash returns the raw NT hash of a plain password.
+func NtPasswordHash(password string) []byte {
+	encoded := utf16.Encode([]rune(password))
+	ucs2 := make([]byte, len(encoded)*2)
+	for i, v := range encoded {
+		binary.LittleEndian.PutUint16(ucs2[i*2:], v)
+	}
+	h := md4.New()
+	h.Write(ucs2)
+	return h.Sum(nil)
+}
+
+// DecodeNtPasswordHash decodes a hex encoded NT hash as produced by HashNtPassword.
+func DecodeNtPasswordHash(hashedPassword string) ([]byte, bool) {
+	hash, err := hex.DecodeString(hashedPassword)
+	if err != nil || len(hash) != md4.Size {
+		return nil, false
+	}
+	return hash, true
+}
+
 func HashString(args ...string) string {
 	h := sha256.Sum256([]byte(strings.Join(args, "")))
 	return hex.EncodeToString(h[:])
@@ -0,0 +1,81 @@
+package networkUtil
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// ParsePrefix parses a host address or a CIDR prefix. Host addresses are
+// returned as single address prefixes (/32 or /128) and host bits of a
+// prefix are cleared.
+func ParsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(prefix.Addr().Unmap(), prefixBits(prefix)).Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// FormatPrefix formats a prefix the way Postgres renders inet values: a
+// single address prefix is written without its mask.
+func FormatPrefix(prefix netip.Prefix) string {
+	if prefix.IsSingleIP() {
+		return prefix.Addr().String()
+	}
+	return prefix.String()
+}
+
+// prefixBits keeps the mask meaningful when an IPv4-mapped IPv6 prefix is
+// converted to IPv4.
+func prefixBits(prefix netip.Prefix) int {
+	if prefix.Addr().Is4In6() {
+		return max(prefix.Bits()-96, 0)
+	}
+	return prefix.Bits()
+}
+
+// AddrFromNetAddr extracts the IP of a UDP/TCP peer address without zone and
+// with IPv4-mapped IPv6 addresses converted to plain IPv4.
+func AddrFromNetAddr(addr net.Addr) (netip.Addr, error) {
+	var ip netip.Addr
+	switch v := addr.(type) {
+	case *net.UDPAddr:
+		ip = v.AddrPort().Addr()
+	case *net.TCPAddr:
+		ip = v.AddrPort().Addr()
+	default:
+		addrPort, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		ip = addrPort.Addr()
+	}
+	if !ip.IsValid() {
+		return netip.Addr{}, fmt.Errorf("invalid address %s", addr.String())
+	}
+	return ip.Unmap().WithZone(""), nil
+}
+
+// ListenNetwork returns the network to bind host with: udp4/udp6 (tcp4/tcp6)
+// for literal addresses, so an IPv4 and an IPv6 wildcard can be bound on the
+// same port, and the dual-stack network otherwise.
+func ListenNetwork(network string, host string) string {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return network
+	}
+	if addr.Unmap().Is4() {
+		return network + "4"
+	}
+	return network + "6"
+}
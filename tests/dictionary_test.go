@@ -0,0 +1,461 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"radius-server/src/radius/dictionary"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+)
+
+// Dictionary tests run against a dictionary of their own, loaded from memory,
+// so they do not depend on the embedded vendor files.
+
+const (
+	testAcmeVendorId = 99999
+	testWideVendorId = 88888
+	testBareVendorId = 77777
+	testTlvVendorId  = 66666
+	testLongExtended = 245
+	testDictSecret   = "test-dictionary-secret"
+)
+
+var testDictionaryFiles = fstest.MapFS{
+	"dictionary": {Data: []byte(`
+$INCLUDE dictionary.base
+$INCLUDE vendor/dictionary.acme
+$INCLUDE vendor/dictionary.blocks
+$INCLUDE- dictionary.missing
+`)},
+	"dictionary.base": {Data: []byte(`
+ATTRIBUTE	User-Name		1	string
+ATTRIBUTE	User-Password		2	string	encrypt=1
+ATTRIBUTE	Vendor-Specific		26	vsa
+ATTRIBUTE	Tunnel-Password		69	string	has_tag,encrypt=2
+ATTRIBUTE	EAP-Message		79	octets	concat
+ATTRIBUTE	Extended-Attribute-5	245	long-extended
+ATTRIBUTE	Test-Long-Value		245.1	octets
+ATTRIBUTE	Test-Long-Tlv		245.2	tlv
+ATTRIBUTE	Test-Long-Tlv-Id	245.2.1	integer
+ATTRIBUTE	Test-Long-Tlv-Label	245.2.2	string
+`)},
+	// includes are relative to the including file
+	"vendor/dictionary.acme": {Data: []byte(`
+VENDOR		Acme	99999
+BEGIN-VENDOR	Acme
+ATTRIBUTE	Acme-Name		1	string
+ATTRIBUTE	Acme-Secret		2	string	encrypt=2
+ATTRIBUTE	Acme-Tlv		3	tlv
+ATTRIBUTE	Acme-Tlv-Id		3.1	integer
+ATTRIBUTE	Acme-Tlv-Label		3.2	string
+END-VENDOR	Acme
+$INCLUDE dictionary.wide
+`)},
+	"vendor/dictionary.wide": {Data: []byte(`
+VENDOR		Wide	88888	format=2,2
+VENDOR		Bare	77777	format=4,0
+BEGIN-VENDOR	Wide
+ATTRIBUTE	Wide-Name		300	string
+END-VENDOR	Wide
+BEGIN-VENDOR	Bare
+ATTRIBUTE	Bare-Id			70000	integer
+END-VENDOR	Bare
+`)},
+	// FreeRADIUS TLV blocks, fixed length octets and FreeRADIUS 4 flags
+	"vendor/dictionary.blocks": {Data: []byte(`
+FLAGS		internal
+VENDOR		Block	66666
+BEGIN-VENDOR	Block
+ATTRIBUTE	Block-Tlv		1	tlv
+BEGIN-TLV	Block-Tlv
+ATTRIBUTE	Block-Tlv-Id		1	integer
+ATTRIBUTE	Block-Tlv-Inner		2	tlv
+BEGIN-TLV	Block-Tlv-Inner
+ATTRIBUTE	Block-Tlv-Inner-Key	1	octets[4]
+END-TLV		Block-Tlv-Inner
+END-TLV		Block-Tlv
+ATTRIBUTE	Block-Key		2	octets[16]
+END-VENDOR	Block
+`)},
+	"dictionary.unclosed-tlv": {Data: []byte(`
+ATTRIBUTE	Test-Tlv		250	tlv
+BEGIN-TLV	Test-Tlv
+ATTRIBUTE	Test-Tlv-Id		1	integer
+`)},
+	"dictionary.broken": {Data: []byte(`
+$INCLUDE dictionary.base
+ATTRIBUTE	Broken-Attribute	300	string
+`)},
+	"dictionary.include-missing": {Data: []byte(`
+$INCLUDE dictionary.missing
+`)},
+}
+
+func testDictionary(t *testing.T) {
+	t.Run("Include", testDictionaryInclude)
+	t.Run("VendorFormat", testDictionaryVendorFormat)
+	t.Run("UserPassword", testDictionaryUserPassword)
+	t.Run("TunnelPassword", testDictionaryTunnelPassword)
+	t.Run("Concat", testDictionaryConcat)
+	t.Run("LongExtended", testDictionaryLongExtended)
+	t.Run("TlvRemoval", testDictionaryTlvRemoval)
+	t.Run("TlvBlocks", testDictionaryTlvBlocks)
+	t.Run("FixedLength", testDictionaryFixedLength)
+}
+
+func newTestDictionary(t *testing.T) *dictionary.Dictionary {
+	t.Helper()
+	d := dictionary.New()
+	if err := d.Load(testDictionaryFiles, "dictionary"); err != nil {
+		t.Fatalf("load dictionary: %v", err)
+	}
+	return d
+}
+
+func testDictionaryInclude(t *testing.T) {
+	d := newTestDictionary(t)
+	for name, vendorId := range map[string]uint32{"User-Name": 0, "Acme-Name": testAcmeVendorId, "Wide-Name": testWideVendorId} {
+		attribute := d.Attribute(name)
+		if attribute == nil {
+			t.Fatalf("%s not loaded", name)
+		}
+		if attribute.Vendor == nil && vendorId != 0 || attribute.Vendor != nil && attribute.Vendor.Id != vendorId {
+			t.Fatalf("%s has vendor %v, want %d", name, attribute.Vendor, vendorId)
+		}
+	}
+
+	err := dictionary.New().Load(testDictionaryFiles, "dictionary.include-missing")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("missing $INCLUDE error %v, want fs.ErrNotExist", err)
+	}
+
+	err = dictionary.New().Load(testDictionaryFiles, "dictionary.broken")
+	var parseErr *dictionary.ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != "dictionary.broken" || parseErr.Line != 3 {
+		t.Fatalf("out of range attribute error %v, want a ParseError of dictionary.broken line 3", err)
+	}
+}
+
+// testDictionaryVendorFormat checks the type and length widths of vendor
+// attributes on the wire, format=1,1 by default.
+func testDictionaryVendorFormat(t *testing.T) {
+	d := newTestDictionary(t)
+	cases := []struct {
+		name     string
+		value    any
+		vendorId uint32
+		encoded  []byte
+	}{
+		{name: "Acme-Name", value: "abc", vendorId: testAcmeVendorId, encoded: []byte{1, 5, 'a', 'b', 'c'}},
+		{name: "Wide-Name", value: "abc", vendorId: testWideVendorId, encoded: []byte{0x01, 0x2C, 0, 7, 'a', 'b', 'c'}},
+		{name: "Bare-Id", value: uint32(5), vendorId: testBareVendorId, encoded: []byte{0, 1, 0x11, 0x70, 0, 0, 0, 5}},
+	}
+	for _, c := range cases {
+		p := radius.New(radius.CodeAccessRequest, []byte(testDictSecret))
+		if err := d.Add(p, c.name, c.value); err != nil {
+			t.Fatalf("add %s: %v", c.name, err)
+		}
+		if len(p.Attributes) != 1 || p.Attributes[0].Type != rfc2865.VendorSpecific_Type {
+			t.Fatalf("%s encoded as %v, want one Vendor-Specific attribute", c.name, p.Attributes)
+		}
+		vendorId, value, err := radius.VendorSpecific(p.Attributes[0].Attribute)
+		if err != nil || vendorId != c.vendorId || !bytes.Equal(value, c.encoded) {
+			t.Fatalf("%s encoded as vendor %d %x, want vendor %d %x", c.name, vendorId, value, c.vendorId, c.encoded)
+		}
+
+		decoded := decodeTestPacket(t, p)
+		got, err := d.Lookup(decoded, c.name)
+		if err != nil || got != c.value {
+			t.Fatalf("%s decoded as %v (%v), want %v", c.name, got, err, c.value)
+		}
+	}
+}
+
+// testDictionaryUserPassword checks that encrypt=1 values are hidden like
+// User-Password (RFC 2865 section 5.2).
+func testDictionaryUserPassword(t *testing.T) {
+	d := newTestDictionary(t)
+	for _, password := range []string{"short", "a password longer than sixteen bytes"} {
+		p := radius.New(radius.CodeAccessRequest, []byte(testDictSecret))
+		if err := d.Add(p, "User-Password", password); err != nil {
+			t.Fatalf("add User-Password: %v", err)
+		}
+		raw := p.Get(rfc2865.UserPassword_Type)
+		if len(raw)%16 != 0 || bytes.Contains(raw, []byte(password)) {
+			t.Fatalf("User-Password %x is not hidden", raw)
+		}
+
+		decoded := decodeTestPacket(t, p)
+		if got := rfc2865.UserPassword_GetString(decoded); got != password {
+			t.Fatalf("RFC 2865 decoding of User-Password %q, want %q", got, password)
+		}
+		got, err := d.Lookup(decoded, "User-Password")
+		if err != nil || got != password {
+			t.Fatalf("User-Password decoded as %v (%v), want %q", got, err, password)
+		}
+	}
+}
+
+// testDictionaryTunnelPassword checks that encrypt=2 values are hidden with
+// a salt like Tunnel-Password (RFC 2868 section 3.5), standard and vendor.
+func testDictionaryTunnelPassword(t *testing.T) {
+	d := newTestDictionary(t)
+	const password = "tunnel password"
+
+	p := radius.New(radius.CodeAccessAccept, []byte(testDictSecret))
+	if err := d.Add(p, "Tunnel-Password", password); err != nil {
+		t.Fatalf("add Tunnel-Password: %v", err)
+	}
+	if err := d.Add(p, "Acme-Secret", password); err != nil {
+		t.Fatalf("add Acme-Secret: %v", err)
+	}
+
+	raw, ok := p.Lookup(69)
+	if !ok || len(raw) < 3 {
+		t.Fatal("Tunnel-Password not added")
+	}
+	if raw[0] != 0 || raw[1]&0x80 == 0 {
+		t.Fatalf("Tunnel-Password %x, want tag 0 and a salt with its high bit set", raw)
+	}
+	plain, _, err := radius.TunnelPassword(raw[1:], p.Secret, p.Authenticator[:])
+	if err != nil || string(plain) != password {
+		t.Fatalf("RFC 2868 decoding of Tunnel-Password %q (%v), want %q", plain, err, password)
+	}
+
+	decoded := decodeTestPacket(t, p)
+	for _, name := range []string{"Tunnel-Password", "Acme-Secret"} {
+		got, err := d.Lookup(decoded, name)
+		if err != nil || got != password {
+			t.Fatalf("%s decoded as %v (%v), want %q", name, got, err, password)
+		}
+	}
+
+	first, _ := p.Lookup(69)
+	second := radius.New(radius.CodeAccessAccept, []byte(testDictSecret))
+	second.Authenticator = p.Authenticator
+	if err := d.Add(second, "Tunnel-Password", password); err != nil {
+		t.Fatalf("add Tunnel-Password: %v", err)
+	}
+	if again, _ := second.Lookup(69); bytes.Equal(first, again) {
+		t.Fatal("Tunnel-Password encoded twice with the same salt")
+	}
+}
+
+// testDictionaryConcat checks that concat values are split over attributes
+// of 253 bytes and joined when read.
+func testDictionaryConcat(t *testing.T) {
+	d := newTestDictionary(t)
+	message := bytes.Repeat([]byte{0xAB}, 600)
+
+	p := radius.New(radius.CodeAccessRequest, []byte(testDictSecret))
+	if err := d.Add(p, "EAP-Message", message); err != nil {
+		t.Fatalf("add EAP-Message: %v", err)
+	}
+	lengths := []int{}
+	for _, avp := range p.Attributes {
+		lengths = append(lengths, len(avp.Attribute))
+	}
+	if len(lengths) != 3 || lengths[0] != 253 || lengths[1] != 253 || lengths[2] != 94 {
+		t.Fatalf("EAP-Message split into %v bytes, want [253 253 94]", lengths)
+	}
+
+	values, err := d.LookupAll(decodeTestPacket(t, p), "EAP-Message")
+	if err != nil || len(values) != 1 || !bytes.Equal(values[0].([]byte), message) {
+		t.Fatalf("EAP-Message joined into %d values (%v), want the message", len(values), err)
+	}
+
+	// a NAS may split the message at other boundaries
+	received := radius.New(radius.CodeAccessRequest, []byte(testDictSecret))
+	received.Add(79, message[:10])
+	received.Add(rfc2865.UserName_Type, radius.Attribute("user"))
+	received.Add(79, message[10:])
+	got, err := d.Lookup(received, "EAP-Message")
+	if err != nil || !bytes.Equal(got.([]byte), message) {
+		t.Fatalf("EAP-Message split at 10 bytes not joined (%v)", err)
+	}
+}
+
+// testDictionaryLongExtended checks the fragmentation of long extended
+// attributes (RFC 6929 section 2.2): fragments carry 251 bytes after the
+// Extended-Type and flags, every fragment but the last has the More flag.
+func testDictionaryLongExtended(t *testing.T) {
+	d := newTestDictionary(t)
+	cases := []struct {
+		length    int
+		fragments []int
+	}{
+		{length: 1, fragments: []int{1}},
+		{length: 251, fragments: []int{251}},
+		{length: 252, fragments: []int{251, 1}},
+		{length: 502, fragments: []int{251, 251}},
+		{length: 503, fragments: []int{251, 251, 1}},
+	}
+	for _, c := range cases {
+		value := make([]byte, c.length)
+		for i := range value {
+			value[i] = byte(i)
+		}
+		p := radius.New(radius.CodeAccessRequest, []byte(testDictSecret))
+		if err := d.Add(p, "Test-Long-Value", value); err != nil {
+			t.Fatalf("add %d bytes: %v", c.length, err)
+		}
+		if len(p.Attributes) != len(c.fragments) {
+			t.Fatalf("%d bytes split into %d fragments, want %d", c.length, len(p.Attributes), len(c.fragments))
+		}
+		for i, avp := range p.Attributes {
+			more := i < len(c.fragments)-1
+			data := avp.Attribute
+			if avp.Type != testLongExtended || data[0] != 1 || (data[1]&0x80 != 0) != more || len(data)-2 != c.fragments[i] {
+				t.Fatalf("%d bytes: fragment %d is type %d %x, want %d bytes with More=%t", c.length, i, avp.Type, data[:2], c.fragments[i], more)
+			}
+		}
+
+		decoded := decodeTestPacket(t, p)
+		got, err := d.Lookup(decoded, "Test-Long-Value")
+		if err != nil || !bytes.Equal(got.([]byte), value) {
+			t.Fatalf("%d bytes not reassembled (%v)", c.length, err)
+		}
+		if err := d.Del(decoded, "Test-Long-Value"); err != nil {
+			t.Fatalf("delete %d bytes: %v", c.length, err)
+		}
+		if len(decoded.Attributes) != 0 {
+			t.Fatalf("%d bytes: %d fragments left after delete", c.length, len(decoded.Attributes))
+		}
+	}
+
+	// fragments of the same attribute are reassembled, a new attribute
+	// starts after a fragment without the More flag
+	received := radius.New(radius.CodeAccessRequest, []byte(testDictSecret))
+	received.Add(testLongExtended, radius.Attribute{1, 0x80, 'a', 'b'})
+	received.Add(testLongExtended, radius.Attribute{1, 0x00, 'c'})
+	received.Add(testLongExtended, radius.Attribute{1, 0x00, 'd'})
+	values, err := d.LookupAll(received, "Test-Long-Value")
+	if err != nil || len(values) != 2 || string(values[0].([]byte)) != "abc" || string(values[1].([]byte)) != "d" {
+		t.Fatalf("received fragments decoded as %q (%v), want [abc d]", values, err)
+	}
+}
+
+// testDictionaryTlvRemoval checks that deleting a TLV member keeps its
+// siblings, and that containers left empty are removed.
+func testDictionaryTlvRemoval(t *testing.T) {
+	d := newTestDictionary(t)
+
+	vendorValue := []byte{1, 6, 'n', 'a', 'm', 'e'}                            // Acme-Name
+	vendorValue = append(vendorValue, 3, 12, 1, 6, 0, 0, 0, 7, 2, 4, 'x', 'y') // Acme-Tlv
+	vsa, err := radius.NewVendorSpecific(testAcmeVendorId, vendorValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := radius.New(radius.CodeAccessRequest, []byte(testDictSecret))
+	p.Add(rfc2865.VendorSpecific_Type, vsa)
+
+	if got, err := d.Lookup(p, "Acme-Tlv-Id"); err != nil || got != uint32(7) {
+		t.Fatalf("Acme-Tlv-Id decoded as %v (%v), want 7", got, err)
+	}
+	if err := d.Del(p, "Acme-Tlv-Id"); err != nil {
+		t.Fatalf("delete Acme-Tlv-Id: %v", err)
+	}
+	if _, err := d.Lookup(p, "Acme-Tlv-Id"); !errors.Is(err, radius.ErrNoAttribute) {
+		t.Fatalf("Acme-Tlv-Id left after delete (%v)", err)
+	}
+	if got, err := d.Lookup(p, "Acme-Tlv-Label"); err != nil || got != "xy" {
+		t.Fatalf("Acme-Tlv-Label decoded as %v (%v) after deleting its sibling, want xy", got, err)
+	}
+
+	if err := d.Del(p, "Acme-Tlv-Label"); err != nil {
+		t.Fatalf("delete Acme-Tlv-Label: %v", err)
+	}
+	_, value, err := radius.VendorSpecific(p.Get(rfc2865.VendorSpecific_Type))
+	if err != nil || !bytes.Equal(value, []byte{1, 6, 'n', 'a', 'm', 'e'}) {
+		t.Fatalf("Vendor-Specific %x (%v) after emptying Acme-Tlv, want Acme-Name only", value, err)
+	}
+	if err := d.Del(p, "Acme-Name"); err != nil {
+		t.Fatalf("delete Acme-Name: %v", err)
+	}
+	if len(p.Attributes) != 0 {
+		t.Fatalf("%d attributes left, want the empty Vendor-Specific removed", len(p.Attributes))
+	}
+
+	// TLVs of a long extended attribute
+	long := radius.New(radius.CodeAccessRequest, []byte(testDictSecret))
+	tlvs := binary.BigEndian.AppendUint32([]byte{1, 6}, 9)
+	tlvs = append(tlvs, 2, 5, 'a', 'b', 'c')
+	long.Add(testLongExtended, append(radius.Attribute{2, 0}, tlvs...))
+	if err := d.Del(long, "Test-Long-Tlv-Label"); err != nil {
+		t.Fatalf("delete Test-Long-Tlv-Label: %v", err)
+	}
+	if got, err := d.Lookup(long, "Test-Long-Tlv-Id"); err != nil || got != uint32(9) {
+		t.Fatalf("Test-Long-Tlv-Id decoded as %v (%v) after deleting its sibling, want 9", got, err)
+	}
+	if _, err := d.Lookup(long, "Test-Long-Tlv-Label"); !errors.Is(err, radius.ErrNoAttribute) {
+		t.Fatalf("Test-Long-Tlv-Label left after delete (%v)", err)
+	}
+}
+
+// testDictionaryTlvBlocks checks that attributes of a BEGIN-TLV block are
+// numbered below its tlv attribute.
+func testDictionaryTlvBlocks(t *testing.T) {
+	d := newTestDictionary(t)
+	for name, oid := range map[string]string{"Block-Tlv-Id": "1.1", "Block-Tlv-Inner-Key": "1.2.1", "Block-Key": "2"} {
+		attribute := d.Attribute(name)
+		if attribute == nil || attribute.Vendor == nil || attribute.Vendor.Id != testTlvVendorId || attribute.Oid() != oid {
+			t.Fatalf("%s loaded as %v, want Block %s", name, attribute, oid)
+		}
+	}
+
+	p := radius.New(radius.CodeAccessRequest, []byte(testDictSecret))
+	if err := d.Add(p, "Block-Tlv-Inner-Key", []byte("abcd")); err != nil {
+		t.Fatalf("add Block-Tlv-Inner-Key: %v", err)
+	}
+	_, value, err := radius.VendorSpecific(p.Get(rfc2865.VendorSpecific_Type))
+	if want := []byte{1, 10, 2, 8, 1, 6, 'a', 'b', 'c', 'd'}; err != nil || !bytes.Equal(value, want) {
+		t.Fatalf("Block-Tlv-Inner-Key encoded as %x (%v), want %x", value, err, want)
+	}
+
+	err = dictionary.New().Load(testDictionaryFiles, "dictionary.unclosed-tlv")
+	var parseErr *dictionary.ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != "dictionary.unclosed-tlv" {
+		t.Fatalf("unclosed BEGIN-TLV error %v, want a ParseError of dictionary.unclosed-tlv", err)
+	}
+}
+
+// testDictionaryFixedLength checks that octets[N] values are exactly N bytes.
+func testDictionaryFixedLength(t *testing.T) {
+	d := newTestDictionary(t)
+	if attribute := d.Attribute("Block-Key"); attribute.Type != dictionary.TypeOctets || attribute.Length != 16 {
+		t.Fatalf("Block-Key loaded as %s of length %d, want octets[16]", attribute.Type, attribute.Length)
+	}
+	for _, length := range []int{15, 16, 17} {
+		p := radius.New(radius.CodeAccessRequest, []byte(testDictSecret))
+		err := d.Add(p, "Block-Key", make([]byte, length))
+		if length == 16 && err != nil {
+			t.Fatalf("add 16 bytes: %v", err)
+		}
+		if length != 16 && err == nil {
+			t.Fatalf("%d bytes added to Block-Key", length)
+		}
+	}
+}
+
+// decodeTestPacket encodes p and parses it back, as the peer receives it.
+// The peer of a response reveals hidden values with the authenticator of its
+// request.
+func decodeTestPacket(t *testing.T, p *radius.Packet) *radius.Packet {
+	t.Helper()
+	raw, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("encode packet: %v", err)
+	}
+	decoded, err := radius.Parse(raw, p.Secret)
+	if err != nil {
+		t.Fatalf("parse packet: %v", err)
+	}
+	decoded.Authenticator = p.Authenticator
+	return decoded
+}
@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"radius-server/src/radius/handlers"
+
+	"github.com/pion/dtls/v3"
+	"layeh.com/radius"
+)
+
+// testDtls authenticates a PAP user over RADIUS/DTLS as the NAS fixture,
+// identified by its client certificate. Packets are signed with the
+// radius/dtls secret (RFC 7360 section 2.1), not the secret of the NAS.
+func testDtls(t *testing.T) {
+	t.Run("Accept", testDtlsAccept)
+	t.Run("Resumption", testDtlsResumption)
+}
+
+func testDtlsAccept(t *testing.T) {
+	conn := dialDtls(t)
+	defer conn.Close()
+
+	state, ok := conn.ConnectionState()
+	if !ok || len(state.PeerCertificates) == 0 {
+		t.Fatal("DTLS handshake completed without a server certificate")
+	}
+	certificate, err := x509.ParseCertificate(state.PeerCertificates[0])
+	if err != nil {
+		t.Fatalf("parse server certificate: %v", err)
+	}
+	if certificate.Subject.CommonName != testServerName {
+		t.Fatalf("server certificate %q, want %q", certificate.Subject.CommonName, testServerName)
+	}
+
+	response, err := dtlsExchange(conn, testPapUser, testPapPassword)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if response.Code != radius.CodeAccessAccept {
+		t.Fatalf("response %v, want Access-Accept", response.Code)
+	}
+
+	response, err = dtlsExchange(conn, testPapUser, "wrong-password")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if response.Code != radius.CodeAccessReject {
+		t.Fatalf("response %v, want Access-Reject", response.Code)
+	}
+}
+
+// testDtlsResumption resumes the session of a first association, the
+// resumed association is still mapped to the NAS fixture.
+func testDtlsResumption(t *testing.T) {
+	sessions := &dtlsClientSessions{sessions: map[string]dtls.Session{}}
+	first := dialDtls(t, dtls.WithSessionStore(sessions))
+	firstState, _ := first.ConnectionState()
+	first.Close()
+	if len(firstState.SessionID) == 0 {
+		t.Fatal("no session ID in the full handshake")
+	}
+
+	conn := dialDtls(t, dtls.WithSessionStore(sessions))
+	defer conn.Close()
+	state, _ := conn.ConnectionState()
+	if !bytes.Equal(state.SessionID, firstState.SessionID) {
+		t.Fatalf("session ID %x, want the resumed session %x", state.SessionID, firstState.SessionID)
+	}
+	if len(state.PeerCertificates) != 0 {
+		t.Fatal("server certificate sent, want an abbreviated handshake")
+	}
+	response, err := dtlsExchange(conn, testPapUser, testPapPassword)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if response.Code != radius.CodeAccessAccept {
+		t.Fatalf("response %v, want Access-Accept", response.Code)
+	}
+}
+
+// dialDtls completes a DTLS handshake with the certificate of the NAS
+// fixture, negotiating a connection ID like a NAS behind NAT.
+func dialDtls(t *testing.T, options ...dtls.ClientOption) *dtls.Conn {
+	t.Helper()
+	udpAddr, err := net.ResolveUDPAddr("udp", dtlsAddress)
+	if err != nil {
+		t.Fatalf("resolve %s: %v", dtlsAddress, err)
+	}
+	conn, err := dtls.DialWithOptions("udp", udpAddr, append([]dtls.ClientOption{
+		dtls.WithCertificates(pki.nas),
+		dtls.WithRootCAs(pki.ca.pool()),
+		dtls.WithServerName(testServerName),
+		dtls.WithExtendedMasterSecret(dtls.RequireExtendedMasterSecret),
+		dtls.WithConnectionIDGenerator(dtls.OnlySendCIDGenerator()),
+	}, options...)...)
+	if err != nil {
+		t.Fatalf("dial %s: %v", dtlsAddress, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exchangeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		t.Fatalf("DTLS handshake: %v", err)
+	}
+	return conn
+}
+
+// dtlsExchange sends a PAP Access-Request as one DTLS record and reads the
+// response record.
+func dtlsExchange(conn *dtls.Conn, username string, password string) (*radius.Packet, error) {
+	request, err := newAccessRequest("radius/dtls", username, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := handlers.SignMessageAuthenticator(request); err != nil {
+		return nil, err
+	}
+	raw, err := request.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(exchangeTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(raw); err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, radius.MaxPacketLength)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+	if !radius.IsAuthenticResponse(buffer[:n], raw, request.Secret) {
+		return nil, errNotAuthentic
+	}
+	return radius.Parse(buffer[:n], request.Secret)
+}
+
+// dtlsClientSessions is the session store of the NAS side.
+type dtlsClientSessions struct {
+	mu       sync.Mutex
+	sessions map[string]dtls.Session
+}
+
+func (s *dtlsClientSessions) Set(key []byte, session dtls.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[string(key)] = session
+	return nil
+}
+
+func (s *dtlsClientSessions) Get(key []byte) (dtls.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[string(key)], nil
+}
+
+func (s *dtlsClientSessions) Del(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, string(key))
+	return nil
+}
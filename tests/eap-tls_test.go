@@ -0,0 +1,394 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"radius-server/src/radius/eap"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/vendors/microsoft"
+)
+
+// EAP-TLS through the UDP access listener, with a supplicant running
+// crypto/tls over the EAP-TLS framing (RFC 5216 section 3). The server sends
+// fragments of EAP_TLS_FRAGMENT_SIZE bytes, the supplicant fragments of
+// eapTlsClientFragmentSize bytes split over several EAP-Message attributes.
+// The same supplicant runs PEAP and EAP-TTLS, with the inner conversation
+// of the method after the handshake.
+
+const (
+	testTlsUser1             = "test-tls-user-1"
+	testTlsUser2             = "test-tls-user-2"
+	eapTlsServerFragmentSize = 200
+	eapTlsClientFragmentSize = 400
+)
+
+const (
+	eapTlsFlagLength = 0x80
+	eapTlsFlagMore   = 0x40
+	eapTlsFlagStart  = 0x20
+)
+
+func testEapTls(t *testing.T) {
+	t.Run("Tls12", func(t *testing.T) { testEapTlsAccept(t, tls.VersionTLS12) })
+	t.Run("Tls13", func(t *testing.T) { testEapTlsAccept(t, tls.VersionTLS13) })
+	t.Run("IdentityMismatch", testEapTlsIdentityMismatch)
+}
+
+func testEapTlsAccept(t *testing.T, version uint16) {
+	certificate, err := pki.ca.issue(testTlsUser1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	supplicant := newEapTlsSupplicant(certificate, version)
+	request, response := eapTlsAuthenticate(t, testTlsUser1, supplicant)
+	if response.Code != radius.CodeAccessAccept {
+		t.Fatalf("response %s, want %s (%s)", response.Code, radius.CodeAccessAccept, rfc2865.ReplyMessage_GetString(response))
+	}
+	if supplicant.err != nil {
+		t.Fatalf("supplicant: %v", supplicant.err)
+	}
+	if supplicant.state.Version != version {
+		t.Fatalf("tls version %x, want %x", supplicant.state.Version, version)
+	}
+	if supplicant.fragmentsSent < 2 || supplicant.fragmentsReceived < 2 {
+		t.Errorf("%d fragments sent and %d received, want a fragmented handshake", supplicant.fragmentsSent, supplicant.fragmentsReceived)
+	}
+	success, err := eap.Parse(responseEapMessage(t, response))
+	if err != nil {
+		t.Fatalf("parse eap packet: %v", err)
+	}
+	if success.Code != eap.CodeSuccess {
+		t.Errorf("eap code %d, want %d", success.Code, eap.CodeSuccess)
+	}
+
+	checkMppeKeys(t, request, response, supplicant.msk(t))
+}
+
+// checkMppeKeys checks that the MS-MPPE keys of an Access-Accept are the
+// halves of the MSK.
+func checkMppeKeys(t *testing.T, request *radius.Packet, response *radius.Packet, msk []byte) {
+	t.Helper()
+	recvKey, err := microsoft.MSMPPERecvKey_Lookup(response, request)
+	if err != nil {
+		t.Fatalf("MS-MPPE-Recv-Key: %v", err)
+	}
+	sendKey, err := microsoft.MSMPPESendKey_Lookup(response, request)
+	if err != nil {
+		t.Fatalf("MS-MPPE-Send-Key: %v", err)
+	}
+	if !bytes.Equal(recvKey, msk[:32]) {
+		t.Errorf("MS-MPPE-Recv-Key %x, want the first half of the MSK %x", recvKey, msk[:32])
+	}
+	if !bytes.Equal(sendKey, msk[32:]) {
+		t.Errorf("MS-MPPE-Send-Key %x, want the second half of the MSK %x", sendKey, msk[32:])
+	}
+}
+
+func testEapTlsIdentityMismatch(t *testing.T) {
+	certificate, err := pki.ca.issue(testTlsUser1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	supplicant := newEapTlsSupplicant(certificate, tls.VersionTLS13)
+	_, response := eapTlsAuthenticate(t, testTlsUser2, supplicant)
+	if response.Code != radius.CodeAccessReject {
+		t.Fatalf("response %s, want %s", response.Code, radius.CodeAccessReject)
+	}
+	if len(microsoft.MSMPPERecvKey_Get(response, response)) > 0 {
+		t.Error("MS-MPPE-Recv-Key in an Access-Reject")
+	}
+}
+
+// eapTlsAuthenticate runs the conversation of identity until the server
+// accepts or rejects it, it returns the last request and its response. A
+// method other than the one of the supplicant is refused with a Nak.
+func eapTlsAuthenticate(t *testing.T, identity string, supplicant *eapTlsSupplicant) (*radius.Packet, *radius.Packet) {
+	t.Helper()
+	defer supplicant.close()
+
+	request := newEapRequest(t, identity, nil, eapIdentity(1, identity), 253)
+	response, err := exchange(request)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	started := false
+	for response.Code == radius.CodeAccessChallenge {
+		eapRequest, err := eap.Parse(responseEapMessage(t, response))
+		if err != nil {
+			t.Fatalf("parse eap request: %v", err)
+		}
+		if eapRequest.Code != eap.CodeRequest {
+			t.Fatalf("eap code %d, want a request", eapRequest.Code)
+		}
+		reply := &eap.Packet{Code: eap.CodeResponse, Identifier: eapRequest.Identifier, Type: supplicant.eapType}
+		switch {
+		case eapRequest.Type == supplicant.eapType:
+			started = true
+			reply.Data = supplicant.respond(t, eapRequest.Data)
+		case !started:
+			reply.Type, reply.Data = eap.TypeNak, []byte{byte(supplicant.eapType)}
+		default:
+			t.Fatalf("eap %s request, want %s", eapRequest.Type, supplicant.eapType)
+		}
+		message := reply.Encode()
+		request = newEapRequest(t, identity, rfc2865.State_Get(response), message, 253)
+		if response, err = exchange(request); err != nil {
+			t.Fatalf("exchange: %v", err)
+		}
+	}
+	return request, response
+}
+
+// eapTlsSupplicant is the peer side of the TLS based methods. The TLS
+// client runs in its own goroutine over an eapTlsPipe, each server flight is
+// written to the pipe and the client output is collected until it waits for
+// the next one. After the handshake the client runs inner, the tunneled
+// phase of the method.
+type eapTlsSupplicant struct {
+	eapType eap.Type
+	config  *tls.Config
+	inner   func(conn *tls.Conn) error
+	pipe    *eapTlsPipe
+	done    chan struct{}
+	err     error
+	state   tls.ConnectionState
+	// in is the server flight being reassembled, out the client flight
+	// being fragmented
+	in                []byte
+	out               []byte
+	outLength         int
+	fragmentsSent     int
+	fragmentsReceived int
+	// emptyResponses counts the complete server flights answered without
+	// data
+	emptyResponses int
+}
+
+func newEapTlsSupplicant(certificate tls.Certificate, version uint16) *eapTlsSupplicant {
+	s := newTunnelSupplicant(eap.TypeTls, version, nil)
+	s.config.Certificates = []tls.Certificate{certificate}
+	s.inner = readTlsCommitment
+	return s
+}
+
+// newTunnelSupplicant returns a supplicant of method eapType without client
+// certificate, running inner after the handshake.
+func newTunnelSupplicant(eapType eap.Type, version uint16, inner func(conn *tls.Conn) error) *eapTlsSupplicant {
+	return &eapTlsSupplicant{
+		eapType: eapType,
+		config: &tls.Config{
+			RootCAs:    pki.ca.pool(),
+			ServerName: testServerName,
+			MinVersion: version,
+			MaxVersion: version,
+		},
+		inner: inner,
+		pipe:  newEapTlsPipe(),
+		done:  make(chan struct{}),
+	}
+}
+
+// respond returns the type data answering the type data of an EAP-TLS
+// request.
+func (s *eapTlsSupplicant) respond(t *testing.T, data []byte) []byte {
+	t.Helper()
+	if len(data) == 0 {
+		t.Fatal("empty EAP-TLS request")
+	}
+	flags, payload := data[0], data[1:]
+	if flags&eapTlsFlagLength != 0 {
+		if len(payload) < 4 {
+			t.Fatal("EAP-TLS request too short for its length")
+		}
+		payload = payload[4:]
+	}
+
+	switch {
+	case flags&eapTlsFlagStart != 0:
+		go s.run()
+		s.setOutput(s.flight(nil))
+		return s.fragment()
+	case len(s.out) > 0:
+		// the server acknowledged a fragment
+		if len(payload) != 0 {
+			t.Fatal("server data before the client flight was sent")
+		}
+		return s.fragment()
+	}
+	s.fragmentsReceived++
+	s.in = append(s.in, payload...)
+	if flags&eapTlsFlagMore != 0 {
+		return []byte{0}
+	}
+	input := s.in
+	s.in = nil
+	s.setOutput(s.flight(input))
+	if len(s.out) == 0 {
+		s.emptyResponses++
+		return []byte{0}
+	}
+	return s.fragment()
+}
+
+// run performs the handshake and the tunneled phase.
+func (s *eapTlsSupplicant) run() {
+	defer close(s.done)
+	conn := tls.Client(s.pipe, s.config)
+	if s.err = conn.Handshake(); s.err != nil {
+		return
+	}
+	s.state = conn.ConnectionState()
+	if s.inner != nil {
+		s.err = s.inner(conn)
+	}
+}
+
+// readTlsCommitment reads, on TLS 1.3, the commitment message ending the
+// EAP-TLS handshake (RFC 9190 section 2.5).
+func readTlsCommitment(conn *tls.Conn) error {
+	if conn.ConnectionState().Version != tls.VersionTLS13 {
+		return nil
+	}
+	commitment := make([]byte, 1)
+	if _, err := io.ReadFull(conn, commitment); err != nil {
+		return err
+	}
+	if commitment[0] != 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// flight hands a server flight to the client and returns what it wrote in
+// reply, once it waits for more input or is done.
+func (s *eapTlsSupplicant) flight(input []byte) []byte {
+	if input != nil {
+		select {
+		case s.pipe.in <- input:
+		case <-s.done:
+			return nil
+		}
+	}
+	select {
+	case <-s.pipe.idle:
+	case <-s.done:
+	}
+	return s.pipe.takeOutput()
+}
+
+func (s *eapTlsSupplicant) setOutput(out []byte) {
+	s.out = out
+	s.outLength = len(out)
+}
+
+// fragment returns the next fragment of the client flight, the first one
+// with its total length.
+func (s *eapTlsSupplicant) fragment() []byte {
+	s.fragmentsSent++
+	data := []byte{0}
+	if len(s.out) == s.outLength {
+		data[0] |= eapTlsFlagLength
+		data = binary.BigEndian.AppendUint32(data, uint32(s.outLength))
+	}
+	size := min(len(s.out), eapTlsClientFragmentSize)
+	if size < len(s.out) {
+		data[0] |= eapTlsFlagMore
+	}
+	data = append(data, s.out[:size]...)
+	s.out = s.out[size:]
+	return data
+}
+
+// msk derives the Master Session Key of the conversation as the server does.
+func (s *eapTlsSupplicant) msk(t *testing.T) []byte {
+	t.Helper()
+	label, context := "client EAP encryption", []byte(nil)
+	switch {
+	case s.state.Version == tls.VersionTLS13:
+		label, context = "EXPORTER_EAP_TLS_Key_Material", []byte{byte(s.eapType)}
+	case s.eapType == eap.TypeTtls:
+		label = "ttls keying material"
+	}
+	keyMaterial, err := s.state.ExportKeyingMaterial(label, context, 128)
+	if err != nil {
+		t.Fatalf("export tls key material: %v", err)
+	}
+	return keyMaterial[:64]
+}
+
+func (s *eapTlsSupplicant) close() {
+	s.pipe.Close()
+	select {
+	case <-s.done:
+	case <-time.After(exchangeTimeout):
+	}
+}
+
+// eapTlsPipe is the transport of the supplicant TLS client. Reads are fed
+// by the server flights and signal idle when the client waits for one.
+type eapTlsPipe struct {
+	in        chan []byte
+	idle      chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	pending   []byte
+	mu        sync.Mutex
+	out       []byte
+}
+
+func newEapTlsPipe() *eapTlsPipe {
+	return &eapTlsPipe{in: make(chan []byte), idle: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (p *eapTlsPipe) Read(b []byte) (int, error) {
+	if len(p.pending) == 0 {
+		select {
+		case p.idle <- struct{}{}:
+		case <-p.closed:
+			return 0, io.EOF
+		}
+		select {
+		case p.pending = <-p.in:
+		case <-p.closed:
+			return 0, io.EOF
+		}
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+func (p *eapTlsPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.out = append(p.out, b...)
+	return len(b), nil
+}
+
+func (p *eapTlsPipe) takeOutput() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := p.out
+	p.out = nil
+	return out
+}
+
+func (p *eapTlsPipe) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return nil
+}
+
+func (p *eapTlsPipe) LocalAddr() net.Addr                { return nil }
+func (p *eapTlsPipe) RemoteAddr() net.Addr               { return nil }
+func (p *eapTlsPipe) SetDeadline(t time.Time) error      { return nil }
+func (p *eapTlsPipe) SetReadDeadline(t time.Time) error  { return nil }
+func (p *eapTlsPipe) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,254 @@
+package tests
+
+import (
+	"crypto/md5"
+	"strings"
+	"testing"
+	"time"
+
+	"radius-server/src/config"
+	"radius-server/src/radius/dictionary"
+	"radius-server/src/radius/eap"
+	"radius-server/src/radius/handlers"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2869"
+)
+
+// The EAP conversation state machine, run with EAP-MD5 directly on an
+// eap.Server for the session store and through the UDP access listener for
+// the RADIUS encapsulation.
+
+const (
+	testEapUser     = "test-eap-user"
+	testEapPassword = "test-eap-password"
+)
+
+// eapTestUsers resolves every identity to the cleartext password
+// testEapPassword.
+type eapTestUsers struct{}
+
+func (eapTestUsers) Credentials(identity string) (eap.Credentials, error) {
+	return eapTestCredentials{}, nil
+}
+
+type eapTestCredentials struct{}
+
+func (eapTestCredentials) CleartextPassword() (string, bool) {
+	return testEapPassword, true
+}
+
+func (eapTestCredentials) VerifyPassword(password string) bool {
+	return password == testEapPassword
+}
+
+func (eapTestCredentials) NtPasswordHash() ([]byte, bool) {
+	return nil, false
+}
+
+func testEap(t *testing.T) {
+	t.Run("Expiry", testEapExpiry)
+	t.Run("MaxSessions", testEapMaxSessions)
+	t.Run("Owner", testEapOwner)
+	t.Run("IdentifierMismatch", testEapIdentifierMismatch)
+	t.Run("SplitMessage", testEapSplitMessage)
+	t.Run("StateReplay", testEapStateReplay)
+	t.Run("GtcRefused", testEapGtcRefused)
+}
+
+func newEapTestServer(ttl time.Duration, maxSessions int) *eap.Server {
+	return eap.NewServer(eap.Config{
+		Methods:     []eap.Type{eap.TypeMd5Challenge},
+		SessionTtl:  ttl,
+		MaxSessions: maxSessions,
+	})
+}
+
+func eapIdentity(identifier uint8, identity string) []byte {
+	return (&eap.Packet{Code: eap.CodeResponse, Identifier: identifier, Type: eap.TypeIdentity, Data: []byte(identity)}).Encode()
+}
+
+// eapMd5Response answers the EAP-MD5 request with password.
+func eapMd5Response(t *testing.T, message []byte, password string) []byte {
+	t.Helper()
+	request, err := eap.Parse(message)
+	if err != nil {
+		t.Fatalf("parse eap request: %v", err)
+	}
+	if request.Code != eap.CodeRequest || request.Type != eap.TypeMd5Challenge || len(request.Data) < 1 {
+		t.Fatalf("eap request %d %s, want an MD5-Challenge request", request.Code, request.Type)
+	}
+	hash := md5.New()
+	hash.Write([]byte{request.Identifier})
+	hash.Write([]byte(password))
+	hash.Write(request.Data[1 : 1+int(request.Data[0])])
+	data := append([]byte{md5.Size}, hash.Sum(nil)...)
+	return (&eap.Packet{Code: eap.CodeResponse, Identifier: request.Identifier, Type: eap.TypeMd5Challenge, Data: data}).Encode()
+}
+
+// startEap starts a conversation on server and returns its challenge.
+func startEap(t *testing.T, server *eap.Server, owner string) eap.Reply {
+	t.Helper()
+	reply := server.Handle(owner, nil, eapIdentity(1, testEapUser), eapTestUsers{})
+	if reply.Action != eap.ActionChallenge {
+		t.Fatalf("identity response: action %d, want a challenge (%s)", reply.Action, reply.Reason)
+	}
+	return reply
+}
+
+// expectEapAction checks the action of reply and, for accepts and rejects,
+// the code of its EAP packet.
+func expectEapAction(t *testing.T, reply eap.Reply, action eap.Action) {
+	t.Helper()
+	if reply.Action != action {
+		t.Fatalf("action %d, want %d (%s)", reply.Action, action, reply.Reason)
+	}
+	codes := map[eap.Action]eap.Code{eap.ActionAccept: eap.CodeSuccess, eap.ActionReject: eap.CodeFailure}
+	if code, ok := codes[action]; ok {
+		packet, err := eap.Parse(reply.Message)
+		if err != nil {
+			t.Fatalf("parse eap packet: %v", err)
+		}
+		if packet.Code != code {
+			t.Fatalf("eap code %d, want %d", packet.Code, code)
+		}
+	}
+}
+
+func testEapExpiry(t *testing.T) {
+	server := newEapTestServer(50*time.Millisecond, 10)
+	challenge := startEap(t, server, "1/"+testEapUser)
+	time.Sleep(100 * time.Millisecond)
+
+	reply := server.Handle("1/"+testEapUser, challenge.State, eapMd5Response(t, challenge.Message, testEapPassword), eapTestUsers{})
+	expectEapAction(t, reply, eap.ActionReject)
+	if !strings.Contains(reply.Reason, "expired") {
+		t.Errorf("reason %q, want an expired State", reply.Reason)
+	}
+}
+
+func testEapMaxSessions(t *testing.T) {
+	server := newEapTestServer(time.Minute, 2)
+	first := startEap(t, server, "1/"+testEapUser)
+	startEap(t, server, "2/"+testEapUser)
+
+	reply := server.Handle("3/"+testEapUser, nil, eapIdentity(1, testEapUser), eapTestUsers{})
+	expectEapAction(t, reply, eap.ActionReject)
+
+	// a finished conversation frees its slot
+	reply = server.Handle("1/"+testEapUser, first.State, eapMd5Response(t, first.Message, testEapPassword), eapTestUsers{})
+	expectEapAction(t, reply, eap.ActionAccept)
+	startEap(t, server, "3/"+testEapUser)
+}
+
+func testEapOwner(t *testing.T) {
+	server := newEapTestServer(time.Minute, 10)
+	for _, owner := range []string{"2/" + testEapUser, "1/" + testPapUser} {
+		challenge := startEap(t, server, "1/"+testEapUser)
+		response := eapMd5Response(t, challenge.Message, testEapPassword)
+
+		reply := server.Handle(owner, challenge.State, response, eapTestUsers{})
+		expectEapAction(t, reply, eap.ActionReject)
+		// the conversation is over for its owner too
+		reply = server.Handle("1/"+testEapUser, challenge.State, response, eapTestUsers{})
+		expectEapAction(t, reply, eap.ActionReject)
+	}
+}
+
+func testEapIdentifierMismatch(t *testing.T) {
+	server := newEapTestServer(time.Minute, 10)
+	challenge := startEap(t, server, "1/"+testEapUser)
+	response := eapMd5Response(t, challenge.Message, testEapPassword)
+
+	stale := append([]byte{}, response...)
+	stale[1]--
+	reply := server.Handle("1/"+testEapUser, challenge.State, stale, eapTestUsers{})
+	expectEapAction(t, reply, eap.ActionDiscard)
+
+	// the State still answers the current request
+	reply = server.Handle("1/"+testEapUser, challenge.State, response, eapTestUsers{})
+	expectEapAction(t, reply, eap.ActionAccept)
+}
+
+// newEapRequest returns an Access-Request of username carrying message split
+// in EAP-Message attributes of at most chunk bytes.
+func newEapRequest(t *testing.T, username string, state []byte, message []byte, chunk int) *radius.Packet {
+	t.Helper()
+	p, err := newAccessRequest(testNasSecret, username, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != nil {
+		if err := rfc2865.State_Set(p, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for len(message) > 0 {
+		n := min(chunk, len(message))
+		p.Add(rfc2869.EAPMessage_Type, message[:n])
+		message = message[n:]
+	}
+	return p
+}
+
+// eapExchange sends the EAP request and checks the code of the answer.
+func eapExchange(t *testing.T, p *radius.Packet, code radius.Code) *radius.Packet {
+	t.Helper()
+	response, err := exchange(p)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if response.Code != code {
+		t.Fatalf("response %s, want %s", response.Code, code)
+	}
+	return response
+}
+
+// responseEapMessage returns the joined EAP-Message attributes of p.
+func responseEapMessage(t *testing.T, p *radius.Packet) []byte {
+	t.Helper()
+	value, err := dictionary.Lookup(p, "EAP-Message")
+	if err != nil {
+		t.Fatalf("EAP-Message: %v", err)
+	}
+	return value.([]byte)
+}
+
+func testEapSplitMessage(t *testing.T) {
+	challenge := eapExchange(t, newEapRequest(t, testEapUser, nil, eapIdentity(1, testEapUser), 5), radius.CodeAccessChallenge)
+	response := eapMd5Response(t, responseEapMessage(t, challenge), testEapPassword)
+	// the 22 bytes of the MD5 response in 4 attributes
+	request := newEapRequest(t, testEapUser, rfc2865.State_Get(challenge), response, 7)
+	accept := eapExchange(t, request, radius.CodeAccessAccept)
+	success, err := eap.Parse(responseEapMessage(t, accept))
+	if err != nil {
+		t.Fatalf("parse eap packet: %v", err)
+	}
+	if success.Code != eap.CodeSuccess {
+		t.Errorf("eap code %d, want %d", success.Code, eap.CodeSuccess)
+	}
+}
+
+func testEapStateReplay(t *testing.T) {
+	challenge := eapExchange(t, newEapRequest(t, testEapUser, nil, eapIdentity(1, testEapUser), 253), radius.CodeAccessChallenge)
+	state := rfc2865.State_Get(challenge)
+	response := eapMd5Response(t, responseEapMessage(t, challenge), testEapPassword)
+
+	// the State of the conversation of another user is rejected and ends it
+	eapExchange(t, newEapRequest(t, testPapUser, state, response, 253), radius.CodeAccessReject)
+	eapExchange(t, newEapRequest(t, testEapUser, state, response, 253), radius.CodeAccessReject)
+}
+
+// testEapGtcRefused checks that EAP-GTC, the password in clear text, cannot
+// be enabled outside a tunnel.
+func testEapGtcRefused(t *testing.T) {
+	eapConfig := &config.AppConfig.RadiusServer.Eap
+	saved := eapConfig.Methods
+	defer func() { eapConfig.Methods = saved }()
+
+	eapConfig.Methods = []string{"md5", "gtc"}
+	if err := handlers.InitEap(); err == nil {
+		t.Fatal("EAP server created with gtc in EAP_METHODS")
+	}
+}
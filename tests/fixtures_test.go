@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"radius-server/src/database"
+	"radius-server/src/database/entities"
+	typeUtil "radius-server/src/utils/type"
+)
+
+// Database rows used by the suite. They are created by TestMain and removed
+// when the suite ends, rows left by an interrupted run are removed first.
+
+const (
+	testNasAddress  = "127.0.0.1"
+	testNasSecret   = "test-nas-secret"
+	testPapUser     = "test-pap-user"
+	testPapPassword = "test-pap-password"
+)
+
+var testNas *entities.RadiusNas
+
+func testUsers() []entities.RadiusUser {
+	return []entities.RadiusUser{
+		{Username: testPapUser, CleartextPassword: typeUtil.String(testPapPassword), IsActive: true},
+		{Username: testEapUser, CleartextPassword: typeUtil.String(testEapPassword), IsActive: true},
+		{Username: policyNasUser, CleartextPassword: typeUtil.String(policyNasPassword), IsActive: true},
+		{Username: testTunnelUser, CleartextPassword: typeUtil.String(testTunnelPassword), IsActive: true},
+		// certificate users, without a password EAP-MD5 is not proposed
+		{Username: testTlsUser1, IsActive: true},
+		{Username: testTlsUser2, IsActive: true},
+	}
+}
+
+func testUsernames() []string {
+	usernames := []string{}
+	for _, user := range testUsers() {
+		usernames = append(usernames, user.Username)
+	}
+	return usernames
+}
+
+func createFixtures() error {
+	deleteFixtures()
+
+	testNas = &entities.RadiusNas{
+		NasName:                    typeUtil.String("radius-server test NAS"),
+		IpAddress:                  testNasAddress,
+		Secret:                     testNasSecret,
+		MessageAuthenticatorPolicy: entities.MessageAuthenticatorRequire,
+		TlsIdentity:                typeUtil.String(testNasName),
+	}
+	if err := database.CreateNas(nil, testNas); err != nil {
+		return err
+	}
+	users := testUsers()
+	policy := policyFixtures()
+	for _, rows := range []any{&users, &policy.checks, &policy.replies, &policy.userGroups, &policy.groupChecks, &policy.groupReplies} {
+		if err := insert(rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteFixtures() {
+	policy := policyFixtures()
+	database.DbConn.Where("tls_identity = ?", testNasName).Delete(&entities.RadiusNas{})
+	database.DbConn.Where("username IN ?", testUsernames()).Delete(&entities.RadiusUser{})
+	database.DbConn.Where("username IN ?", policy.usernames()).Delete(&entities.RadiusCheck{})
+	database.DbConn.Where("username IN ?", policy.usernames()).Delete(&entities.RadiusReply{})
+	database.DbConn.Where("username IN ?", policy.usernames()).Delete(&entities.RadiusUserGroup{})
+	database.DbConn.Where("groupname IN ?", policy.groupNames()).Delete(&entities.RadiusGroupCheck{})
+	database.DbConn.Where("groupname IN ?", policy.groupNames()).Delete(&entities.RadiusGroupReply{})
+}
+
+// insert creates the rows of a slice of entities in their table.
+func insert(rows any) error {
+	return database.DbConn.Create(rows).Error
+}
@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"radius-server/src/cache"
+	"radius-server/src/common/logger"
+	"radius-server/src/config"
+	"radius-server/src/database"
+	"radius-server/src/radius"
+	"radius-server/src/radius/revocation"
+)
+
+// The suite runs the RADIUS server in process against the database of
+// ./.env. Listeners bind free ports of 127.0.0.1 and use a PKI generated in a
+// temporary directory, the other settings come from ./.env.
+
+var (
+	pki            *testPki
+	accessAddress  string
+	radSecAddress  string
+	dtlsAddress    string
+	serverStartErr = make(chan error, 1)
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	logger.InitializeLogger()
+	if err := chdirModuleRoot(); err != nil {
+		logger.Logger.Error().Msgf("Locate module root error. %s", err.Error())
+		return 1
+	}
+
+	dir, err := os.MkdirTemp("", "radius-server-tests")
+	if err != nil {
+		logger.Logger.Error().Msgf("Create test directory error. %s", err.Error())
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	pki, err = newTestPki(dir)
+	if err != nil {
+		logger.Logger.Error().Msgf("Generate test PKI error. %s", err.Error())
+		return 1
+	}
+	if err := setTestEnv(); err != nil {
+		logger.Logger.Error().Msgf("Set test environment error. %s", err.Error())
+		return 1
+	}
+	config.LoadConfig()
+
+	if err := database.Connect(); err != nil {
+		logger.Logger.Error().Msgf("Connection to database error. %s", err.Error())
+		return 1
+	}
+	if config.AppConfig.Database.AutoRunMigration {
+		if err := database.MigrateUp(); err != nil {
+			logger.Logger.Error().Msgf("Run migrations error. %s", err.Error())
+			return 1
+		}
+	}
+	if err := createFixtures(); err != nil {
+		logger.Logger.Error().Msgf("Create fixtures error. %s", err.Error())
+		deleteFixtures()
+		return 1
+	}
+	defer deleteFixtures()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := cache.StartNasCache(ctx); err != nil {
+		logger.Logger.Error().Msgf("Load NAS cache error. %s", err.Error())
+		return 1
+	}
+	if err := revocation.Start(ctx); err != nil {
+		logger.Logger.Error().Msgf("Load CRL error. %s", err.Error())
+		return 1
+	}
+	go func() {
+		serverStartErr <- radius.New().Start()
+	}()
+	if err := waitServerReady(); err != nil {
+		logger.Logger.Error().Msgf("Start RADIUS server error. %s", err.Error())
+		return 1
+	}
+
+	return m.Run()
+}
+
+// TestOrderedSuite runs the subtests in order, they share the server started
+// by TestMain.
+func TestOrderedSuite(t *testing.T) {
+	t.Run("Dtls", testDtls)
+	t.Run("Dictionary", testDictionary)
+	t.Run("Policy", testPolicy)
+	t.Run("Eap", testEap)
+	t.Run("EapTls", testEapTls)
+	t.Run("Peap", testPeap)
+	t.Run("Ttls", testTtls)
+	t.Run("Revocation", testRevocation)
+}
+
+// chdirModuleRoot changes the working directory to the closest parent
+// holding go.mod, so ./.env is found whatever the package directory.
+func chdirModuleRoot() error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return os.Chdir(dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return errors.New("go.mod not found")
+		}
+		dir = parent
+	}
+}
+
+// setTestEnv overrides the listener and certificate settings of ./.env,
+// variables already set take precedence over the file.
+func setTestEnv() error {
+	accessPort, err := freePort("udp")
+	if err != nil {
+		return err
+	}
+	accountingPort, err := freePort("udp")
+	if err != nil {
+		return err
+	}
+	radSecPort, err := freePort("tcp")
+	if err != nil {
+		return err
+	}
+	dtlsPort, err := freePort("udp")
+	if err != nil {
+		return err
+	}
+	accessAddress = net.JoinHostPort("127.0.0.1", strconv.Itoa(accessPort))
+	radSecAddress = net.JoinHostPort("127.0.0.1", strconv.Itoa(radSecPort))
+	dtlsAddress = net.JoinHostPort("127.0.0.1", strconv.Itoa(dtlsPort))
+
+	env := map[string]string{
+		"ACCESS_HANDLER_SERVER_HOST":     "127.0.0.1",
+		"ACCESS_HANDLER_SERVER_PORT":     strconv.Itoa(accessPort),
+		"ACCOUNTING_HANDLER_SERVER_HOST": "127.0.0.1",
+		"ACCOUNTING_HANDLER_SERVER_PORT": strconv.Itoa(accountingPort),
+		"TCP_ENABLED":                    "false",
+		"RADSEC_ENABLED":                 "true",
+		"RADSEC_SERVER_HOST":             "127.0.0.1",
+		"RADSEC_SERVER_PORT":             strconv.Itoa(radSecPort),
+		"RADSEC_DTLS_ENABLED":            "true",
+		"RADSEC_DTLS_SERVER_HOST":        "127.0.0.1",
+		"RADSEC_DTLS_SERVER_PORT":        strconv.Itoa(dtlsPort),
+		"RADSEC_CERT_FILE":               pki.serverCertFile,
+		"RADSEC_KEY_FILE":                pki.serverKeyFile,
+		"RADSEC_CLIENT_CA_FILE":          pki.caFile,
+		"EAP_METHODS":                    "md5,tls,peap,ttls",
+		"EAP_TLS_CERT_FILE":              pki.serverCertFile,
+		"EAP_TLS_KEY_FILE":               pki.serverKeyFile,
+		"EAP_TLS_CA_FILE":                pki.caFile,
+		"EAP_TLS_FRAGMENT_SIZE":          strconv.Itoa(eapTlsServerFragmentSize),
+		"EAP_TLS_MIN_VERSION":            "1.2",
+		"EAP_TLS_MAX_VERSION":            "1.3",
+		"EAP_TLS_CHECK_IDENTITY":         "true",
+		"CRL_SOURCES":                    "",
+		"OCSP_ENABLED":                   "false",
+		"REVOCATION_FAIL_POLICY":         "soft",
+	}
+	for key, value := range env {
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func freePort(network string) (int, error) {
+	if network == "tcp" {
+		l, err := net.Listen(network, "127.0.0.1:0")
+		if err != nil {
+			return 0, err
+		}
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).Port, nil
+	}
+	conn, err := net.ListenPacket(network, "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port, nil
+}
+
+// waitServerReady waits until the UDP access listener answers Status-Server
+// and the RadSec listener accepts connections.
+func waitServerReady() error {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-serverStartErr:
+			return err
+		default:
+		}
+		if err := statusServer(); err == nil {
+			if conn, err := net.DialTimeout("tcp", radSecAddress, time.Second); err == nil {
+				conn.Close()
+				return nil
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("no answer from %s within 10s", accessAddress)
+}
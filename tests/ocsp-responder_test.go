@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// maxOcspRequestLength bounds the requests read by the responder
+const maxOcspRequestLength = 64 << 10
+
+// ocspResponder is a minimal OCSP responder answering from a list of revoked
+// serial numbers, signed by the CA itself. It stands in for the CA responder,
+// pointed at with OCSP_RESPONDER_URL.
+type ocspResponder struct {
+	ca *testCa
+
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func newOcspResponder(ca *testCa) *ocspResponder {
+	return &ocspResponder{ca: ca, revoked: map[string]time.Time{}}
+}
+
+// revoke marks a serial number as revoked from now on.
+func (r *ocspResponder) revoke(serial *big.Int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoked[serial.String()] = time.Now()
+}
+
+// ServeHTTP answers POST requests (RFC 6960 appendix A.1).
+func (r *ocspResponder) ServeHTTP(w http.ResponseWriter, httpRequest *http.Request) {
+	if httpRequest.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(httpRequest.Body, maxOcspRequestLength))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	request, err := ocsp.ParseRequest(body)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(ocsp.MalformedRequestErrorResponse)
+		return
+	}
+
+	now := time.Now().Truncate(time.Second)
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: request.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(time.Hour),
+	}
+	if !r.issues(request) {
+		template.Status = ocsp.Unknown
+	} else if revokedAt, ok := r.revokedAt(request.SerialNumber); ok {
+		template.Status = ocsp.Revoked
+		template.RevokedAt = revokedAt.Truncate(time.Second)
+		template.RevocationReason = ocsp.Unspecified
+	}
+	response, err := ocsp.CreateResponse(r.ca.certificate, r.ca.certificate, template, r.ca.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(response)
+}
+
+func (r *ocspResponder) revokedAt(serial *big.Int) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	revokedAt, ok := r.revoked[serial.String()]
+	return revokedAt, ok
+}
+
+// issues reports whether the request is about a certificate of the CA,
+// identified by the hashes of its name and public key.
+func (r *ocspResponder) issues(request *ocsp.Request) bool {
+	if !request.HashAlgorithm.Available() {
+		return false
+	}
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(r.ca.certificate.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return false
+	}
+	nameHash := request.HashAlgorithm.New()
+	nameHash.Write(r.ca.certificate.RawSubject)
+	keyHash := request.HashAlgorithm.New()
+	keyHash.Write(publicKeyInfo.PublicKey.RightAlign())
+	return bytes.Equal(nameHash.Sum(nil), request.IssuerNameHash) && bytes.Equal(keyHash.Sum(nil), request.IssuerKeyHash)
+}
@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"radius-server/src/radius/eap"
+	"radius-server/src/radius/mschap"
+	cryptoUtil "radius-server/src/utils/crypto"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+)
+
+// PEAPv0 with inner EAP-MSCHAPv2 through the UDP access listener. The outer
+// identity is testEapUser, proposed EAP-MD5 first and refusing it with a
+// Nak, the inner identity testTunnelUser is told by the Reply-Message of its
+// reply items.
+
+const (
+	testTunnelUser     = "test-tunnel-user"
+	testTunnelPassword = "test-tunnel-password"
+)
+
+const (
+	peapTlvResult     = 3
+	peapTlvMandatory  = 0x8000
+	peapResultSuccess = 1
+	peapResultFailure = 2
+
+	mschapv2OpChallenge = 1
+	mschapv2OpResponse  = 2
+	mschapv2OpSuccess   = 3
+	mschapv2OpFailure   = 4
+)
+
+func testPeap(t *testing.T) {
+	t.Run("Tls12", func(t *testing.T) { testPeapAccept(t, tls.VersionTLS12, false) })
+	t.Run("Tls13", func(t *testing.T) { testPeapAccept(t, tls.VersionTLS13, false) })
+	t.Run("InnerHeaders", func(t *testing.T) { testPeapAccept(t, tls.VersionTLS13, true) })
+	t.Run("Reject", testPeapReject)
+}
+
+// testPeapAccept authenticates the inner identity, with inner responses
+// sent with their EAP header when headers is set.
+func testPeapAccept(t *testing.T, version uint16, headers bool) {
+	peer := &peapPeer{identity: testTunnelUser, password: testTunnelPassword, headers: headers}
+	supplicant := newTunnelSupplicant(eap.TypePeap, version, peer.run)
+	request, response := eapTlsAuthenticate(t, testEapUser, supplicant)
+	if response.Code != radius.CodeAccessAccept {
+		t.Fatalf("response %s, want %s (%s)", response.Code, radius.CodeAccessAccept, rfc2865.ReplyMessage_GetString(response))
+	}
+	if supplicant.err != nil {
+		t.Fatalf("supplicant: %v", supplicant.err)
+	}
+	if got := rfc2865.ReplyMessage_GetString(response); got != testTunnelUser {
+		t.Errorf("reply items of %q, want those of the inner identity %q", got, testTunnelUser)
+	}
+	if !peer.serverAuthenticated || peer.mschapv2Result != mschapv2OpSuccess {
+		t.Errorf("EAP-MSCHAPv2 result %d, authenticator response verified %t, want an acknowledged success", peer.mschapv2Result, peer.serverAuthenticated)
+	}
+	if peer.result != peapResultSuccess {
+		t.Errorf("Result TLV %d, want success", peer.result)
+	}
+	// TLS 1.2 ends with the Finished message of the server, acknowledged
+	// before the first inner request
+	if version == tls.VersionTLS12 && supplicant.emptyResponses == 0 {
+		t.Error("inner request sent before the acknowledgement of the Finished message")
+	}
+	checkMppeKeys(t, request, response, supplicant.msk(t))
+}
+
+func testPeapReject(t *testing.T) {
+	peer := &peapPeer{identity: testTunnelUser, password: "wrong-password"}
+	supplicant := newTunnelSupplicant(eap.TypePeap, tls.VersionTLS12, peer.run)
+	_, response := eapTlsAuthenticate(t, testEapUser, supplicant)
+	if response.Code != radius.CodeAccessReject {
+		t.Fatalf("response %s, want %s", response.Code, radius.CodeAccessReject)
+	}
+	if supplicant.err != nil {
+		t.Fatalf("supplicant: %v", supplicant.err)
+	}
+	if peer.mschapv2Result != mschapv2OpFailure {
+		t.Errorf("EAP-MSCHAPv2 result %d, want an acknowledged failure", peer.mschapv2Result)
+	}
+	if peer.result != peapResultFailure {
+		t.Errorf("Result TLV %d, want failure", peer.result)
+	}
+	failure, err := eap.Parse(responseEapMessage(t, response))
+	if err != nil {
+		t.Fatalf("parse eap packet: %v", err)
+	}
+	if failure.Code != eap.CodeFailure {
+		t.Errorf("eap code %d, want %d", failure.Code, eap.CodeFailure)
+	}
+}
+
+// peapPeer is the inner conversation of the PEAP supplicant. It answers the
+// inner Identity and EAP-MSCHAPv2 requests, which the server sends without
+// EAP header, and echoes the Result TLV of the Extensions request.
+type peapPeer struct {
+	identity string
+	password string
+	// headers sends the inner responses with their EAP header
+	headers bool
+
+	identifier          uint8
+	challenge           []byte
+	peerChallenge       []byte
+	ntResponse          []byte
+	serverAuthenticated bool
+	// mschapv2Result is the EAP-MSCHAPv2 result opcode acknowledged
+	mschapv2Result uint8
+	// result is the status of the Result TLV
+	result uint16
+}
+
+func (p *peapPeer) run(conn *tls.Conn) error {
+	b := make([]byte, 16*1024)
+	for {
+		n, err := conn.Read(b)
+		if err != nil {
+			return err
+		}
+		record := b[:n]
+		p.identifier++
+
+		if len(record) >= 5 && eap.Code(record[0]) == eap.CodeRequest && int(binary.BigEndian.Uint16(record[2:4])) == len(record) {
+			request, err := eap.Parse(record)
+			if err != nil {
+				return err
+			}
+			if request.Type != eap.TypeExtensions {
+				return fmt.Errorf("inner %s request with its EAP header", request.Type)
+			}
+			p.result = peapResult(request.Data)
+			_, err = conn.Write(p.encode(eap.TypeExtensions, peapResultTlv(p.result), true))
+			return err
+		}
+
+		var data []byte
+		switch eap.Type(record[0]) {
+		case eap.TypeIdentity:
+			data = []byte(p.identity)
+		case eap.TypeMschapv2:
+			if data, err = p.mschapv2(record[1:]); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected inner request %x", record)
+		}
+		if _, err := conn.Write(p.encode(eap.Type(record[0]), data, p.headers)); err != nil {
+			return err
+		}
+	}
+}
+
+// mschapv2 returns the type data answering an EAP-MSCHAPv2 request.
+func (p *peapPeer) mschapv2(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errors.New("EAP-MSCHAPv2 request too short")
+	}
+	ntHash := cryptoUtil.NtPasswordHash(p.password)
+	username := mschap.ChallengeUsername(p.identity)
+	switch data[0] {
+	case mschapv2OpChallenge:
+		if len(data) < 5+16 || data[4] != 16 {
+			return nil, errors.New("malformed EAP-MSCHAPv2 challenge")
+		}
+		p.challenge = append([]byte{}, data[5:21]...)
+		p.peerChallenge = make([]byte, 16)
+		if _, err := rand.Read(p.peerChallenge); err != nil {
+			return nil, err
+		}
+		p.ntResponse = mschap.NtResponse(p.challenge, p.peerChallenge, username, ntHash)
+
+		value := append([]byte{49}, p.peerChallenge...)
+		value = append(value, make([]byte, 8)...)
+		value = append(value, p.ntResponse...)
+		value = append(value, 0)
+		value = append(value, p.identity...)
+		response := []byte{mschapv2OpResponse, data[1]}
+		response = binary.BigEndian.AppendUint16(response, uint16(4+len(value)))
+		return append(response, value...), nil
+	case mschapv2OpSuccess:
+		expected := mschap.AuthenticatorResponse(p.challenge, p.peerChallenge, p.ntResponse, username, ntHash)
+		p.serverAuthenticated = strings.HasPrefix(string(data[4:]), expected)
+		p.mschapv2Result = mschapv2OpSuccess
+		return []byte{mschapv2OpSuccess}, nil
+	case mschapv2OpFailure:
+		p.mschapv2Result = mschapv2OpFailure
+		return []byte{mschapv2OpFailure}, nil
+	}
+	return nil, fmt.Errorf("unexpected EAP-MSCHAPv2 opcode %d", data[0])
+}
+
+// encode returns an inner response, without its EAP header unless header
+// is set.
+func (p *peapPeer) encode(t eap.Type, data []byte, header bool) []byte {
+	packet := (&eap.Packet{Code: eap.CodeResponse, Identifier: p.identifier, Type: t, Data: data}).Encode()
+	if header {
+		return packet
+	}
+	return packet[4:]
+}
+
+func peapResultTlv(result uint16) []byte {
+	tlv := binary.BigEndian.AppendUint16(nil, peapTlvMandatory|peapTlvResult)
+	tlv = binary.BigEndian.AppendUint16(tlv, 2)
+	return binary.BigEndian.AppendUint16(tlv, result)
+}
+
+// peapResult returns the status of the Result TLV of an Extensions request,
+// 0 when it holds none.
+func peapResult(data []byte) uint16 {
+	if len(data) < 6 || binary.BigEndian.Uint16(data)&0x3fff != peapTlvResult || binary.BigEndian.Uint16(data[2:4]) != 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(data[4:6])
+}
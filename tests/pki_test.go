@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Test PKI generated at startup. The server certificate is used by RadSec,
+// RADIUS/DTLS and the EAP TLS methods, the client certificates are issued to
+// the NAS fixture and the EAP-TLS users. A second CA, trusted as well, issues
+// the certificates checked with OCSP, no CRL of it is ever loaded.
+
+const (
+	testServerName = "radius.test"
+	testNasName    = "nas.radius-server.test"
+)
+
+var testSerial atomic.Int64
+
+type testCa struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+type testPki struct {
+	dir    string
+	ca     *testCa
+	ocspCa *testCa
+	server tls.Certificate
+	nas    tls.Certificate
+	// files passed to the server configuration
+	serverCertFile string
+	serverKeyFile  string
+	caFile         string
+}
+
+func newTestCa(commonName string) (*testCa, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial.Add(1)),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &testCa{certificate: certificate, key: key}, nil
+}
+
+// issue signs a leaf certificate for commonName, a server certificate when
+// server is set and a client certificate otherwise.
+func (ca *testCa) issue(commonName string, server bool) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(testSerial.Add(1)),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		DNSNames:     []string{commonName},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+func (ca *testCa) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.certificate)
+	return pool
+}
+
+// newTestPki generates the CAs, the server and NAS certificates and writes
+// the server credentials and the CA bundle to dir.
+func newTestPki(dir string) (*testPki, error) {
+	ca, err := newTestCa("radius-server test CA")
+	if err != nil {
+		return nil, err
+	}
+	ocspCa, err := newTestCa("radius-server test OCSP CA")
+	if err != nil {
+		return nil, err
+	}
+	server, err := ca.issue(testServerName, true)
+	if err != nil {
+		return nil, err
+	}
+	nas, err := ca.issue(testNasName, false)
+	if err != nil {
+		return nil, err
+	}
+
+	pki := &testPki{
+		dir:            dir,
+		ca:             ca,
+		ocspCa:         ocspCa,
+		server:         server,
+		nas:            nas,
+		serverCertFile: filepath.Join(dir, "server.pem"),
+		serverKeyFile:  filepath.Join(dir, "server-key.pem"),
+		caFile:         filepath.Join(dir, "ca.pem"),
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(server.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := writePem(pki.serverCertFile, "CERTIFICATE", server.Certificate[0]); err != nil {
+		return nil, err
+	}
+	if err := writePem(pki.serverKeyFile, "PRIVATE KEY", keyDer); err != nil {
+		return nil, err
+	}
+	if err := writePem(pki.caFile, "CERTIFICATE", ca.certificate.Raw, ocspCa.certificate.Raw); err != nil {
+		return nil, err
+	}
+	return pki, nil
+}
+
+// writePem writes the DER blocks to path, in PEM blocks of blockType.
+func writePem(path string, blockType string, ders ...[]byte) error {
+	data := []byte{}
+	for _, der := range ders {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})...)
+	}
+	return os.WriteFile(path, data, 0600)
+}
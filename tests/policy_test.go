@@ -0,0 +1,364 @@
+package tests
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"radius-server/src/database/entities"
+	"radius-server/src/radius/dictionary"
+	"radius-server/src/radius/policy"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+)
+
+// Check and reply items evaluated by policy.Authorize from the database
+// fixtures. Every operator user has a single check item and the reply item
+// Reply-Message = matched, so the reply tells whether the check item matched.
+
+const (
+	policyMergeUser  = "test-policy-merge"
+	policyMergeGroup = "test-policy-merge-group"
+	policyFallUser   = "test-policy-fall-through"
+	policyNoFallUser = "test-policy-no-fall-through"
+	policyStopUser   = "test-policy-stop"
+	// policyNasUser has a password and may only authenticate from
+	// policyNasAddress
+	policyNasUser     = "test-policy-nas"
+	policyNasPassword = "test-policy-nas-password"
+	policyNasAddress  = "192.0.2.1"
+)
+
+type policyOperatorCase struct {
+	check policy.Item
+	// matchPresent and matchAbsent are the expected outcomes against a
+	// request with and without the attribute
+	matchPresent bool
+	matchAbsent  bool
+}
+
+var policyOperatorCases = []policyOperatorCase{
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpEqual, Value: "10"}, matchPresent: true},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpEqual, Value: "11"}},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpNotEqual, Value: "11"}, matchPresent: true},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpNotEqual, Value: "10"}},
+	// integers are ordered numerically, "10" < "9" as text
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpGreater, Value: "9"}, matchPresent: true},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpGreater, Value: "10"}},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpGreaterEqual, Value: "10"}, matchPresent: true},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpGreaterEqual, Value: "11"}},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpLess, Value: "100"}, matchPresent: true},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpLess, Value: "10"}},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpLessEqual, Value: "10"}, matchPresent: true},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpLessEqual, Value: "9"}},
+	{check: policy.Item{Attribute: "Calling-Station-Id", Op: policy.OpRegex, Value: "^00-11-"}, matchPresent: true},
+	{check: policy.Item{Attribute: "Calling-Station-Id", Op: policy.OpRegex, Value: "^aa"}},
+	{check: policy.Item{Attribute: "Calling-Station-Id", Op: policy.OpNotRegex, Value: "^aa"}, matchPresent: true},
+	{check: policy.Item{Attribute: "Calling-Station-Id", Op: policy.OpNotRegex, Value: "^00"}},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpPresent}, matchPresent: true},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpAbsent}, matchAbsent: true},
+	// strings are ordered by their text
+	{check: policy.Item{Attribute: "Calling-Station-Id", Op: policy.OpGreater, Value: "00-11"}, matchPresent: true},
+	// named values
+	{check: policy.Item{Attribute: "Service-Type", Op: policy.OpEqual, Value: "Framed-User"}, matchPresent: true},
+	// any instance of a repeated attribute
+	{check: policy.Item{Attribute: "Class", Op: policy.OpEqual, Value: "0x62"}, matchPresent: true},
+	{check: policy.Item{Attribute: "Class", Op: policy.OpNotEqual, Value: "0x62"}, matchPresent: true},
+	// invalid items never match
+	{check: policy.Item{Attribute: "Calling-Station-Id", Op: policy.OpRegex, Value: "("}},
+	{check: policy.Item{Attribute: "NAS-Port", Op: policy.OpEqual, Value: "ten"}},
+}
+
+func policyOperatorUser(i int) string {
+	return fmt.Sprintf("test-policy-operator-%02d", i)
+}
+
+func policyGroup(i int) string {
+	return fmt.Sprintf("test-policy-group-%d", i)
+}
+
+// policyRows holds the check and reply items of the policy tests.
+type policyRows struct {
+	checks       []entities.RadiusCheck
+	replies      []entities.RadiusReply
+	userGroups   []entities.RadiusUserGroup
+	groupChecks  []entities.RadiusGroupCheck
+	groupReplies []entities.RadiusGroupReply
+}
+
+func policyFixtures() policyRows {
+	rows := policyRows{}
+	for i, c := range policyOperatorCases {
+		username := policyOperatorUser(i)
+		rows.checks = append(rows.checks, entities.RadiusCheck{Username: username, Attribute: c.check.Attribute, Op: string(c.check.Op), Value: c.check.Value})
+		rows.replies = append(rows.replies, entities.RadiusReply{Username: username, Attribute: "Reply-Message", Op: string(policy.OpSet), Value: "matched"})
+	}
+
+	// = keeps the first value, := replaces every instance, += appends
+	rows.replies = append(rows.replies,
+		entities.RadiusReply{Username: policyMergeUser, Attribute: "Session-Timeout", Op: string(policy.OpSet), Value: "100"},
+		entities.RadiusReply{Username: policyMergeUser, Attribute: "Idle-Timeout", Op: string(policy.OpSet), Value: "10"},
+		entities.RadiusReply{Username: policyMergeUser, Attribute: "Reply-Message", Op: string(policy.OpAdd), Value: "user-1"},
+		entities.RadiusReply{Username: policyMergeUser, Attribute: "Reply-Message", Op: string(policy.OpAdd), Value: "user-2"},
+		entities.RadiusReply{Username: policyMergeUser, Attribute: "Class", Op: string(policy.OpAdd), Value: "0x75"},
+	)
+	rows.userGroups = append(rows.userGroups, entities.RadiusUserGroup{Username: policyMergeUser, GroupName: policyMergeGroup, Priority: 1})
+	rows.groupReplies = append(rows.groupReplies,
+		entities.RadiusGroupReply{GroupName: policyMergeGroup, Attribute: "Session-Timeout", Op: string(policy.OpSet), Value: "200"},
+		entities.RadiusGroupReply{GroupName: policyMergeGroup, Attribute: "Idle-Timeout", Op: string(policy.OpAssign), Value: "20"},
+		entities.RadiusGroupReply{GroupName: policyMergeGroup, Attribute: "Reply-Message", Op: string(policy.OpAssign), Value: "group"},
+		entities.RadiusGroupReply{GroupName: policyMergeGroup, Attribute: "Class", Op: string(policy.OpAdd), Value: "0x67"},
+	)
+
+	// groups are evaluated by priority, inserted in reverse order
+	for _, priority := range []int{5, 4, 3, 2, 1} {
+		rows.userGroups = append(rows.userGroups, entities.RadiusUserGroup{Username: policyFallUser, GroupName: policyGroup(priority), Priority: priority})
+	}
+	rows.userGroups = append(rows.userGroups, entities.RadiusUserGroup{Username: policyNoFallUser, GroupName: policyGroup(1), Priority: 1})
+	rows.replies = append(rows.replies,
+		entities.RadiusReply{Username: policyNoFallUser, Attribute: "Reply-Message", Op: string(policy.OpAdd), Value: "user"},
+		entities.RadiusReply{Username: policyNoFallUser, Attribute: policy.AttributeFallThrough, Op: string(policy.OpSet), Value: "No"},
+	)
+	rows.groupChecks = append(rows.groupChecks,
+		// group 2 does not match, group 3 matches without reply items
+		entities.RadiusGroupCheck{GroupName: policyGroup(2), Attribute: "NAS-Port", Op: string(policy.OpEqual), Value: "999"},
+		entities.RadiusGroupCheck{GroupName: policyGroup(3), Attribute: "NAS-Port", Op: string(policy.OpEqual), Value: "10"},
+	)
+	for _, priority := range []int{1, 2, 4, 5} {
+		rows.groupReplies = append(rows.groupReplies, entities.RadiusGroupReply{GroupName: policyGroup(priority), Attribute: "Reply-Message", Op: string(policy.OpAdd), Value: policyGroup(priority)})
+	}
+	rows.groupReplies = append(rows.groupReplies,
+		entities.RadiusGroupReply{GroupName: policyGroup(1), Attribute: policy.AttributeFallThrough, Op: string(policy.OpSet), Value: "Yes"},
+		entities.RadiusGroupReply{GroupName: policyGroup(4), Attribute: policy.AttributeFallThrough, Op: string(policy.OpSet), Value: "No"},
+	)
+	// without Fall-Through evaluation stops as well
+	rows.userGroups = append(rows.userGroups,
+		entities.RadiusUserGroup{Username: policyStopUser, GroupName: policyGroup(5), Priority: 1},
+		entities.RadiusUserGroup{Username: policyStopUser, GroupName: policyGroup(1), Priority: 2},
+	)
+	// the inner identity of the tunneled methods is told by its reply
+	rows.replies = append(rows.replies, entities.RadiusReply{Username: testTunnelUser, Attribute: "Reply-Message", Op: string(policy.OpSet), Value: testTunnelUser})
+	rows.checks = append(rows.checks, entities.RadiusCheck{Username: policyNasUser, Attribute: "NAS-IP-Address", Op: string(policy.OpEqual), Value: policyNasAddress})
+	return rows
+}
+
+func (rows policyRows) usernames() []string {
+	usernames := []string{}
+	for _, check := range rows.checks {
+		usernames = append(usernames, check.Username)
+	}
+	for _, reply := range rows.replies {
+		usernames = append(usernames, reply.Username)
+	}
+	for _, userGroup := range rows.userGroups {
+		usernames = append(usernames, userGroup.Username)
+	}
+	slices.Sort(usernames)
+	return slices.Compact(usernames)
+}
+
+func (rows policyRows) groupNames() []string {
+	groupNames := []string{}
+	for _, userGroup := range rows.userGroups {
+		groupNames = append(groupNames, userGroup.GroupName)
+	}
+	slices.Sort(groupNames)
+	return slices.Compact(groupNames)
+}
+
+func testPolicy(t *testing.T) {
+	t.Run("Operators", testPolicyOperators)
+	t.Run("Merge", testPolicyMerge)
+	t.Run("FallThrough", testPolicyFallThrough)
+	t.Run("CheckMismatch", testPolicyCheckMismatch)
+}
+
+// newPolicyRequest returns an Access-Request of username, with the attributes
+// compared by the operator cases when present is set.
+func newPolicyRequest(t *testing.T, username string, present bool) *radius.Packet {
+	t.Helper()
+	p, err := newAccessRequest(testNasSecret, username, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !present {
+		return p
+	}
+	for _, attribute := range [][2]string{
+		{"NAS-Port", "10"},
+		{"Calling-Station-Id", "00-11-22-33-44-55"},
+		{"Service-Type", "Framed-User"},
+		{"Class", "0x61"},
+		{"Class", "0x62"},
+	} {
+		if err := dictionary.Add(p, attribute[0], attribute[1]); err != nil {
+			t.Fatalf("add %s: %v", attribute[0], err)
+		}
+	}
+	return p
+}
+
+func testPolicyOperators(t *testing.T) {
+	for i, c := range policyOperatorCases {
+		username := policyOperatorUser(i)
+		for _, present := range []bool{true, false} {
+			want := c.matchAbsent
+			if present {
+				want = c.matchPresent
+			}
+			result, err := policy.Authorize(newPolicyRequest(t, username, present), username)
+			if err != nil {
+				t.Fatalf("%s %s %q: %v", c.check.Attribute, c.check.Op, c.check.Value, err)
+			}
+			if !result.Found {
+				t.Fatalf("%s: check items not found", username)
+			}
+			if _, matched := result.Reply.Get("Reply-Message"); matched != want {
+				t.Errorf("%s %s %q with the attribute present=%t: matched %t, want %t", c.check.Attribute, c.check.Op, c.check.Value, present, matched, want)
+			}
+		}
+	}
+}
+
+// testPolicyMerge checks the assignment operators, when the group items are
+// merged into the user items and when the result is applied to a response
+// already holding some of the attributes.
+func testPolicyMerge(t *testing.T) {
+	request := newPolicyRequest(t, policyMergeUser, true)
+	result, err := policy.Authorize(request, policyMergeUser)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	expected := policy.Items{
+		{Attribute: "Session-Timeout", Op: policy.OpSet, Value: "100"},
+		{Attribute: "Class", Op: policy.OpAdd, Value: "0x75"},
+		{Attribute: "Idle-Timeout", Op: policy.OpAssign, Value: "20"},
+		{Attribute: "Reply-Message", Op: policy.OpAssign, Value: "group"},
+		{Attribute: "Class", Op: policy.OpAdd, Value: "0x67"},
+	}
+	if !slices.Equal(result.Reply, expected) {
+		t.Fatalf("merged reply items %v, want %v", result.Reply, expected)
+	}
+
+	response := request.Response(radius.CodeAccessAccept)
+	rfc2865.SessionTimeout_Set(response, 50)
+	rfc2865.IdleTimeout_Set(response, 5)
+	rfc2865.ReplyMessage_AddString(response, "handler")
+	if err := policy.ApplyReply(response, result.Reply); err != nil {
+		t.Fatalf("apply reply items: %v", err)
+	}
+	for name, want := range map[string][]string{
+		"Session-Timeout": {"50"},
+		"Idle-Timeout":    {"20"},
+		"Reply-Message":   {"group"},
+		"Class":           {"0x75", "0x67"},
+	} {
+		if got := lookupAllStrings(t, response, name); !slices.Equal(got, want) {
+			t.Errorf("response %s %v, want %v", name, got, want)
+		}
+	}
+}
+
+// testPolicyFallThrough checks the order in which groups are evaluated and
+// where evaluation stops.
+func testPolicyFallThrough(t *testing.T) {
+	cases := []struct {
+		username string
+		messages []string
+	}{
+		// group 1 falls through, group 2 does not match, group 3 has no
+		// reply items and group 4 stops with Fall-Through = No before
+		// group 5
+		{username: policyFallUser, messages: []string{policyGroup(1), policyGroup(4)}},
+		{username: policyStopUser, messages: []string{policyGroup(5)}},
+		// Fall-Through = No in the user reply skips the groups
+		{username: policyNoFallUser, messages: []string{"user"}},
+	}
+	for _, c := range cases {
+		result, err := policy.Authorize(newPolicyRequest(t, c.username, true), c.username)
+		if err != nil {
+			t.Fatalf("%s: %v", c.username, err)
+		}
+		messages := []string{}
+		for _, item := range result.Reply {
+			if item.Attribute == policy.AttributeFallThrough {
+				t.Fatalf("%s: Fall-Through in the reply items", c.username)
+			}
+			if item.Attribute == "Reply-Message" {
+				messages = append(messages, item.Value)
+			}
+		}
+		if !slices.Equal(messages, c.messages) {
+			t.Errorf("%s: Reply-Message %v, want %v", c.username, messages, c.messages)
+		}
+	}
+}
+
+// testPolicyCheckMismatch authenticates through the UDP access listener a
+// user with a password whose check items restrict the NAS-IP-Address, with
+// PAP and EAP-MD5.
+func testPolicyCheckMismatch(t *testing.T) {
+	for address, want := range map[string]radius.Code{
+		policyNasAddress: radius.CodeAccessAccept,
+		"198.51.100.1":   radius.CodeAccessReject,
+		"":               radius.CodeAccessReject,
+	} {
+		request, err := newAccessRequest(testNasSecret, policyNasUser, policyNasPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addPolicyNasAddress(t, request, address)
+		response, err := exchange(request)
+		if err != nil {
+			t.Fatalf("exchange: %v", err)
+		}
+		if response.Code != want {
+			t.Errorf("PAP from NAS-IP-Address %q: response %s, want %s", address, response.Code, want)
+		}
+
+		request = newEapRequest(t, policyNasUser, nil, eapIdentity(1, policyNasUser), 253)
+		addPolicyNasAddress(t, request, address)
+		if response, err = exchange(request); err != nil {
+			t.Fatalf("exchange: %v", err)
+		}
+		if response.Code == radius.CodeAccessChallenge {
+			message := eapMd5Response(t, responseEapMessage(t, response), policyNasPassword)
+			request = newEapRequest(t, policyNasUser, rfc2865.State_Get(response), message, 253)
+			addPolicyNasAddress(t, request, address)
+			if response, err = exchange(request); err != nil {
+				t.Fatalf("exchange: %v", err)
+			}
+		}
+		if response.Code != want {
+			t.Errorf("EAP-MD5 from NAS-IP-Address %q: response %s, want %s", address, response.Code, want)
+		}
+	}
+}
+
+func addPolicyNasAddress(t *testing.T, p *radius.Packet, address string) {
+	t.Helper()
+	if address == "" {
+		return
+	}
+	if err := dictionary.Add(p, "NAS-IP-Address", address); err != nil {
+		t.Fatalf("add NAS-IP-Address: %v", err)
+	}
+}
+
+func lookupAllStrings(t *testing.T, p *radius.Packet, name string) []string {
+	t.Helper()
+	values, err := dictionary.LookupAll(p, name)
+	if err != nil {
+		return nil
+	}
+	texts := []string{}
+	for _, value := range values {
+		text, err := dictionary.FormatValue(name, value)
+		if err != nil {
+			t.Fatalf("format %s: %v", name, err)
+		}
+		texts = append(texts, text)
+	}
+	return texts
+}
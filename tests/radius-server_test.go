@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"radius-server/src/radius/handlers"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+)
+
+const exchangeTimeout = 3 * time.Second
+
+var errNotAuthentic = errors.New("response authenticator mismatch")
+
+// newAccessRequest returns a PAP Access-Request protected by secret, the
+// password is omitted when empty.
+func newAccessRequest(secret string, username string, password string) (*radius.Packet, error) {
+	packet := radius.New(radius.CodeAccessRequest, []byte(secret))
+	if err := rfc2865.UserName_SetString(packet, username); err != nil {
+		return nil, err
+	}
+	if password != "" {
+		if err := rfc2865.UserPassword_SetString(packet, password); err != nil {
+			return nil, err
+		}
+	}
+	return packet, nil
+}
+
+// exchange signs packet with Message-Authenticator and sends it to the UDP
+// access listener.
+func exchange(packet *radius.Packet) (*radius.Packet, error) {
+	if err := handlers.SignMessageAuthenticator(packet); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exchangeTimeout)
+	defer cancel()
+	return radius.Exchange(ctx, packet, accessAddress)
+}
+
+func statusServer() error {
+	packet := radius.New(radius.CodeStatusServer, []byte(testNasSecret))
+	if err := handlers.SignMessageAuthenticator(packet); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err := radius.Exchange(ctx, packet, accessAddress)
+	return err
+}
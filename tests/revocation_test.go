@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"radius-server/src/config"
+	"radius-server/src/radius/handlers"
+	"radius-server/src/radius/revocation"
+
+	"layeh.com/radius"
+)
+
+// Revocation of the client certificates of EAP-TLS and RadSec. The
+// revocation settings are read on every handshake, the subtests change them
+// on the running server and restore them when done.
+
+type revocationCase struct {
+	name     string
+	user     tls.Certificate
+	nas      tls.Certificate
+	accepted bool
+}
+
+func testRevocation(t *testing.T) {
+	saved := config.AppConfig.RadiusServer.Revocation
+	t.Cleanup(func() {
+		config.AppConfig.RadiusServer.Revocation = saved
+	})
+	t.Run("Crl", testRevocationCrl)
+	t.Run("Ocsp", testRevocationOcsp)
+	t.Run("FailPolicy", testRevocationFailPolicy)
+}
+
+func testRevocationCrl(t *testing.T) {
+	revokedUser := issueTestCertificate(t, pki.ca, testTlsUser1)
+	revokedNas := issueTestCertificate(t, pki.ca, testNasName)
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(testSerial.Add(1)),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: revokedUser.Leaf.SerialNumber, RevocationTime: time.Now()},
+			{SerialNumber: revokedNas.Leaf.SerialNumber, RevocationTime: time.Now()},
+		},
+	}, pki.ca.certificate, pki.ca.key)
+	if err != nil {
+		t.Fatalf("create CRL: %v", err)
+	}
+	path := filepath.Join(pki.dir, "revoked.crl")
+	if err := writePem(path, "X509 CRL", crl); err != nil {
+		t.Fatal(err)
+	}
+
+	revocationConfig := &config.AppConfig.RadiusServer.Revocation
+	revocationConfig.CrlSources = []string{path}
+	revocationConfig.OcspEnabled = false
+	// the CRL knows the status of every certificate of the CA
+	revocationConfig.FailPolicy = "hard"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := revocation.Start(ctx); err != nil {
+		t.Fatalf("load CRL: %v", err)
+	}
+
+	runRevocationCases(t, []revocationCase{
+		{name: "revoked", user: revokedUser, nas: revokedNas},
+		{name: "valid", user: issueTestCertificate(t, pki.ca, testTlsUser1), nas: pki.nas, accepted: true},
+	})
+}
+
+func testRevocationOcsp(t *testing.T) {
+	responder := newOcspResponder(pki.ocspCa)
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	revokedUser := issueTestCertificate(t, pki.ocspCa, testTlsUser1)
+	revokedNas := issueTestCertificate(t, pki.ocspCa, testNasName)
+	responder.revoke(revokedUser.Leaf.SerialNumber)
+	responder.revoke(revokedNas.Leaf.SerialNumber)
+
+	revocationConfig := &config.AppConfig.RadiusServer.Revocation
+	revocationConfig.CrlSources = nil
+	revocationConfig.OcspEnabled = true
+	revocationConfig.OcspResponderUrl = server.URL
+	// a revoked certificate is rejected whatever the fail policy
+	revocationConfig.FailPolicy = "soft"
+
+	runRevocationCases(t, []revocationCase{
+		{name: "revoked", user: revokedUser, nas: revokedNas},
+		{
+			name:     "valid",
+			user:     issueTestCertificate(t, pki.ocspCa, testTlsUser1),
+			nas:      issueTestCertificate(t, pki.ocspCa, testNasName),
+			accepted: true,
+		},
+	})
+}
+
+// testRevocationFailPolicy checks the certificates whose status is unknown,
+// the OCSP responder being unreachable.
+func testRevocationFailPolicy(t *testing.T) {
+	port, err := freePort("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocationConfig := &config.AppConfig.RadiusServer.Revocation
+	revocationConfig.CrlSources = nil
+	revocationConfig.OcspEnabled = true
+	revocationConfig.OcspResponderUrl = "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+
+	for _, policy := range []string{"soft", "hard"} {
+		revocationConfig.FailPolicy = policy
+		runRevocationCases(t, []revocationCase{{
+			name:     policy,
+			user:     issueTestCertificate(t, pki.ocspCa, testTlsUser1),
+			nas:      issueTestCertificate(t, pki.ocspCa, testNasName),
+			accepted: policy == "soft",
+		}})
+	}
+}
+
+// runRevocationCases authenticates with EAP-TLS and connects over RadSec
+// with the certificates of each case.
+func runRevocationCases(t *testing.T, cases []revocationCase) {
+	t.Helper()
+	for _, c := range cases {
+		_, response := eapTlsAuthenticate(t, testTlsUser1, newEapTlsSupplicant(c.user, tls.VersionTLS13))
+		want := radius.CodeAccessReject
+		if c.accepted {
+			want = radius.CodeAccessAccept
+		}
+		if response.Code != want {
+			t.Errorf("%s: EAP-TLS response %s, want %s", c.name, response.Code, want)
+		}
+
+		err := radSecStatusServer(c.nas)
+		if c.accepted && err != nil {
+			t.Errorf("%s: RadSec Status-Server: %v", c.name, err)
+		}
+		if !c.accepted && err == nil {
+			t.Errorf("%s: RadSec connection accepted", c.name)
+		}
+	}
+}
+
+func issueTestCertificate(t *testing.T, ca *testCa, commonName string) tls.Certificate {
+	t.Helper()
+	certificate, err := ca.issue(commonName, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+// radSecStatusServer connects to the RadSec listener with certificate and
+// sends a Status-Server.
+func radSecStatusServer(certificate tls.Certificate) error {
+	dialer := &net.Dialer{Timeout: exchangeTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", radSecAddress, &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		RootCAs:      pki.ca.pool(),
+		ServerName:   testServerName,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(exchangeTimeout)); err != nil {
+		return err
+	}
+
+	request := radius.New(radius.CodeStatusServer, []byte("radsec"))
+	if err := handlers.SignMessageAuthenticator(request); err != nil {
+		return err
+	}
+	encoded, err := request.Encode()
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(encoded); err != nil {
+		return err
+	}
+	// with TLS 1.3 a rejected certificate is only reported on the first read
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if length < len(header) {
+		return io.ErrUnexpectedEOF
+	}
+	raw := make([]byte, length)
+	copy(raw, header)
+	if _, err := io.ReadFull(conn, raw[len(header):]); err != nil {
+		return err
+	}
+	response, err := radius.Parse(raw, request.Secret)
+	if err != nil {
+		return err
+	}
+	if !radius.IsAuthenticResponse(raw, encoded, request.Secret) {
+		return errNotAuthentic
+	}
+	if response.Code != radius.CodeAccessAccept {
+		return fmt.Errorf("status server answered with %s", response.Code)
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package tests
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"radius-server/src/config"
+	"radius-server/src/radius/eap"
+	"radius-server/src/radius/handlers"
+	"radius-server/src/radius/mschap"
+	cryptoUtil "radius-server/src/utils/crypto"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+)
+
+// EAP-TTLS through the UDP access listener, with the outer identity
+// testEapUser and the inner identity testTunnelUser told by the
+// Reply-Message of its reply items. Resumed sessions share a client session
+// cache, the peer still sends its inner credentials, which the server only
+// verifies when it no longer remembers the session.
+
+const (
+	ttlsInnerPap      = "pap"
+	ttlsInnerChap     = "chap"
+	ttlsInnerMschapv2 = "mschapv2"
+	ttlsInnerEap      = "eap"
+)
+
+const (
+	ttlsAvpUserName        = 1
+	ttlsAvpUserPassword    = 2
+	ttlsAvpChapPassword    = 3
+	ttlsAvpChapChallenge   = 60
+	ttlsAvpEapMessage      = 79
+	ttlsAvpMsChapChallenge = 11
+	ttlsAvpMsChap2Response = 25
+	ttlsAvpMsChap2Success  = 26
+	ttlsVendorMicrosoft    = 311
+
+	ttlsAvpFlagVendor    = 0x80
+	ttlsAvpFlagMandatory = 0x40
+)
+
+func testTtls(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		method  string
+		version uint16
+	}{
+		{"Pap/Tls12", ttlsInnerPap, tls.VersionTLS12},
+		{"Pap/Tls13", ttlsInnerPap, tls.VersionTLS13},
+		{"Chap/Tls13", ttlsInnerChap, tls.VersionTLS13},
+		{"Mschapv2/Tls12", ttlsInnerMschapv2, tls.VersionTLS12},
+		{"Mschapv2/Tls13", ttlsInnerMschapv2, tls.VersionTLS13},
+		{"Eap/Tls13", ttlsInnerEap, tls.VersionTLS13},
+	} {
+		t.Run(c.name, func(t *testing.T) { testTtlsAccept(t, c.method, c.version) })
+	}
+	t.Run("Reject", testTtlsReject)
+	t.Run("Resumption/Tls12", func(t *testing.T) { testTtlsResumption(t, tls.VersionTLS12) })
+	t.Run("Resumption/Tls13", func(t *testing.T) { testTtlsResumption(t, tls.VersionTLS13) })
+	t.Run("ResumptionExpiry", testTtlsResumptionExpiry)
+}
+
+func testTtlsAccept(t *testing.T, method string, version uint16) {
+	peer := &ttlsPeer{method: method, identity: testTunnelUser, password: testTunnelPassword}
+	supplicant := ttlsAuthenticateAccept(t, peer, newTunnelSupplicant(eap.TypeTtls, version, peer.run))
+	if supplicant.state.Version != version {
+		t.Errorf("tls version %x, want %x", supplicant.state.Version, version)
+	}
+	switch method {
+	case ttlsInnerMschapv2:
+		if !peer.serverAuthenticated {
+			t.Error("MS-CHAP2-Success does not hold the authenticator response")
+		}
+	case ttlsInnerEap:
+		// EAP-MSCHAPv2 is proposed first and refused for EAP-GTC
+		if want := []eap.Type{eap.TypeMschapv2, eap.TypeGtc}; !slices.Equal(peer.innerRequests, want) {
+			t.Errorf("inner eap requests %v, want %v", peer.innerRequests, want)
+		}
+	}
+}
+
+func testTtlsReject(t *testing.T) {
+	peer := &ttlsPeer{method: ttlsInnerPap, identity: testTunnelUser, password: "wrong-password"}
+	_, response := eapTlsAuthenticate(t, testEapUser, newTunnelSupplicant(eap.TypeTtls, tls.VersionTLS13, peer.run))
+	if response.Code != radius.CodeAccessReject {
+		t.Fatalf("response %s, want %s", response.Code, radius.CodeAccessReject)
+	}
+}
+
+// testTtlsResumption resumes the session of testTunnelUser with the
+// credentials of another identity, the server accepts the identity it
+// remembers without the inner authentication.
+func testTtlsResumption(t *testing.T, version uint16) {
+	sessions := tls.NewLRUClientSessionCache(1)
+	peer := &ttlsPeer{method: ttlsInnerPap, identity: testTunnelUser, password: testTunnelPassword}
+	ttlsAuthenticateAccept(t, peer, newTtlsSupplicant(version, sessions, peer))
+
+	peer = &ttlsPeer{method: ttlsInnerPap, identity: testEapUser, password: "wrong-password"}
+	supplicant := ttlsAuthenticateAccept(t, peer, newTtlsSupplicant(version, sessions, peer))
+	if !supplicant.state.DidResume {
+		t.Error("tls session not resumed")
+	}
+}
+
+// testTtlsResumptionExpiry resumes a session after EAP_TTLS_RESUMPTION_TTL_SEC,
+// the server verifies the inner credentials again. The EAP server is created
+// again with the setting, and with the test configuration when done.
+func testTtlsResumptionExpiry(t *testing.T) {
+	eapConfig := &config.AppConfig.RadiusServer.Eap
+	saved := eapConfig.TtlsResumptionTtlSec
+	t.Cleanup(func() {
+		eapConfig.TtlsResumptionTtlSec = saved
+		if err := handlers.InitEap(); err != nil {
+			t.Errorf("restore EAP server: %v", err)
+		}
+	})
+	eapConfig.TtlsResumptionTtlSec = 1
+	if err := handlers.InitEap(); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := tls.NewLRUClientSessionCache(1)
+	peer := &ttlsPeer{method: ttlsInnerPap, identity: testTunnelUser, password: testTunnelPassword}
+	ttlsAuthenticateAccept(t, peer, newTtlsSupplicant(tls.VersionTLS12, sessions, peer))
+	time.Sleep(time.Duration(eapConfig.TtlsResumptionTtlSec)*time.Second + 100*time.Millisecond)
+
+	peer = &ttlsPeer{method: ttlsInnerPap, identity: testTunnelUser, password: "wrong-password"}
+	supplicant := newTtlsSupplicant(tls.VersionTLS12, sessions, peer)
+	_, response := eapTlsAuthenticate(t, testEapUser, supplicant)
+	if !supplicant.state.DidResume {
+		t.Fatal("tls session not resumed")
+	}
+	if response.Code != radius.CodeAccessReject {
+		t.Fatalf("expired session %s with a wrong password, want %s", response.Code, radius.CodeAccessReject)
+	}
+
+	peer = &ttlsPeer{method: ttlsInnerPap, identity: testTunnelUser, password: testTunnelPassword}
+	ttlsAuthenticateAccept(t, peer, newTtlsSupplicant(tls.VersionTLS12, sessions, peer))
+}
+
+func newTtlsSupplicant(version uint16, sessions tls.ClientSessionCache, peer *ttlsPeer) *eapTlsSupplicant {
+	supplicant := newTunnelSupplicant(eap.TypeTtls, version, peer.run)
+	supplicant.config.ClientSessionCache = sessions
+	return supplicant
+}
+
+// ttlsAuthenticateAccept runs the conversation of the supplicant and checks
+// that the server accepts testTunnelUser with the keys of the session.
+func ttlsAuthenticateAccept(t *testing.T, peer *ttlsPeer, supplicant *eapTlsSupplicant) *eapTlsSupplicant {
+	t.Helper()
+	request, response := eapTlsAuthenticate(t, testEapUser, supplicant)
+	if response.Code != radius.CodeAccessAccept {
+		t.Fatalf("response %s, want %s (%s)", response.Code, radius.CodeAccessAccept, rfc2865.ReplyMessage_GetString(response))
+	}
+	if supplicant.err != nil {
+		t.Fatalf("supplicant: %v", supplicant.err)
+	}
+	if got := rfc2865.ReplyMessage_GetString(response); got != testTunnelUser {
+		t.Errorf("reply items of %q, want those of the inner identity %q", got, testTunnelUser)
+	}
+	checkMppeKeys(t, request, response, supplicant.msk(t))
+	return supplicant
+}
+
+// ttlsPeer is the inner conversation of the EAP-TTLS supplicant. It sends
+// the inner credentials of method as AVPs, or answers an inner EAP
+// conversation refusing EAP-MSCHAPv2 for EAP-GTC.
+type ttlsPeer struct {
+	method   string
+	identity string
+	password string
+
+	serverAuthenticated bool
+	innerRequests       []eap.Type
+}
+
+func (p *ttlsPeer) run(conn *tls.Conn) error {
+	state := conn.ConnectionState()
+	challenge, err := state.ExportKeyingMaterial("ttls challenge", nil, 17)
+	if err != nil {
+		return err
+	}
+
+	if p.method == ttlsInnerEap {
+		if err := p.eap(conn); err != nil {
+			return err
+		}
+		return readTtlsEnd(conn)
+	}
+
+	avps := appendTtlsAvp(nil, ttlsAvpUserName, 0, []byte(p.identity))
+	switch p.method {
+	case ttlsInnerPap:
+		password := []byte(p.password)
+		password = append(password, make([]byte, (16-len(password)%16)%16)...)
+		avps = appendTtlsAvp(avps, ttlsAvpUserPassword, 0, password)
+	case ttlsInnerChap:
+		hash := md5.New()
+		hash.Write(challenge[16:])
+		hash.Write([]byte(p.password))
+		hash.Write(challenge[:16])
+		avps = appendTtlsAvp(avps, ttlsAvpChapChallenge, 0, challenge[:16])
+		avps = appendTtlsAvp(avps, ttlsAvpChapPassword, 0, append([]byte{challenge[16]}, hash.Sum(nil)...))
+	case ttlsInnerMschapv2:
+		return p.mschapv2(conn, challenge, avps)
+	}
+	if _, err := conn.Write(avps); err != nil {
+		return err
+	}
+	return readTtlsEnd(conn)
+}
+
+// mschapv2 sends MS-CHAP2-Response and verifies the MS-CHAP2-Success of the
+// server, acknowledged by the empty response of the supplicant.
+func (p *ttlsPeer) mschapv2(conn *tls.Conn, challenge []byte, avps []byte) error {
+	peerChallenge := make([]byte, 16)
+	if _, err := rand.Read(peerChallenge); err != nil {
+		return err
+	}
+	ntHash := cryptoUtil.NtPasswordHash(p.password)
+	username := mschap.ChallengeUsername(p.identity)
+	ntResponse := mschap.NtResponse(challenge[:16], peerChallenge, username, ntHash)
+
+	response := append([]byte{challenge[16], 0}, peerChallenge...)
+	response = append(response, make([]byte, 8)...)
+	response = append(response, ntResponse...)
+	avps = appendTtlsAvp(avps, ttlsAvpMsChapChallenge, ttlsVendorMicrosoft, challenge[:16])
+	avps = appendTtlsAvp(avps, ttlsAvpMsChap2Response, ttlsVendorMicrosoft, response)
+	if _, err := conn.Write(avps); err != nil {
+		return err
+	}
+
+	reply, err := readTtlsAvps(conn)
+	if err != nil {
+		return err
+	}
+	success := reply[ttlsAvpKey{ttlsAvpMsChap2Success, ttlsVendorMicrosoft}]
+	if len(success) < 1 || success[0] != challenge[16] {
+		return errors.New("MS-CHAP2-Success missing or of another identifier")
+	}
+	expected := mschap.AuthenticatorResponse(challenge[:16], peerChallenge, ntResponse, username, ntHash)
+	p.serverAuthenticated = string(success[1:]) == expected
+	return nil
+}
+
+// eap answers the inner EAP conversation, from the Identity response to the
+// EAP-GTC response.
+func (p *ttlsPeer) eap(conn *tls.Conn) error {
+	response := &eap.Packet{Code: eap.CodeResponse, Type: eap.TypeIdentity, Data: []byte(p.identity)}
+	for {
+		if _, err := conn.Write(appendTtlsAvp(nil, ttlsAvpEapMessage, 0, response.Encode())); err != nil {
+			return err
+		}
+		if response.Type == eap.TypeGtc {
+			return nil
+		}
+
+		reply, err := readTtlsAvps(conn)
+		if err != nil {
+			return err
+		}
+		request, err := eap.Parse(reply[ttlsAvpKey{code: ttlsAvpEapMessage}])
+		if err != nil {
+			return err
+		}
+		if request.Code != eap.CodeRequest {
+			return fmt.Errorf("inner eap code %d, want a request", request.Code)
+		}
+		p.innerRequests = append(p.innerRequests, request.Type)
+		response = &eap.Packet{Code: eap.CodeResponse, Identifier: request.Identifier, Type: request.Type}
+		switch request.Type {
+		case eap.TypeMschapv2:
+			response.Type, response.Data = eap.TypeNak, []byte{byte(eap.TypeGtc)}
+		case eap.TypeGtc:
+			response.Data = []byte(p.password)
+		default:
+			return fmt.Errorf("unexpected inner %s request", request.Type)
+		}
+	}
+}
+
+// readTtlsEnd waits for the end of the conversation, in which the server
+// sends no more tunneled data. The read also processes the session tickets
+// of TLS 1.3, sent after the handshake.
+func readTtlsEnd(conn *tls.Conn) error {
+	if n, _ := conn.Read(make([]byte, 1)); n > 0 {
+		return errors.New("tunneled data after the inner authentication")
+	}
+	return nil
+}
+
+type ttlsAvpKey struct {
+	code   uint32
+	vendor uint32
+}
+
+// appendTtlsAvp appends a mandatory AVP (RFC 5281 section 10.1), padded to a
+// multiple of 4 bytes.
+func appendTtlsAvp(b []byte, code uint32, vendor uint32, data []byte) []byte {
+	flags, length := byte(ttlsAvpFlagMandatory), 8+len(data)
+	if vendor != 0 {
+		flags |= ttlsAvpFlagVendor
+		length += 4
+	}
+	b = binary.BigEndian.AppendUint32(b, code)
+	b = binary.BigEndian.AppendUint32(b, uint32(flags)<<24|uint32(length))
+	if vendor != 0 {
+		b = binary.BigEndian.AppendUint32(b, vendor)
+	}
+	b = append(b, data...)
+	return append(b, make([]byte, (4-length%4)%4)...)
+}
+
+// readTtlsAvps reads the next tunneled AVPs of the server.
+func readTtlsAvps(conn *tls.Conn) (map[ttlsAvpKey][]byte, error) {
+	b := make([]byte, 16*1024)
+	n, err := conn.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	avps := map[ttlsAvpKey][]byte{}
+	for data := b[:n]; len(data) > 0; {
+		if len(data) < 8 {
+			return nil, errors.New("truncated AVP header")
+		}
+		key := ttlsAvpKey{code: binary.BigEndian.Uint32(data)}
+		flags, length := data[4], int(binary.BigEndian.Uint32(data[4:8])&0xffffff)
+		header := 8
+		if flags&ttlsAvpFlagVendor != 0 {
+			header = 12
+		}
+		if length < header || length > len(data) {
+			return nil, errors.New("malformed AVP length")
+		}
+		if header == 12 {
+			key.vendor = binary.BigEndian.Uint32(data[8:12])
+		}
+		avps[key] = append(avps[key], data[header:length]...)
+		data = data[min(len(data), (length+3)&^3):]
+	}
+	return avps, nil
+}